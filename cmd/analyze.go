@@ -10,36 +10,78 @@
 package cmd
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/spf13/cobra"
 )
 
+var analyzeBenchmarks []string
+
 // analyzeCmd represents the analyze command
 var analyzeCmd = &cobra.Command{
 	Use:   "analyze",
 	Short: "Analyzes benchmark results",
-	Long:  `Processes log files containing benchmark results and produces CSV files`,
+	Long: `Processes log files containing benchmark results and produces CSV files
+(or any of the other supported output formats)`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkOutputFormats(); err != nil {
+			return err
+		}
+		if err := checkRunPolicy(); err != nil {
+			return err
+		}
+		if tpccMinPassingRuns < 1 {
+			return fmt.Errorf("--min-passing-runs must be at least 1")
+		}
+		if analyzeParallelism < 1 {
+			return fmt.Errorf("--parallelism must be at least 1")
+		}
+		policies, err := slaPolicies()
+		if err != nil {
+			return err
+		}
+		analyzeSLAPolicies = policies
+		if err := configureSanityRules(); err != nil {
+			return err
+		}
 		return analyzeResults()
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(analyzeCmd)
+
+	analyzeCmd.Flags().StringSliceVar(&analyzeBenchmarks, "bench", nil,
+		fmt.Sprintf("comma separated list of benchmarks to analyze: %s; all if not specified",
+			strings.Join(benchmarkNames(), ", ")))
+	analyzeCmd.Flags().StringVar(&analyzeRuns, "runs", analyzeRuns,
+		fmt.Sprintf("runs of the same configuration to analyze: %s", strings.Join(runPolicies, ", ")))
+	analyzeCmd.Flags().IntVar(&tpccMinPassingRuns, "min-passing-runs", tpccMinPassingRuns,
+		"minimum number of passing TPC-C runs required for the configuration to pass")
+	analyzeCmd.Flags().StringVar(&pricingFile, "pricing", "",
+		"path to JSON pricing catalog; if specified, price-performance of benchmark results is reported")
+	analyzeCmd.Flags().IntVar(&tpccNodes, "tpcc-nodes", tpccNodes,
+		"number of CockroachDB nodes in TPC-C clusters; used to compute TPC-C price-performance")
+	analyzeCmd.Flags().IntVar(&analyzeParallelism, "parallelism", runtime.NumCPU(),
+		"maximum number of machine types analyzed concurrently")
+	analyzeCmd.Flags().StringSliceVar(&outputFormats, "format", outputFormats,
+		fmt.Sprintf("comma separated list of output formats: %s", strings.Join(resultFormatNames(), ", ")))
 }
 
 // resultsAnalyzer is an interface responsible for analyzing benchmark results.
@@ -60,15 +102,30 @@ func newPerCloudAnalyzer(f func(cloudName string) resultsAnalyzer) resultsAnalyz
 	}
 }
 
+// Close closes analyzers of all clouds, even if some of them fail.
 func (p *perCloudAnalyzer) Close() error {
-	for _, a := range p.analyzers {
-		if err := a.Close(); err != nil {
-			return err
+	var errs []string
+	for _, cloud := range p.cloudNames() {
+		if err := p.analyzers[cloud].Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", cloud, err))
 		}
 	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
 	return nil
 }
 
+// cloudNames returns sorted names of the analyzed clouds.
+func (p *perCloudAnalyzer) cloudNames() []string {
+	names := make([]string, 0, len(p.analyzers))
+	for cloud := range p.analyzers {
+		names = append(names, cloud)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (p *perCloudAnalyzer) Analyze(cloud CloudDetails) error {
 	a, ok := p.analyzers[cloud.Cloud]
 
@@ -81,6 +138,20 @@ func (p *perCloudAnalyzer) Analyze(cloud CloudDetails) error {
 
 var _ resultsAnalyzer = &perCloudAnalyzer{}
 
+// forEachCloudAnalyzer calls fn for the analyzer of every cloud analyzed by
+// the per cloud analyzers.
+func forEachCloudAnalyzer(analyzers []resultsAnalyzer, fn func(cloud string, a resultsAnalyzer)) {
+	for _, a := range analyzers {
+		pc, ok := a.(*perCloudAnalyzer)
+		if !ok {
+			continue
+		}
+		for _, cloud := range pc.cloudNames() {
+			fn(cloud, pc.analyzers[cloud])
+		}
+	}
+}
+
 // lat represents fio total latencies.
 // Values in nanoseconds.
 type lat struct {
@@ -104,7 +175,15 @@ type ioStats struct {
 	Clat      clat  `json:"clat_ns"`   // IO completion latencies. includes percentiles
 }
 
-func ioStatsCSV(s *ioStats) []string {
+// ioRate returns the rate of IO operations per second.
+func ioRate(s *ioStats) float64 {
+	if s.TotalIOS > 0 && s.RuntimeMS > 0 {
+		return float64(s.TotalIOS) / (float64(s.RuntimeMS) / 1000)
+	}
+	return 0
+}
+
+func ioStatsValues(s *ioStats) []interface{} {
 	secs := float64(s.RuntimeMS) / 1000
 	rate := func(v int64) float64 {
 		if v > 0 {
@@ -113,23 +192,23 @@ func ioStatsCSV(s *ioStats) []string {
 		return 0
 	}
 
-	fields := []string{
+	fields := []interface{}{
 		// Number and rate of IO operations.
-		fmt.Sprintf("%d", s.TotalIOS),
-		fmt.Sprintf("%.3f", rate(s.TotalIOS)), // IOP/sec
+		s.TotalIOS,
+		fixedPoint{rate(s.TotalIOS), 3}, // IOP/sec
 		// Total amount of data read or written + Bandwidth in KiB/s
-		fmt.Sprintf("%d", s.IOBytes),
-		fmt.Sprintf("%f", rate(s.IOBytes)/1024), // Bandwidth: KiB/s
+		s.IOBytes,
+		rate(s.IOBytes) / 1024, // Bandwidth: KiB/s
 		// Total Latency
-		fmt.Sprintf("%f", s.Lat.Min),
-		fmt.Sprintf("%f", s.Lat.Max),
-		fmt.Sprintf("%f", s.Lat.Mean),
-		fmt.Sprintf("%f", s.Lat.Dev),
+		s.Lat.Min,
+		s.Lat.Max,
+		s.Lat.Mean,
+		s.Lat.Dev,
 	}
 
 	// Add completion latency percentiles.
 	for _, pct := range []string{"90.000000", "95.000000", "99.000000", "99.900000", "99.990000"} {
-		fields = append(fields, fmt.Sprintf("%d", s.Clat.Percentiles[pct]))
+		fields = append(fields, s.Clat.Percentiles[pct])
 	}
 	return fields
 }
@@ -151,17 +230,17 @@ type fioJob struct {
 type fioResults struct {
 	Timestamp   int64    `json:"timestamp"`
 	Jobs        []fioJob `json:"jobs"`
-	modtime     time.Time
 	machinetype string
 	disktype    string
+	run         string
 }
 
-const fioResultsCSVHeader = `Cloud,Group,Machine,Date,Job,BS,IoDepth,` +
+const fioResultsCSVHeader = `Cloud,Group,Machine,Date,Run,Job,BS,IoDepth,` +
 	`RdIOPs,RdIOP/s,RdBytes,RdBW(KiB/s),RdlMin,RdlMax,RdlMean,RdlStd,Rd90,Rd95,Rd99,Rd99.9,Rd99.99,` +
 	`WrIOPs,WrIOP/s,WrBytes,WrBW(KiB/s),WrlMin,WrlMax,WrlMean,WrlStd,Wr90,Wr95,Wr99,Wr99.9,Wr99.99,` +
-	`LatDepth,LatTarget,LatTargetPct,LatWindow`
+	`LatDepth,LatTarget,LatTargetPct,LatWindow,Sanity`
 
-func (r *fioResults) CSV(cloud string, wr io.Writer) {
+func (r *fioResults) write(cloud string, wr ResultWriter) error {
 	iodepth := func(o map[string]string) string {
 		if d, ok := o["iodepth"]; ok {
 			return d
@@ -170,73 +249,196 @@ func (r *fioResults) CSV(cloud string, wr io.Writer) {
 	}
 
 	for _, j := range r.Jobs {
-		fields := []string{
+		fields := []interface{}{
 			cloud,
 			r.disktype,
 			r.machinetype,
-			time.Unix(r.Timestamp, 0).String(),
+			time.Unix(r.Timestamp, 0),
+			r.run,
 			j.Name,
 			j.Opts["bs"],
 			iodepth(j.Opts),
 		}
-		fields = append(fields, ioStatsCSV(&j.ReadStats)...)
-		fields = append(fields, ioStatsCSV(&j.WriteStats)...)
-		fields = append(fields, []string{
-			fmt.Sprintf("%.2f", j.LatDepth),
-			fmt.Sprintf("%d", j.LatTargetUS),
-			fmt.Sprintf("%.2f", j.LatTargetPct),
-			fmt.Sprintf("%d", j.LatWindowUS),
-		}...)
-		fmt.Fprintf(wr, "%s\n", strings.Join(fields, ","))
+		fields = append(fields, ioStatsValues(&j.ReadStats)...)
+		fields = append(fields, ioStatsValues(&j.WriteStats)...)
+		fields = append(fields, fixedPoint{j.LatDepth, 2}, j.LatTargetUS, fixedPoint{j.LatTargetPct, 2}, j.LatWindowUS)
+		fields = append(fields, fioJobSanity(&j).column())
+		if err := wr.Write(fields); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func (f *fioAnalyzer) analyzeFIO(cloud CloudDetails, machineType string) error {
 	// Find successful FIO runs (those that have success file)
-	glob := path.Join(cloud.LogDir(), FormatMachineType(machineType), "fio-results.*/success")
-	goodRuns, err := filepath.Glob(glob)
+	goodRuns, err := filepath.Glob(f.bench.ResultsGlob(cloud, machineType))
 	if err != nil {
 		return err
 	}
 
-	latest := &fioResults{
-		machinetype: machineType,
-		disktype:    cloud.Group,
-	}
-
 	for _, r := range goodRuns {
 		// Read fio-results
-		info, err := os.Stat(r)
+		log.Printf("Analyzing %s", r)
+		id, err := newRunID(f.bench, cloud, machineType, r)
 		if err != nil {
-			return err
+			analyzeDiagnostics.machineError(f.bench, cloud, machineType, r, err)
+			continue
 		}
 
-		log.Printf("Analyzing %s", r)
-		if latest.modtime.After(info.ModTime()) {
-			log.Printf("--Skipping coremark log %q (already analyzed newer)", r)
+		resultsPath := path.Join(filepath.Dir(r), "fio-results.json")
+		res := &fioResults{
+			machinetype: machineType,
+			disktype:    cloud.Group,
+			run:         runLabel([]runRef{{id: id}}),
+		}
+		if err := parseFIOResults(resultsPath, res); err != nil {
+			analyzeDiagnostics.runError(id, resultsPath, err)
 			continue
 		}
+		f.mu.Lock()
+		f.runs[runRef{id: id}] = res
+		f.mu.Unlock()
+	}
+	return nil
+}
 
-		latest.modtime = info.ModTime()
-		resultsPath := path.Join(filepath.Dir(r), "fio-results.json")
-		data, err := ioutil.ReadFile(resultsPath)
+// parseFIOResults parses the fio results file into res.
+func parseFIOResults(p string, res *fioResults) error {
+	return analyzeCache.parse(fioParser, p, res, func() error {
+		data, err := ioutil.ReadFile(p)
 		if err != nil {
 			return err
 		}
-		if err := json.Unmarshal(data, &latest); err != nil {
-			fmt.Printf("Error unmarshalling %s: %v", resultsPath, err)
+		if err := json.Unmarshal(data, res); err != nil {
+			return fmt.Errorf("error unmarshalling fio results: %v", err)
 		}
+		return nil
+	})
+}
+
+// results returns fio results of the runs selected by the --runs policy.
+func (f *fioAnalyzer) results() []*fioResults {
+	return f.resultsOf(groupRuns(f.refs(), analyzeRuns))
+}
+
+func (f *fioAnalyzer) refs() []runRef {
+	refs := make([]runRef, 0, len(f.runs))
+	for ref := range f.runs {
+		refs = append(refs, ref)
 	}
+	return refs
+}
 
-	f.results[fmt.Sprintf("%s-%s", machineType, cloud.Group)] = latest
-	return nil
+// resultsOf returns a result of every group of runs.  Job statistics of
+// grouped runs are averaged.
+func (f *fioAnalyzer) resultsOf(groups [][]runRef) []*fioResults {
+	var results []*fioResults
+	for _, g := range groups {
+		runs := make([]*fioResults, len(g))
+		for i, ref := range g {
+			runs[i] = f.runs[ref]
+		}
+		res := averageFioResults(runs)
+		res.run = runLabel(g)
+		results = append(results, res)
+	}
+	return results
+}
+
+// averageFioResults averages statistics of the jobs of repeated fio runs.
+// Jobs are matched by name; the latest run determines the set of jobs.
+func averageFioResults(runs []*fioResults) *fioResults {
+	latest := runs[len(runs)-1]
+	avg := *latest
+	avg.Jobs = make([]fioJob, len(latest.Jobs))
+	for i, j := range latest.Jobs {
+		var reads, writes []*ioStats
+		for _, r := range runs {
+			for k := range r.Jobs {
+				if r.Jobs[k].Name == j.Name {
+					reads = append(reads, &r.Jobs[k].ReadStats)
+					writes = append(writes, &r.Jobs[k].WriteStats)
+				}
+			}
+		}
+		j.ReadStats = averageIOStats(reads)
+		j.WriteStats = averageIOStats(writes)
+		avg.Jobs[i] = j
+	}
+	return &avg
+}
+
+func averageIOStats(stats []*ioStats) ioStats {
+	if len(stats) == 1 {
+		return *stats[0]
+	}
+	avgLat := func(get func(s *ioStats) *lat) lat {
+		var l lat
+		for _, s := range stats {
+			sl := get(s)
+			l.Min += sl.Min
+			l.Max += sl.Max
+			l.Mean += sl.Mean
+			l.Dev += sl.Dev
+		}
+		n := float64(len(stats))
+		return lat{Min: l.Min / n, Max: l.Max / n, Mean: l.Mean / n, Dev: l.Dev / n}
+	}
+
+	var avg ioStats
+	n := int64(len(stats))
+	avg.Clat.Percentiles = make(map[string]int64)
+	for _, s := range stats {
+		avg.TotalIOS += s.TotalIOS
+		avg.IOBytes += s.IOBytes
+		avg.RuntimeMS += s.RuntimeMS
+		for pct, v := range s.Clat.Percentiles {
+			avg.Clat.Percentiles[pct] += v
+		}
+	}
+	avg.TotalIOS /= n
+	avg.IOBytes /= n
+	avg.RuntimeMS /= n
+	for pct := range avg.Clat.Percentiles {
+		avg.Clat.Percentiles[pct] /= n
+	}
+	avg.Lat = avgLat(func(s *ioStats) *lat { return &s.Lat })
+	avg.Clat.lat = avgLat(func(s *ioStats) *lat { return &s.Clat.lat })
+	return avg
 }
 
 type analyzeFn func(c CloudDetails, machineType string) error
 
+// analyzeParallelism is the maximum number of machine types analyzed
+// concurrently by each analyzer.
+var analyzeParallelism = 1
+
+// forEachMachine calls fn for every machine type of the cloud, running up to
+// analyzeParallelism calls concurrently.  Analyzers must therefore guard
+// their state; results are sorted when written, so the order in which
+// machine types complete does not matter.  The error of the first machine
+// type (in sorted order) which failed is returned.
 func forEachMachine(cloud CloudDetails, fn analyzeFn) error {
-	for machineType := range cloud.MachineTypes {
-		if err := fn(cloud, machineType); err != nil {
+	machineTypes := sortedMachineTypes(cloud)
+	errs := make([]error, len(machineTypes))
+	sem := make(chan struct{}, analyzeParallelism)
+	var wg sync.WaitGroup
+	for i, machineType := range machineTypes {
+		i, machineType := i, machineType
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = fn(cloud, machineType)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
 			return err
 		}
 	}
@@ -244,28 +446,36 @@ func forEachMachine(cloud CloudDetails, fn analyzeFn) error {
 }
 
 type fioAnalyzer struct {
-	cloud   string
-	results map[string]*fioResults
+	bench *Benchmark
+	cloud string
+	mu    sync.Mutex
+	runs  map[runRef]*fioResults
 }
 
 var _ resultsAnalyzer = &fioAnalyzer{}
 
-func newFioAnalyzer(cloud string) resultsAnalyzer {
+func newFioAnalyzer(b *Benchmark, cloud string) resultsAnalyzer {
 	return &fioAnalyzer{
-		cloud:   cloud,
-		results: make(map[string]*fioResults)}
+		bench: b,
+		cloud: cloud,
+		runs:  make(map[runRef]*fioResults)}
 }
 
-func (f *fioAnalyzer) Close() error {
-	wr, err := os.OpenFile(ResultsFile("fio.csv", f.cloud), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+func (f *fioAnalyzer) Close() (err error) {
+	wr, err := newResultWriter("fio", strings.Split(fioResultsCSVHeader, ","), f.cloud)
 	if err != nil {
 		return err
 	}
-	defer wr.Close()
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
 
-	fmt.Fprintf(wr, "%s\n", fioResultsCSVHeader)
-	for _, res := range f.results {
-		res.CSV(f.cloud, wr)
+	for _, res := range f.results() {
+		if err := res.write(f.cloud, wr); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -279,6 +489,35 @@ func ResultsFile(fname string, subdirs ...string) string {
 	return filepath.Join(p, fname)
 }
 
+func (f *fioAnalyzer) perfMetrics() []perfMetric {
+	var metrics []perfMetric
+	for _, res := range f.results() {
+		// Report the best IOPS achieved by any of the jobs.
+		var iops float64
+		for _, j := range res.Jobs {
+			if v := ioRate(&j.ReadStats) + ioRate(&j.WriteStats); v > iops {
+				iops = v
+			}
+		}
+		if iops == 0 {
+			continue
+		}
+		metrics = append(metrics, perfMetric{
+			benchmark:   f.bench.Name,
+			group:       res.disktype,
+			machineType: res.machinetype,
+			metric:      "IOP/s",
+			unit:        "IOPS",
+			value:       iops,
+			nodes:       1,
+			storage:     true,
+		})
+	}
+	return metrics
+}
+
+var _ pricePerformer = &fioAnalyzer{}
+
 func (f *fioAnalyzer) Analyze(cloud CloudDetails) error {
 	return forEachMachine(cloud, func(details CloudDetails, machineType string) error {
 		return f.analyzeFIO(details, machineType)
@@ -288,87 +527,188 @@ func (f *fioAnalyzer) Analyze(cloud CloudDetails) error {
 //
 // CPU Analysis
 //
-const cpuCSVHeader = "Cloud,Date,MachineType,Cores,Single,Multi,Multi/vCPU"
+const cpuCSVHeader = "Cloud,Group,Date,Run,MachineType,Cores,Single,Multi,Multi/vCPU,VCPUs,Sanity"
 
 type coremarkResult struct {
-	cores   int64
-	single  float64
-	multi   float64
-	modtime time.Time
+	group       string
+	machineType string
+	run         string
+	cores       int64
+	single      float64
+	multi       float64
+	modtime     time.Time
+	// vcpus is the number of vCPUs of the machine type according to the
+	// catalog; zero if unknown.
+	vcpus int64
+}
+
+// multiPerVCPU returns the multi-core score per vCPU of the catalog, if
+// known, or per core used by coremark.
+func (r *coremarkResult) multiPerVCPU() float64 {
+	if r.vcpus > 0 {
+		return r.multi / float64(r.vcpus)
+	}
+	return r.multi / float64(r.cores)
 }
 
 type coremarkAnalyzer struct {
-	machineResults map[string]*coremarkResult
-	cloud          string
+	bench *Benchmark
+	mu    sync.Mutex
+	runs  map[runRef]*coremarkResult
+	cloud string
 }
 
 var _ resultsAnalyzer = &coremarkAnalyzer{}
 
-func newCoremarkAnalyzer(cloud string) resultsAnalyzer {
+func newCoremarkAnalyzer(b *Benchmark, cloud string) resultsAnalyzer {
 	return &coremarkAnalyzer{
-		cloud:          cloud,
-		machineResults: make(map[string]*coremarkResult),
+		bench: b,
+		cloud: cloud,
+		runs:  make(map[runRef]*coremarkResult),
 	}
 }
 
-func parseCoremarkLog(p string) (int64, float64, error) {
-	// Extract the last line for the coremark output, and emit itersations/sec as well
-	// as (optional) number of cores that were used when running this benchmark.
-	cmd := exec.Command("sh", "-c",
-		fmt.Sprintf("tail -n 1 -q %s |cut -d/ -f1,4 | cut -d: -f2", p))
-	out, err := cmd.Output()
+// parseError describes a problem found while parsing a benchmark log.
+// It carries the file name and, when known, the 1-based line number.
+type parseError struct {
+	file string
+	line int
+	err  error
+}
+
+func (e *parseError) Error() string {
+	if e.line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.file, e.line, e.err)
+	}
+	return fmt.Sprintf("%s: %v", e.file, e.err)
+}
+
+func (e *parseError) Unwrap() error {
+	return e.err
+}
+
+func newParseError(file string, line int, format string, args ...interface{}) error {
+	return &parseError{file: file, line: line, err: fmt.Errorf(format, args...)}
+}
+
+// scanLines invokes fn for every line read from r.  Line numbers are 1-based.
+func scanLines(name string, r io.Reader, fn func(lineNo int, line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if err := fn(lineNo, scanner.Text()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return &parseError{file: name, line: lineNo + 1, err: err}
+	}
+	return nil
+}
+
+// parseFile opens p and hands it to the parse function.
+func parseFile(p string, parse func(name string, r io.Reader) error) error {
+	f, err := os.Open(p)
 	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return parse(p, f)
+}
+
+func parseCoremarkLog(p string) (int64, float64, error) {
+	var v struct {
+		Cores int64   `json:"cores"`
+		Iters float64 `json:"iters"`
+	}
+	err := analyzeCache.parse(coremarkParser, p, &v, func() error {
+		return parseFile(p, func(name string, r io.Reader) (err error) {
+			v.Cores, v.Iters, err = parseCoremarkOutput(name, r)
+			return err
+		})
+	})
+	return v.Cores, v.Iters, err
+}
+
+// parseCoremarkOutput extracts iterations/sec as well as the (optional) number
+// of cores used when running the benchmark from the last line of coremark output:
+//
+//	CoreMark 1.0 : 39132.713296 / GCC9.3.0 -O2 -DPERFORMANCE_RUN=1  -lrt / Heap / 8:PThreads
+//
+// Single core runs omit the last, "cores:threading model" field.
+func parseCoremarkOutput(name string, r io.Reader) (int64, float64, error) {
+	var last string
+	var lastNo int
+	if err := scanLines(name, r, func(lineNo int, line string) error {
+		if strings.TrimSpace(line) != "" {
+			last, lastNo = line, lineNo
+		}
+		return nil
+	}); err != nil {
 		return 0, 0, err
 	}
-	pieces := strings.Split(string(out), "/")
-	if len(pieces) == 0 || len(pieces) > 2 {
-		return 0, 0, fmt.Errorf("expected up to 2 fields, found 0 in %q", p)
+	if lastNo == 0 {
+		return 0, 0, newParseError(name, 0, "no coremark output found")
 	}
 
-	iters, err := strconv.ParseFloat(strings.TrimSpace(pieces[0]), 64)
+	pieces := strings.Split(last, "/")
+	colon := strings.Index(pieces[0], ":")
+	if colon < 0 {
+		return 0, 0, newParseError(name, lastNo, "expected \"CoreMark ... : <iterations/sec>\", found %q", last)
+	}
+	itersStr := strings.TrimSpace(pieces[0][colon+1:])
+	iters, err := strconv.ParseFloat(itersStr, 64)
 	if err != nil {
-		return 0, 0, fmt.Errorf("error parsing %q in %s: %v", pieces[0], p, err)
+		return 0, 0, newParseError(name, lastNo, "error parsing iterations %q: %v", itersStr, err)
 	}
+
 	var cores int64 = 1
-	if len(pieces) == 2 {
-		c, err := strconv.ParseInt(strings.TrimSpace(pieces[1]), 10, 32)
+	if len(pieces) > 3 {
+		coresStr := strings.TrimSpace(strings.SplitN(pieces[3], ":", 2)[0])
+		cores, err = strconv.ParseInt(coresStr, 10, 32)
 		if err != nil {
-			return 0, 0, fmt.Errorf("error parsing %q in %s: %v", pieces[1], p, err)
+			return 0, 0, newParseError(name, lastNo, "error parsing cores %q: %v", coresStr, err)
 		}
-		cores = c
 	}
 	return cores, iters, nil
 }
 
-func (c *coremarkAnalyzer) analyzeCPU(cloud CloudDetails, machineType string) error {
-	// Find successful Coremark runs (those that have success file)
-	glob := path.Join(cloud.LogDir(), FormatMachineType(machineType), "coremark-results.*/success")
-	goodRuns, err := filepath.Glob(glob)
+// parseCoremarkLogs returns the number of cores and the average number of
+// iterations of coremark logs matching the glob.
+func parseCoremarkLogs(glob string) (int64, float64, error) {
+	runs, err := filepath.Glob(glob)
 	if err != nil {
-		return err
+		return 0, 0, err
+	}
+
+	if len(runs) == 0 {
+		return 0, 0, fmt.Errorf("no coremark logs found")
 	}
 
-	parseLogs := func(glob string) (int64, float64, error) {
-		runs, err := filepath.Glob(glob)
+	var cores int64
+	var totalIters float64
+	for _, run := range runs {
+		nc, iters, err := parseCoremarkLog(run)
 		if err != nil {
 			return 0, 0, err
 		}
-
-		var cores int64
-		var totalIters float64
-		for _, run := range runs {
-			nc, iters, err := parseCoremarkLog(run)
-			if err != nil {
-				return 0, 0, err
-			}
-			if cores == 0 {
-				cores = nc
-			} else if cores != nc {
-				return 0, 0, fmt.Errorf("expected same number of cores (%d), found %d in %q", cores, nc, run)
-			}
-			totalIters += iters
+		if cores == 0 {
+			cores = nc
+		} else if cores != nc {
+			return 0, 0, fmt.Errorf("expected same number of cores (%d), found %d in %q", cores, nc, run)
 		}
-		return cores, totalIters / float64(len(runs)), nil
+		totalIters += iters
+	}
+	return cores, totalIters / float64(len(runs)), nil
+}
+
+func (c *coremarkAnalyzer) analyzeCPU(cloud CloudDetails, machineType string) error {
+	// Find successful Coremark runs (those that have success file)
+	goodRuns, err := filepath.Glob(c.bench.ResultsGlob(cloud, machineType))
+	if err != nil {
+		return err
 	}
 
 	for _, r := range goodRuns {
@@ -379,29 +719,90 @@ func (c *coremarkAnalyzer) analyzeCPU(cloud CloudDetails, machineType string) er
 			return err
 		}
 
-		if res, ok := c.machineResults[machineType]; ok && res.modtime.After(info.ModTime()) {
-			log.Printf("Skipping coremark log %q (already analyzed newer)", r)
+		id, err := newRunID(c.bench, cloud, machineType, r)
+		if err != nil {
+			analyzeDiagnostics.machineError(c.bench, cloud, machineType, r, err)
 			continue
 		}
 
-		_, single, err := parseLogs(path.Join(filepath.Dir(r), "single-*.log"))
+		singleGlob := path.Join(filepath.Dir(r), "single-*.log")
+		_, single, err := parseCoremarkLogs(singleGlob)
 		if err != nil {
-			return err
+			analyzeDiagnostics.runError(id, singleGlob, err)
+			continue
 		}
-		cores, multi, err := parseLogs(path.Join(filepath.Dir(r), "multi-*.log"))
+		multiGlob := path.Join(filepath.Dir(r), "multi-*.log")
+		cores, multi, err := parseCoremarkLogs(multiGlob)
 		if err != nil {
-			return err
+			analyzeDiagnostics.runError(id, multiGlob, err)
+			continue
 		}
-		c.machineResults[machineType] = &coremarkResult{
-			cores:   cores,
-			single:  single,
-			multi:   multi,
-			modtime: info.ModTime(),
+		var vcpus int64
+		if m, err := lookupMachine(cloud.Cloud, machineType); err != nil {
+			analyzeDiagnostics.machineError(c.bench, cloud, machineType, r, err)
+			continue
+		} else if m != nil {
+			vcpus = int64(m.VCPUs)
+			if vcpus != cores {
+				analyzeDiagnostics.runWarning(id, r, "coremark ran on %d cores, %s has %d vCPUs",
+					cores, machineType, vcpus)
+			}
+		}
+		c.mu.Lock()
+		c.runs[runRef{id: id}] = &coremarkResult{
+			group:       cloud.Group,
+			machineType: machineType,
+			run:         runLabel([]runRef{{id: id}}),
+			cores:       cores,
+			vcpus:       vcpus,
+			single:      single,
+			multi:       multi,
+			modtime:     info.ModTime(),
 		}
+		c.mu.Unlock()
 	}
 	return nil
 }
 
+// results returns coremark results of the runs selected by the --runs
+// policy.
+func (c *coremarkAnalyzer) results() []*coremarkResult {
+	return c.resultsOf(groupRuns(c.refs(), analyzeRuns))
+}
+
+func (c *coremarkAnalyzer) refs() []runRef {
+	refs := make([]runRef, 0, len(c.runs))
+	for ref := range c.runs {
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// resultsOf returns a result of every group of runs.  Results of grouped
+// runs are averaged.
+func (c *coremarkAnalyzer) resultsOf(groups [][]runRef) []*coremarkResult {
+	var results []*coremarkResult
+	for _, g := range groups {
+		latest := c.runs[g[len(g)-1]]
+		res := &coremarkResult{
+			group:       latest.group,
+			machineType: latest.machineType,
+			run:         runLabel(g),
+			cores:       latest.cores,
+			vcpus:       latest.vcpus,
+			modtime:     latest.modtime,
+		}
+		for _, ref := range g {
+			res.single += c.runs[ref].single
+			res.multi += c.runs[ref].multi
+		}
+		res.single /= float64(len(g))
+		res.multi /= float64(len(g))
+		results = append(results, res)
+	}
+	return results
+}
+
 func (c *coremarkAnalyzer) Analyze(cloud CloudDetails) error {
 	if cloud.Cloud != c.cloud {
 		return fmt.Errorf("expected %s cloud, got %s", c.cloud, cloud.Cloud)
@@ -413,33 +814,64 @@ func (c *coremarkAnalyzer) Analyze(cloud CloudDetails) error {
 }
 
 func (c *coremarkAnalyzer) Close() (err error) {
-	f, err := os.OpenFile(ResultsFile("cpu.csv", c.cloud), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	wr, err := newResultWriter("cpu", strings.Split(cpuCSVHeader, ","), c.cloud)
 	if err != nil {
-		return
+		return err
 	}
-	defer func() { err = f.Close() }()
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
 
-	fmt.Fprintf(f, "%s\n", cpuCSVHeader)
-	for machineType, res := range c.machineResults {
-		fields := []string{
+	for _, res := range c.results() {
+		var catalogVCPUs interface{}
+		if res.vcpus > 0 {
+			catalogVCPUs = res.vcpus
+		}
+		fields := []interface{}{
 			c.cloud,
-			res.modtime.String(),
-			machineType,
-			fmt.Sprintf("%d", res.cores),
-			fmt.Sprintf("%f", res.single),
-			fmt.Sprintf("%f", res.multi),
-			fmt.Sprintf("%f", res.multi/float64(res.cores)),
+			res.group,
+			res.modtime,
+			res.run,
+			res.machineType,
+			res.cores,
+			res.single,
+			res.multi,
+			res.multiPerVCPU(),
+			catalogVCPUs,
+			coremarkSanity(res).column(),
+		}
+		if err := wr.Write(fields); err != nil {
+			return err
 		}
-		fmt.Fprintf(f, "%s\n", strings.Join(fields, ","))
 	}
 	return nil
 }
 
-const netCSVHeader = "testMode,Cloud,DateTime(Zulu),MachineType,DiskType,ClientRegion,ServerRegion," +
+func (c *coremarkAnalyzer) perfMetrics() []perfMetric {
+	var metrics []perfMetric
+	for _, res := range c.results() {
+		metrics = append(metrics, perfMetric{
+			benchmark:   c.bench.Name,
+			group:       res.group,
+			machineType: res.machineType,
+			metric:      "Multi",
+			unit:        "iterations/s",
+			value:       res.multi,
+			nodes:       1,
+		})
+	}
+	return metrics
+}
+
+var _ pricePerformer = &coremarkAnalyzer{}
+
+const netCSVHeader = "testMode,Cloud,DateTime(Zulu),Run,MachineType,DiskType,ClientRegion,ServerRegion," +
 	"MinThrpt,MeanThrpt,MaxThrpt,ThrptUnit,ExpectedThrpt,#Streams," +
 	"RecvBufferSize(bytes),SendBufferSize(bytes),ThrptTestDuration(seconds),LatTestDuration(seconds)," +
 	"minLat(microseconds),meanLat(microseconds),p90Lat(microseconds),p99Lat(microseconds),maxLat(microseconds)," +
-	"LastStdDev,TxnRate,ThrptTimeSeriesPlotPath"
+	"LastStdDev,TxnRate,ThrptTimeSeriesPlotPath,Sanity"
 
 type networkResult struct {
 	// testMode can be either "cross-region" or "intra-az".
@@ -468,54 +900,108 @@ type networkResult struct {
 	minThroughput      string
 	maxThroughput      string
 	meanThroughput     string
-	dateTime           string
+	dateTime           time.Time
 	recvBufferSize     string
 	sendBufferSize     string
 	timeSeriesPlotPath string
 
-	modtime time.Time
+	run string
+}
+
+// averageNetworkResults averages throughput and latency of repeated netperf
+// runs.  Other values are those of the latest run.
+func averageNetworkResults(runs []*networkResult) *networkResult {
+	avg := *runs[len(runs)-1]
+	if len(runs) == 1 {
+		return &avg
+	}
+	fields := []func(r *networkResult) *string{
+		func(r *networkResult) *string { return &r.minLatencyMicros },
+		func(r *networkResult) *string { return &r.meanLatencyMicros },
+		func(r *networkResult) *string { return &r.latencyMicros_90 },
+		func(r *networkResult) *string { return &r.latencyMicros_99 },
+		func(r *networkResult) *string { return &r.maxLatencyMicros },
+		func(r *networkResult) *string { return &r.latStdDevMicrosec },
+		func(r *networkResult) *string { return &r.txnRate },
+	}
+	sameUnit := true
+	for _, r := range runs {
+		sameUnit = sameUnit && r.throughputUnit == avg.throughputUnit
+	}
+	if sameUnit {
+		fields = append(fields,
+			func(r *networkResult) *string { return &r.minThroughput },
+			func(r *networkResult) *string { return &r.meanThroughput },
+			func(r *networkResult) *string { return &r.maxThroughput },
+		)
+	}
+
+	for _, field := range fields {
+		var sum float64
+		ok := true
+		for _, r := range runs {
+			v, err := strconv.ParseFloat(strings.TrimSpace(*field(r)), 64)
+			if err != nil {
+				ok = false
+				break
+			}
+			sum += v
+		}
+		if ok {
+			*field(&avg) = strconv.FormatFloat(sum/float64(len(runs)), 'f', -1, 64)
+		}
+	}
+	return &avg
 }
 
 type netAnalyzer struct {
-	machineResults map[string]*networkResult
-	cloud          string
-	testMode       string
+	bench    *Benchmark
+	mu       sync.Mutex
+	runs     map[runRef]*networkResult
+	cloud    string
+	testMode string
 }
 
-func newIntraAzNetAnalyzer(cloud string) resultsAnalyzer {
+// netTestModes are the test modes of the network benchmarks.
+var netTestModes = map[string]string{"ia_net": "intra-az", "cr_net": "cross-region"}
+
+func newIntraAzNetAnalyzer(b *Benchmark, cloud string) resultsAnalyzer {
 	return &netAnalyzer{
-		cloud:          cloud,
-		machineResults: make(map[string]*networkResult),
-		testMode:       "intra-az",
+		bench:    b,
+		cloud:    cloud,
+		runs:     make(map[runRef]*networkResult),
+		testMode: netTestModes["ia_net"],
 	}
 }
 
-func newCrossRegionNetAnalyzer(cloud string) resultsAnalyzer {
+func newCrossRegionNetAnalyzer(b *Benchmark, cloud string) resultsAnalyzer {
 	return &netAnalyzer{
-		cloud:          cloud,
-		machineResults: make(map[string]*networkResult),
-		testMode:       "cross-region",
+		bench:    b,
+		cloud:    cloud,
+		runs:     make(map[runRef]*networkResult),
+		testMode: netTestModes["cr_net"],
 	}
 }
 
 func (n *netAnalyzer) Close() (err error) {
-	fileName := fmt.Sprintf("%s-net.csv", n.testMode)
-	f, err := os.OpenFile(ResultsFile(fileName, n.cloud), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	name := fmt.Sprintf("%s-net", n.testMode)
+	wr, err := newResultWriter(name, strings.Split(netCSVHeader, ","), n.cloud)
 	if err != nil {
 		return err
 	}
-	defer func() { err = f.Close() }()
-
-	if _, err := fmt.Fprintf(f, "%s\n", netCSVHeader); err != nil {
-		return fmt.Errorf("cannot write network header to csv: %v", err)
-	}
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
 
-	for machineType, res := range n.machineResults {
-		fields := []string{
+	for _, res := range n.results() {
+		fields := []interface{}{
 			res.testMode,
 			n.cloud,
 			res.dateTime,
-			machineType,
+			res.run,
+			res.machineType,
 			res.diskType,
 			res.clientRegion,
 			res.serverRegion,
@@ -537,33 +1023,94 @@ func (n *netAnalyzer) Close() (err error) {
 			res.latStdDevMicrosec,
 			res.txnRate,
 			res.timeSeriesPlotPath,
+			networkSanity(res).column(),
 		}
-		if _, err := fmt.Fprintf(f, "%s\n", strings.Join(fields, ",")); err != nil {
-			return fmt.Errorf("cannot output fields to the csv \"%s\": %v",
-				fileName,
-				err,
-			)
+		if err := wr.Write(fields); err != nil {
+			return fmt.Errorf("cannot output fields to %s results: %v", name, err)
 		}
 	}
 	return nil
 }
 
+// throughputGbps converts netperf throughput to Gbit/s.
+func throughputGbps(val, unit string) (float64, error) {
+	v, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, err
+	}
+	switch strings.ToLower(unit) {
+	case "gbits/s", "10^9bits/s":
+		return v, nil
+	case "mbits/s", "10^6bits/s":
+		return v / 1e3, nil
+	case "kbits/s", "10^3bits/s":
+		return v / 1e6, nil
+	default:
+		return 0, fmt.Errorf("unknown throughput unit %q", unit)
+	}
+}
+
+// throughputFromGbps converts throughput in Gbit/s to the netperf unit.
+func throughputFromGbps(gbps float64, unit string) (float64, error) {
+	perGbps, err := throughputGbps("1", unit)
+	if err != nil {
+		return 0, err
+	}
+	return gbps / perGbps, nil
+}
+
+// throughputGbps returns the mean throughput of the result in Gbit/s.
+// Results with unknown throughput units are recorded as errors.
+func (n *netAnalyzer) throughputGbps(res *networkResult) (float64, bool) {
+	gbps, err := throughputGbps(res.meanThroughput, res.throughputUnit)
+	if err != nil {
+		analyzeDiagnostics.add(diagnostic{
+			severity:    severityError,
+			cloud:       n.cloud,
+			group:       res.diskType,
+			machineType: res.machineType,
+			benchmark:   n.bench.Name,
+			run:         res.run,
+			message:     fmt.Sprintf("%s throughput: %v", n.testMode, err),
+		})
+		return 0, false
+	}
+	return gbps, true
+}
+
+func (n *netAnalyzer) perfMetrics() []perfMetric {
+	var metrics []perfMetric
+	for _, res := range n.results() {
+		gbps, ok := n.throughputGbps(res)
+		if !ok {
+			continue
+		}
+		metrics = append(metrics, perfMetric{
+			benchmark:   n.bench.Name,
+			group:       res.diskType,
+			machineType: res.machineType,
+			metric:      "MeanThrpt",
+			unit:        "Gbit/s",
+			value:       gbps,
+			nodes:       1,
+		})
+	}
+	return metrics
+}
+
+var _ pricePerformer = &netAnalyzer{}
+
 func (n *netAnalyzer) analyzeNetwork(cloud CloudDetails, machineType string) error {
 	// The file to parse is saved at report-data/20220109/aws/ebs-gp3/logs/c5-2xlarge/cross-region-netperf-results.20220110.07:33:17/cross-region-netperf-results.log
-	logFileName := fmt.Sprintf("%s-netperf-results.*/%s-netperf-results.log", n.testMode, n.testMode)
-	glob := path.Join(cloud.LogDir(), FormatMachineType(machineType), logFileName)
-	goodRuns, err := filepath.Glob(glob)
+	goodRuns, err := filepath.Glob(n.bench.ResultsGlob(cloud, machineType))
 	if err != nil {
 		return err
 	}
 	for _, r := range goodRuns {
 		log.Printf("Analyzing %s", r)
-		info, err := os.Stat(r)
+		id, err := newRunID(n.bench, cloud, machineType, r)
 		if err != nil {
-			return err
-		}
-		if res, ok := n.machineResults[machineType]; ok && res.modtime.After(info.ModTime()) {
-			log.Printf("Skipping network throughput log %q (already analyzed newer", r)
+			analyzeDiagnostics.machineError(n.bench, cloud, machineType, r, err)
 			continue
 		}
 		runs, err := filepath.Glob(path.Join(filepath.Dir(r), "*-netperf-result*"))
@@ -571,21 +1118,54 @@ func (n *netAnalyzer) analyzeNetwork(cloud CloudDetails, machineType string) err
 			return err
 		}
 		if len(runs) != 1 {
-			return fmt.Errorf("unexpected number of netperf runs found. expected 1, found %d", len(runs))
+			analyzeDiagnostics.runError(id, filepath.Dir(r),
+				fmt.Errorf("unexpected number of netperf runs found. expected 1, found %d", len(runs)))
+			continue
 		}
 		run := runs[0]
-		res := &networkResult{
-			modtime: info.ModTime(),
-		}
-		err = parseNetperfLog(run, res, n.cloud)
-		if err != nil {
-			return err
+		res := &networkResult{}
+		if err := parseNetperfLog(run, res, id); err != nil {
+			analyzeDiagnostics.runError(id, run, err)
+			continue
 		}
-		n.machineResults[machineType] = res
+		res.run = runLabel([]runRef{{id: id}})
+		n.mu.Lock()
+		n.runs[runRef{id: id}] = res
+		n.mu.Unlock()
 	}
 	return nil
 }
 
+// results returns netperf results of the runs selected by the --runs
+// policy.
+func (n *netAnalyzer) results() []*networkResult {
+	return n.resultsOf(groupRuns(n.refs(), analyzeRuns))
+}
+
+func (n *netAnalyzer) refs() []runRef {
+	refs := make([]runRef, 0, len(n.runs))
+	for ref := range n.runs {
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// resultsOf returns a result of every group of runs.  Results of grouped
+// runs are averaged.
+func (n *netAnalyzer) resultsOf(groups [][]runRef) []*networkResult {
+	var results []*networkResult
+	for _, g := range groups {
+		runs := make([]*networkResult, len(g))
+		for i, ref := range g {
+			runs[i] = n.runs[ref]
+		}
+		res := averageNetworkResults(runs)
+		res.run = runLabel(g)
+		results = append(results, res)
+	}
+	return results
+}
+
 func (n *netAnalyzer) Analyze(cloud CloudDetails) error {
 	// Sanity check.
 	if cloud.Cloud != n.cloud {
@@ -641,6 +1221,10 @@ func parseNetperfLatency(filePath string, content string, res *networkResult) er
 	return nil
 }
 
+// netperfDateLayouts are layouts of the date command output logged by
+// multistream_netperf.sh, in the C and en_US locales.
+var netperfDateLayouts = []string{time.UnixDate, "Mon 02 Jan 2006 03:04:05 PM MST"}
+
 // parseStartTimeFromLog is to get the starting timestamp of the network test.
 func parseStartTimeFromLog(filePath string, content string, res *networkResult) error {
 	timeRegex := `start multistream_netperf.sh (.+)\*{12}`
@@ -649,17 +1233,53 @@ func parseStartTimeFromLog(filePath string, content string, res *networkResult)
 	if len(timeMatches) < 2 {
 		return fmt.Errorf("%s: can't find target line to get the time, %s", filePath, timeMatches)
 	}
-	timeRes := timeMatches[1:]
-	res.dateTime = timeRes[0]
+	timeRes := strings.TrimSpace(timeMatches[1])
+	for _, layout := range netperfDateLayouts {
+		if t, err := time.Parse(layout, timeRes); err == nil {
+			res.dateTime = t
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: can't parse the time %q", filePath, timeRes)
+}
 
+// parseNetperfResults parses the latency, throughput and start time of the
+// netperf log into res.
+func parseNetperfResults(filePath string, res *networkResult) error {
+	var l cachedNetperfLog
+	if err := analyzeCache.parse(netperfParser, filePath, &l, func() error {
+		b, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("cannot open %s in parseNetperfLog", filePath)
+		}
+
+		content := string(b)
+		var parsed networkResult
+		if err := parseNetperfLatency(filePath, content, &parsed); err != nil {
+			return err
+		}
+		if err := parseNetperfThroughput(filePath, content, &parsed); err != nil {
+			return err
+		}
+		if err := parseStartTimeFromLog(filePath, content, &parsed); err != nil {
+			return err
+		}
+		l = newCachedNetperfLog(&parsed)
+		return nil
+	}); err != nil {
+		return err
+	}
+	l.apply(res)
 	return nil
 }
 
-func parseNetperfLog(filePath string, res *networkResult, cloud string) error {
+func parseNetperfLog(filePath string, res *networkResult, id RunID) error {
 	baseDir := filepath.Dir(filePath)
-	baseDirName := filepath.Base(baseDir)
 	// testMode is either "cross-region" or "intra-az".
-	testMode := strings.Join(strings.Split(baseDirName, "-")[:2], "-")
+	testMode, ok := netTestModes[id.Benchmark]
+	if !ok {
+		return fmt.Errorf("%s is not a network benchmark", id.Benchmark)
+	}
 	res.testMode = testMode
 	svgPath := filepath.Join(baseDir, "netperf_draw_plot_overall.svg")
 
@@ -667,44 +1287,42 @@ func parseNetperfLog(filePath string, res *networkResult, cloud string) error {
 		return fmt.Errorf("svg path for the time series \"%s\" doesn't exists", svgPath)
 	}
 
-	res.timeSeriesPlotPath = filepath.Join(strings.Split(svgPath, "/")[2:]...)
-	splitFilePath := strings.Split(filePath, "/")
+	// The plot path is relative to the report version directory.
+	plotPath, err := filepath.Rel(filepath.Join(baseOutputDir, reportVersion), svgPath)
+	if err != nil {
+		return err
+	}
+	res.timeSeriesPlotPath = plotPath
 
-	res.diskType = splitFilePath[3]
-	res.machineType = splitFilePath[5]
-	// The "unknown" string at the "expectedThroughput" column is a placeholder,
-	// should be manually replaced in the csv with the true expected throughput.
+	res.diskType = id.Group
+	res.machineType = id.MachineType
+	// The "unknown" string at the "expectedThroughput" column is a placeholder
+	// for machine types without the network bandwidth cap in the catalog.
 	res.expectedThroughput = "unknown"
 
-	switch cloud {
-	case "azure":
-		res.clientRegion = "eastus"
-		res.serverRegion = "westus2"
-	case "aws":
-		res.clientRegion = "us-east-1"
-		res.serverRegion = "us-west-2"
-	case "gce":
-		res.clientRegion = "us-east4"
-		res.serverRegion = "us-west1"
+	provider, err := getProvider(id.Cloud)
+	if err != nil {
+		return err
 	}
+	res.clientRegion, res.serverRegion = provider.DefaultRegions()
 
 	res.recvBufferSize = "32000000"
 	res.sendBufferSize = "32000000"
 
-	b, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		return fmt.Errorf("cannot open %s in parseNetperfLog", filePath)
-	}
-
-	content := string(b)
-	if err := parseNetperfLatency(filePath, content, res); err != nil {
+	if err := parseNetperfResults(filePath, res); err != nil {
 		return err
 	}
-	if err := parseNetperfThroughput(filePath, content, res); err != nil {
+
+	m, err := lookupMachine(id.Cloud, id.MachineType)
+	if err != nil {
 		return err
 	}
-	if err := parseStartTimeFromLog(filePath, content, res); err != nil {
-		return err
+	if m != nil && m.NetworkGbps > 0 {
+		expected, err := throughputFromGbps(m.NetworkGbps, res.throughputUnit)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filePath, err)
+		}
+		res.expectedThroughput = strconv.FormatFloat(expected, 'f', -1, 64)
 	}
 	return nil
 }
@@ -720,180 +1338,506 @@ type tpccRun struct {
 	tpmC, efc, avg, p50, p90, p95, p99, pMax float64
 	warehouses                               int64
 	cpus                                     []cpuInfo
+	// txns are latencies of each transaction type, if reported.
+	txns map[string]*tpccTxnStats
 }
 
+// tpccTxnStats are latencies of a TPC-C transaction type in milliseconds.
+type tpccTxnStats struct {
+	avg, p50, p95, p99, pMax float64
+}
+
+// pass returns true if the run passes the default SLA policy.
 func (r *tpccRun) pass() bool {
-	// TPCC run passes if efficiency exceeds 85% and p95 < 10s
-	return r.efc > 85.0 && r.p95 < 10000
+	return defaultSLAPolicy.pass(r)
 }
 
 type tpccResult struct {
 	runs              []*tpccRun
 	modtime           time.Time
+	run               string
 	machine, disktype string
 	warehouses        string
 	warehousePerVCPU  string
 }
 
+// analyzeSLAPolicies are the SLA policies TPC-C runs are evaluated against.
+var analyzeSLAPolicies = []*slaPolicy{defaultSLAPolicy, tpccSpecSLAPolicy}
+
 type tpccAnalyzer struct {
-	machineResults map[string]*tpccResult
-	cloud          string
+	bench *Benchmark
+	mu    sync.Mutex
+	runs  map[runRef]*tpccResult
+	cloud string
+	// searches are the TPC-C capacity searches of the analyzed machine types.
+	searches []*tpccSearchLog
 }
 
-func newTPCCAnalyzer(cloud string) resultsAnalyzer {
+func newTPCCAnalyzer(b *Benchmark, cloud string) resultsAnalyzer {
 	return &tpccAnalyzer{
-		cloud:          cloud,
-		machineResults: make(map[string]*tpccResult),
+		bench: b,
+		cloud: cloud,
+		runs:  make(map[runRef]*tpccResult),
 	}
 }
 
-const tpccCSVHeader = "Cloud,Group,Date,MachineType,Warehouses,warehousePerVCPU,Pass,TpmC,Efc,Avg,P50,P90,P95,P99,PMax"
+// results returns TPC-C results of the runs selected by the --runs policy.
+// Results are never combined: repeated runs of the same configuration are
+// aggregated by writeAggregates.
+func (t *tpccAnalyzer) results() []*tpccResult {
+	policy := analyzeRuns
+	if policy == runsAggregate {
+		policy = runsAll
+	}
+	refs := make([]runRef, 0, len(t.runs))
+	for ref := range t.runs {
+		refs = append(refs, ref)
+	}
+	var results []*tpccResult
+	for _, g := range groupRuns(refs, policy) {
+		for _, ref := range g {
+			results = append(results, t.runs[ref])
+		}
+	}
+	return results
+}
+
+const tpccCSVHeader = "Cloud,Group,Date,Run,MachineType,Warehouses,warehousePerVCPU,Pass,TpmC,Efc,Avg,P50,P90,P95,P99,PMax," +
+	"ActivePerVCPU,Sanity"
 
-func (t *tpccAnalyzer) Close() error {
-	f, err := os.OpenFile(ResultsFile("tpcc.csv", t.cloud), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+func (t *tpccAnalyzer) Close() (err error) {
+	// Each run may have been executed on a different number of machines;
+	// emit enough columns to describe CPUs of all of them.
+	results := t.results()
+	numMachines := 0
+	for _, res := range results {
+		for _, run := range res.runs {
+			if len(run.cpus) > numMachines {
+				numMachines = len(run.cpus)
+			}
+		}
+	}
+	columns := strings.Split(tpccCSVHeader, ",")
+	for _, p := range analyzeSLAPolicies[1:] {
+		columns = append(columns, fmt.Sprintf("Pass(%s)", p.Name))
+	}
+	for i := 0; i < numMachines; i++ {
+		columns = append(columns, fmt.Sprintf("Numa%d", i), fmt.Sprintf("Model%d", i))
+	}
+
+	wr, err := newResultWriter("tpcc", columns, t.cloud)
 	if err != nil {
 		return err
 	}
-	defer func() { err = f.Close() }()
-
-	headerPrinted := false
-	maybePrintHeader := func(numMachines int) {
-		if headerPrinted {
-			return
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
 		}
-		headerPrinted = true
-		header := tpccCSVHeader
-		for i := 0; i < numMachines; i++ {
-			header += fmt.Sprintf(",Numa%d,Model%d", i, i)
+	}()
+
+	// Catalog errors are recorded once per machine type, whose results are
+	// reported without active warehouses per vCPU.
+	catalogErrors := make(map[tpccAggregateKey]bool)
+	for _, res := range results {
+		// Active warehouses per vCPU of a node, as computed by tpcc.sh from
+		// warehousePerVCPU, if the catalog lists the machine type.
+		var activePerVCPU interface{}
+		m, err := lookupMachine(t.cloud, res.machine)
+		if err != nil {
+			k := tpccAggregateKey{group: res.disktype, machine: res.machine}
+			if !catalogErrors[k] {
+				catalogErrors[k] = true
+				analyzeDiagnostics.machineError(t.bench, CloudDetails{Cloud: t.cloud, Group: res.disktype},
+					res.machine, "", err)
+			}
+		} else if m != nil {
+			activePerVCPU = float64(atoiOrZero(res.warehouses)) / float64(m.VCPUs)
 		}
-		fmt.Fprintf(f, "%s\n", header)
-	}
-
-	for _, res := range t.machineResults {
 		for _, run := range res.runs {
-			maybePrintHeader(len(run.cpus))
-
-			fields := []string{
+			fields := []interface{}{
 				t.cloud,
 				res.disktype,
-				res.modtime.String(),
+				res.modtime,
+				res.run,
 				res.machine,
 				res.warehouses,
 				res.warehousePerVCPU,
-				fmt.Sprintf("%t", run.pass()),
-				fmt.Sprintf("%f", run.tpmC),
-				fmt.Sprintf("%f", run.efc),
-				fmt.Sprintf("%f", run.avg),
-				fmt.Sprintf("%f", run.p50),
-				fmt.Sprintf("%f", run.p90),
-				fmt.Sprintf("%f", run.p95),
-				fmt.Sprintf("%f", run.p99),
-				fmt.Sprintf("%f", run.pMax),
+				run.pass(),
+				run.tpmC,
+				run.efc,
+				run.avg,
+				run.p50,
+				run.p90,
+				run.p95,
+				run.p99,
+				run.pMax,
+				activePerVCPU,
+				tpccSanity(res, run).column(),
+			}
+			for _, p := range analyzeSLAPolicies[1:] {
+				fields = append(fields, p.pass(run))
 			}
 			for _, info := range run.cpus {
-				fields = append(fields, fmt.Sprintf("%d", info.numaNodes), info.modelName)
+				fields = append(fields, info.numaNodes, info.modelName)
+			}
+			if err := wr.Write(fields); err != nil {
+				return err
 			}
-			fmt.Fprintf(f, "%s\n", strings.Join(fields, ","))
 		}
 	}
 
-	return nil
+	if err := t.writeAggregates(); err != nil {
+		return err
+	}
+	if err := t.writeSearches(); err != nil {
+		return err
+	}
+	if err := t.writeSLASummary(); err != nil {
+		return err
+	}
+	return t.writeSummary()
 }
 
-func parseCPUInfo(p string) (cpus []cpuInfo, _ error) {
-	cmd := exec.Command("sh", "-c",
-		fmt.Sprintf("grep 'NUMA node(s):' %s | cut -d: -f2", p))
-	out, err := cmd.Output()
-	if err != nil {
-		return nil, errors.Wrapf(err, "parseCPUInfo failed: %s", p)
+// tpccAggregateKey identifies repeated runs of the same TPC-C configuration.
+type tpccAggregateKey struct {
+	group, machine, warehousePerVCPU, warehouses string
+}
+
+// aggregateRuns groups runs by configuration.
+func (t *tpccAnalyzer) aggregateRuns() (keys []tpccAggregateKey, runs map[tpccAggregateKey][]*tpccRun) {
+	runs = make(map[tpccAggregateKey][]*tpccRun)
+	for _, res := range t.results() {
+		k := tpccAggregateKey{
+			group:            res.disktype,
+			machine:          res.machine,
+			warehousePerVCPU: res.warehousePerVCPU,
+			warehouses:       res.warehouses,
+		}
+		if _, ok := runs[k]; !ok {
+			keys = append(keys, k)
+		}
+		runs[k] = append(runs[k], res.runs...)
 	}
-	numas := strings.Split(string(out), "\n")
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		if a.machine != b.machine {
+			return a.machine < b.machine
+		}
+		if a.warehousePerVCPU != b.warehousePerVCPU {
+			return atoiOrZero(a.warehousePerVCPU) < atoiOrZero(b.warehousePerVCPU)
+		}
+		return atoiOrZero(a.warehouses) < atoiOrZero(b.warehouses)
+	})
+	return keys, runs
+}
 
-	cmd = exec.Command("sh", "-c",
-		fmt.Sprintf("grep 'Model name:' %s | cut -d: -f2", p))
-	out, err = cmd.Output()
-	if err != nil {
-		return nil, errors.Wrapf(err, "parseCPUInfo failed")
+func atoiOrZero(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+const tpccAggregateCSVHeader = "Cloud,Group,MachineType,warehousePerVCPU,Warehouses,Runs,Passed,PassRate"
+
+// writeAggregates emits statistics of repeated runs of each configuration.
+func (t *tpccAnalyzer) writeAggregates() (err error) {
+	metrics := []struct {
+		name  string
+		value func(r *tpccRun) float64
+	}{
+		{"TpmC", func(r *tpccRun) float64 { return r.tpmC }},
+		{"Efc", func(r *tpccRun) float64 { return r.efc }},
+		{"P95", func(r *tpccRun) float64 { return r.p95 }},
+		{"P99", func(r *tpccRun) float64 { return r.p99 }},
+	}
+	columns := strings.Split(tpccAggregateCSVHeader, ",")
+	for _, m := range metrics {
+		columns = append(columns, statsColumns(m.name)...)
 	}
-	models := strings.Split(string(out), "\n")
 
-	if len(numas) != len(models) || len(numas) == 0 {
-		return nil, errors.AssertionFailedf("expected matching number of numas and models")
+	wr, err := newResultWriter("tpcc-aggregate", columns, t.cloud)
+	if err != nil {
+		return err
 	}
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
 
-	for i := 0; i < len(numas); i++ {
-		if len(numas[i]) == 0 {
+	keys, aggregates := t.aggregateRuns()
+	for _, k := range keys {
+		runs := aggregates[k]
+		if len(runs) == 0 {
 			continue
 		}
-		n, err := strconv.ParseInt(strings.TrimSpace(numas[i]), 10, 64)
-		if err != nil {
-			return nil, err
+		passed := countPassingRuns(runs)
+		fields := []interface{}{
+			t.cloud,
+			k.group,
+			k.machine,
+			k.warehousePerVCPU,
+			k.warehouses,
+			len(runs),
+			passed,
+			float64(passed) / float64(len(runs)),
+		}
+		for _, m := range metrics {
+			values := make([]float64, len(runs))
+			for i, r := range runs {
+				values[i] = m.value(r)
+			}
+			fields = append(fields, newSummaryStats(values).values()...)
+		}
+		if err := wr.Write(fields); err != nil {
+			return err
 		}
-		cpus = append(cpus, cpuInfo{
-			numaNodes: n,
-			modelName: strings.TrimSpace(models[i]),
-		})
 	}
-	return cpus, nil
+	return nil
 }
 
-func parseTPCCRun(p string) (*tpccRun, error) {
-	// First line:
-	// Initializing XXX connections.
-	// We use (by default) 2 connections per warehouse.
-	cmd := exec.Command("head", "-1", p)
-	out, err := cmd.Output()
-	run := &tpccRun{}
-	run.warehouses, err = strconv.ParseInt(strings.Fields(string(out))[1], 10, 64)
+func countPassingRuns(runs []*tpccRun) int {
+	return defaultSLAPolicy.countPassing(runs)
+}
+
+// tpccMinPassingRuns is the number of passing repeats required for the
+// TPC-C configuration to be considered passing.
+var tpccMinPassingRuns = 1
+
+const tpccSummaryCSVHeader = "Cloud,Group,MachineType," +
+	"MaxPassingWarehouses,MaxPassingWarehousePerVCPU,MaxPassingRuns,MaxPassingPassed,TpmC," +
+	"FirstFailingWarehouses,FirstFailingWarehousePerVCPU,FirstFailingRuns,FirstFailingPassed"
+
+// writeSummary emits the largest passing TPC-C configuration of each machine
+// type, along with the first failing configuration above it.  Configurations
+// pass if at least tpccMinPassingRuns of their runs pass.
+func (t *tpccAnalyzer) writeSummary() (err error) {
+	wr, err := newResultWriter("tpcc-summary", strings.Split(tpccSummaryCSVHeader, ","), t.cloud)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	run.warehouses /= 2
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
 
-	// _elapsed_______tpmC____efc__avg(ms)__p50(ms)__p90(ms)__p95(ms)__p99(ms)_pMax(ms)
-	//  900.0s    30733.3  95.6%    180.8    167.8    369.1    419.4    570.4   1677.7
-	cmd = exec.Command("tail", "-1", p)
-	out, err = cmd.Output()
-	pieces := strings.Fields(string(out))
+	for _, c := range t.capacities() {
+		fields := append([]interface{}{t.cloud, c.group, c.machine}, c.summaryFields(defaultSLAPolicy)...)
+		if err := wr.Write(fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if len(pieces) != 9 {
-		return nil, fmt.Errorf("unexpected number of fields found. expected 7, found: %d: %s", len(pieces), out)
+// summaryFields returns the summary columns of the capacity evaluated
+// against the policy.
+func (c *tpccCapacity) summaryFields(p *slaPolicy) []interface{} {
+	var fields []interface{}
+	if c.maxPassing != nil {
+		fields = append(fields, c.maxPassing.warehouses, c.maxPassing.warehousePerVCPU,
+			len(c.maxPassingRuns), p.countPassing(c.maxPassingRuns), c.tpmC)
+	} else {
+		fields = append(fields, nil, nil, nil, nil, nil)
+	}
+	if c.firstFailing != nil {
+		fields = append(fields, c.firstFailing.warehouses, c.firstFailing.warehousePerVCPU,
+			len(c.firstFailingRuns), p.countPassing(c.firstFailingRuns))
+	} else {
+		fields = append(fields, nil, nil, nil, nil)
 	}
+	return fields
+}
 
-	run.tpmC, err = strconv.ParseFloat(pieces[1], 64)
+const tpccSLASummaryCSVHeader = "Cloud,Group,MachineType,Policy," +
+	"MaxPassingWarehouses,MaxPassingWarehousePerVCPU,MaxPassingRuns,MaxPassingPassed,TpmC," +
+	"FirstFailingWarehouses,FirstFailingWarehousePerVCPU,FirstFailingRuns,FirstFailingPassed"
+
+// writeSLASummary emits the TPC-C capacity of each machine type under each
+// of the SLA policies.
+func (t *tpccAnalyzer) writeSLASummary() (err error) {
+	wr, err := newResultWriter("tpcc-sla-summary", strings.Split(tpccSLASummaryCSVHeader, ","), t.cloud)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error parsing %q in %s", pieces[1], p)
+		return err
 	}
-	// Strip '%'
-	run.efc, err = strconv.ParseFloat(pieces[2][:len(pieces[2])-1], 64)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error parsing %q in %s", pieces[2], p)
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	for _, p := range analyzeSLAPolicies {
+		for _, c := range t.capacitiesOf(p) {
+			fields := append([]interface{}{t.cloud, c.group, c.machine, p.Name}, c.summaryFields(p)...)
+			if err := wr.Write(fields); err != nil {
+				return err
+			}
+		}
 	}
-	run.avg, err = strconv.ParseFloat(pieces[3], 64)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error parsing %q in %s", pieces[3], p)
+	return nil
+}
+
+func (t *tpccAnalyzer) perfMetrics() []perfMetric {
+	var metrics []perfMetric
+	for _, c := range t.capacities() {
+		if c.maxPassing == nil {
+			continue
+		}
+		metrics = append(metrics, perfMetric{
+			benchmark:   t.bench.Name,
+			group:       c.group,
+			machineType: c.machine,
+			metric:      "MaxPassingTpmC",
+			unit:        "tpmC",
+			value:       c.tpmC,
+			nodes:       tpccNodes,
+			storage:     true,
+		})
 	}
-	run.p50, err = strconv.ParseFloat(pieces[4], 64)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error parsing %q in %s", pieces[4], p)
+	return metrics
+}
+
+var _ pricePerformer = &tpccAnalyzer{}
+
+// tpccCapacity describes the largest TPC-C load sustained by a machine type.
+type tpccCapacity struct {
+	group, machine string
+	// maxPassing is the largest passing configuration, if any.
+	maxPassing     *tpccAggregateKey
+	maxPassingRuns []*tpccRun
+	// tpmC is the mean tpmC of passing runs at maxPassing.
+	tpmC float64
+	// firstFailing is the first failing configuration above maxPassing, if any.
+	firstFailing     *tpccAggregateKey
+	firstFailingRuns []*tpccRun
+}
+
+// capacities returns TPC-C capacity of each machine type under the default
+// SLA policy.
+func (t *tpccAnalyzer) capacities() []tpccCapacity {
+	return t.capacitiesOf(defaultSLAPolicy)
+}
+
+// capacitiesOf returns TPC-C capacity of each machine type under the policy.
+func (t *tpccAnalyzer) capacitiesOf(p *slaPolicy) []tpccCapacity {
+	type machineKey struct {
+		group, machine string
+	}
+	var machines []machineKey
+	configs := make(map[machineKey][]tpccAggregateKey)
+	keys, aggregates := t.aggregateRuns()
+	for _, k := range keys {
+		m := machineKey{group: k.group, machine: k.machine}
+		if _, ok := configs[m]; !ok {
+			machines = append(machines, m)
+		}
+		configs[m] = append(configs[m], k)
 	}
-	run.p90, err = strconv.ParseFloat(pieces[5], 64)
-	if err != nil {
-		return nil, errors.Wrapf(err, "error parsing %q in %s", pieces[5], p)
+
+	capacities := make([]tpccCapacity, 0, len(machines))
+	for _, m := range machines {
+		// Order configurations by load.
+		byLoad := configs[m]
+		sort.SliceStable(byLoad, func(i, j int) bool {
+			return atoiOrZero(byLoad[i].warehouses) < atoiOrZero(byLoad[j].warehouses)
+		})
+
+		maxPassing := -1
+		for i, k := range byLoad {
+			if p.countPassing(aggregates[k]) >= tpccMinPassingRuns {
+				maxPassing = i
+			}
+		}
+		firstFailing := -1
+		for i := maxPassing + 1; i < len(byLoad); i++ {
+			if p.countPassing(aggregates[byLoad[i]]) < tpccMinPassingRuns {
+				firstFailing = i
+				break
+			}
+		}
+
+		c := tpccCapacity{group: m.group, machine: m.machine}
+		if maxPassing >= 0 {
+			c.maxPassing = &byLoad[maxPassing]
+			c.maxPassingRuns = aggregates[*c.maxPassing]
+			var tpmC []float64
+			for _, r := range c.maxPassingRuns {
+				if p.pass(r) {
+					tpmC = append(tpmC, r.tpmC)
+				}
+			}
+			c.tpmC = mean(tpmC)
+		}
+		if firstFailing >= 0 {
+			c.firstFailing = &byLoad[firstFailing]
+			c.firstFailingRuns = aggregates[*c.firstFailing]
+		}
+		capacities = append(capacities, c)
 	}
-	run.p95, err = strconv.ParseFloat(pieces[6], 64)
+	return capacities
+}
+
+func parseCPUInfo(p string) ([]cpuInfo, error) {
+	var cached []cachedCPUInfo
+	err := analyzeCache.parse(lscpuParser, p, &cached, func() error {
+		return parseFile(p, func(name string, r io.Reader) error {
+			cpus, err := parseLscpuOutput(name, r)
+			if err != nil {
+				return err
+			}
+			cached = make([]cachedCPUInfo, len(cpus))
+			for i, c := range cpus {
+				cached[i] = cachedCPUInfo{NumaNodes: c.numaNodes, ModelName: c.modelName}
+			}
+			return nil
+		})
+	})
 	if err != nil {
-		return nil, errors.Wrapf(err, "error parsing %q in %s", pieces[6], p)
+		return nil, err
+	}
+	cpus := make([]cpuInfo, len(cached))
+	for i, c := range cached {
+		cpus[i] = cpuInfo{numaNodes: c.NumaNodes, modelName: c.ModelName}
 	}
-	run.p99, err = strconv.ParseFloat(pieces[7], 64)
+	return cpus, nil
+}
+
+// parseLscpuOutput extracts NUMA node count and CPU model name from (possibly
+// concatenated) lscpu output.  Each lscpu section produces one cpuInfo.
+func parseLscpuOutput(name string, r io.Reader) ([]cpuInfo, error) {
+	inventory, err := parseCPUInventory(name, r)
 	if err != nil {
-		return nil, errors.Wrapf(err, "error parsing %q in %s", pieces[7], p)
+		return nil, err
 	}
-	// Last entry has an extra new line
-	run.pMax, err = strconv.ParseFloat(pieces[8][:len(pieces[8])-1], 64)
+	cpus := make([]cpuInfo, len(inventory))
+	for i, c := range inventory {
+		if c.numaNodes == 0 || c.model == "" {
+			return nil, newParseError(name, 0, "expected NUMA node count and model name of every host")
+		}
+		cpus[i] = cpuInfo{numaNodes: c.numaNodes, modelName: c.model}
+	}
+	return cpus, nil
+}
+
+func parseTPCCRun(p string) (*tpccRun, error) {
+	var cached *cachedTPCCRun
+	err := analyzeCache.parse(tpccParser, p, &cached, func() error {
+		return parseFile(p, func(name string, r io.Reader) error {
+			run, err := parseTPCCOutput(name, r)
+			if err != nil {
+				return err
+			}
+			cached = newCachedTPCCRun(run)
+			return nil
+		})
+	})
 	if err != nil {
-		return nil, errors.Wrapf(err, "error parsing %q in %s", pieces[8], p)
+		return nil, err
 	}
+	run := cached.run()
 	cpus, err := parseCPUInfo(filepath.Join(filepath.Dir(p), "cpu_info.txt"))
 	if err != nil {
 		return nil, err
@@ -902,10 +1846,108 @@ func parseTPCCRun(p string) (*tpccRun, error) {
 	return run, nil
 }
 
+// parseTPCCOutput parses output of the "workload run tpcc" command.
+func parseTPCCOutput(name string, r io.Reader) (*tpccRun, error) {
+	var first, last string
+	var lastNo int
+	txns := make(map[string]*tpccTxnStats)
+	inTxns := false
+	if err := scanLines(name, r, func(lineNo int, line string) error {
+		if lineNo == 1 {
+			first = line
+		}
+		if strings.TrimSpace(line) != "" {
+			last, lastNo = line, lineNo
+		}
+
+		// Transaction summaries precede the result:
+		// _elapsed___errors_____ops(total)___ops/sec(cum)__avg(ms)__p50(ms)__p95(ms)__p99(ms)_pMax(ms)__total
+		//   900.0s        0         135813          150.9     38.9     33.6     67.1     88.1    453.0  newOrder
+		if strings.HasPrefix(line, "_elapsed") {
+			inTxns = strings.HasSuffix(line, "__total")
+			return nil
+		}
+		fields := strings.Fields(line)
+		if !inTxns || len(fields) != 10 {
+			inTxns = false
+			return nil
+		}
+		var t tpccTxnStats
+		for i, v := range []*float64{&t.avg, &t.p50, &t.p95, &t.p99, &t.pMax} {
+			var err error
+			if *v, err = strconv.ParseFloat(fields[i+4], 64); err != nil {
+				return newParseError(name, lineNo, "error parsing %q: %v", fields[i+4], err)
+			}
+		}
+		txns[fields[9]] = &t
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// First line:
+	// Initializing XXX connections.
+	// We use (by default) 2 connections per warehouse.
+	fields := strings.Fields(first)
+	if len(fields) < 2 || fields[0] != "Initializing" {
+		return nil, newParseError(name, 1, "expected \"Initializing <n> connections\", found %q", first)
+	}
+	conns, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return nil, newParseError(name, 1, "error parsing connections %q: %v", fields[1], err)
+	}
+	run := &tpccRun{warehouses: conns / 2, txns: txns}
+
+	// _elapsed_______tpmC____efc__avg(ms)__p50(ms)__p90(ms)__p95(ms)__p99(ms)_pMax(ms)
+	//  900.0s    30733.3  95.6%    180.8    167.8    369.1    419.4    570.4   1677.7
+	pieces := strings.Fields(last)
+	if len(pieces) != 9 {
+		return nil, newParseError(name, lastNo,
+			"unexpected number of fields found. expected 9, found %d: %q", len(pieces), last)
+	}
+	pieces[2] = strings.TrimSuffix(pieces[2], "%")
+
+	for i, v := range []*float64{
+		&run.tpmC, &run.efc, &run.avg, &run.p50, &run.p90, &run.p95, &run.p99, &run.pMax,
+	} {
+		if *v, err = strconv.ParseFloat(pieces[i+1], 64); err != nil {
+			return nil, newParseError(name, lastNo, "error parsing %q: %v", pieces[i+1], err)
+		}
+	}
+	return run, nil
+}
+
 type tpccRunKey struct {
 	warehousePerVCPU, runID, warehouses string
 }
 
+var (
+	tpccLabelRegex       = regexp.MustCompile(`^(\d+)-(\d+)$`)
+	tpccResultsFileRegex = regexp.MustCompile(`^tpcc-results-(\d+)\.txt$`)
+)
+
+// tpccRunKeyOf returns the key of the TPC-C run.  TPC-C experiments label
+// runs with <warehousePerVCPU>-<run> NAME_EXTRA, and the warehouse count is
+// recorded in the name of the results file.  Runs of the capacity search are
+// labelled with the probe, and only have the warehouse count.  Directory
+// names of the results are parsed if the run label does not follow the
+// conventions.
+func tpccRunKeyOf(id RunID, filename string) (tpccRunKey, error) {
+	l := tpccLabelRegex.FindStringSubmatch(id.Label)
+	w := tpccResultsFileRegex.FindStringSubmatch(filepath.Base(filename))
+	if s := tpccSearchLabelRegex.FindStringSubmatch(id.Label); s != nil && w != nil {
+		return tpccRunKey{runID: s[2], warehouses: w[1]}, nil
+	}
+	if l == nil || w == nil {
+		return tpccRunKeyFromFileName(filename)
+	}
+	return tpccRunKey{
+		warehousePerVCPU: l[1],
+		runID:            l[2],
+		warehouses:       w[1],
+	}, nil
+}
+
 func tpccRunKeyFromFileName(filename string) (tpccRunKey, error) {
 	// Example path: tpcc-results.20220213.13:38:06-125-4-3/tpcc-results-1000.txt
 	// Extract number warehousePerVCPU per core, run id, and warehouse count.
@@ -922,52 +1964,48 @@ func tpccRunKeyFromFileName(filename string) (tpccRunKey, error) {
 }
 
 func (t *tpccAnalyzer) analyzeTPCC(cloud CloudDetails, machineType string) error {
-	glob := path.Join(cloud.LogDir(), FormatMachineType(machineType), "tpcc-results.*/tpcc-result*.txt")
-	goodRuns, err := filepath.Glob(glob)
+	goodRuns, err := filepath.Glob(t.bench.ResultsGlob(cloud, machineType))
 	if err != nil {
 		return err
 	}
 
-	for i, r := range goodRuns {
+	for _, r := range goodRuns {
 		// Read the tpcc-results
 		log.Printf("Analyzing %s", r)
 		info, err := os.Stat(r)
 		if err != nil {
 			return err
 		}
-		runKey, err := tpccRunKeyFromFileName(r)
+		id, err := newRunID(t.bench, cloud, machineType, r)
 		if err != nil {
-			return errors.Wrapf(err, "cannot analyse tpcc results")
-		}
-		machineKey := fmt.Sprintf("%s-%s-%s-%s-%d", cloud.Group, machineType, runKey.warehouses, runKey.runID, i)
-		if res, ok := t.machineResults[machineKey]; ok && res.modtime.After(info.ModTime()) {
-			log.Printf("Skipping TPC-C throughput log %q (already analyzed newer", r)
+			analyzeDiagnostics.machineError(t.bench, cloud, machineType, r, err)
 			continue
 		}
-		resultsFiles, err := filepath.Glob(path.Join(filepath.Dir(r), "tpcc-result*.txt"))
-
+		runKey, err := tpccRunKeyOf(id, r)
 		if err != nil {
-			return err
+			analyzeDiagnostics.runError(id, r, errors.Wrapf(err, "cannot analyse tpcc results"))
+			continue
 		}
+		// A run may produce results for several warehouse counts.
+		ref := runRef{id: id, variant: runKey.warehousePerVCPU + "-" + runKey.warehouses}
 
 		res := &tpccResult{
 			modtime:          info.ModTime(),
+			run:              runLabel([]runRef{ref}),
 			disktype:         cloud.Group,
 			machine:          machineType,
 			warehouses:       runKey.warehouses,
 			warehousePerVCPU: runKey.warehousePerVCPU,
 		}
-		t.machineResults[machineKey] = res
-
-		for _, f := range resultsFiles {
-			run, err := parseTPCCRun(f)
-			if err != nil {
-				fmt.Errorf("failed to parse tpcc run %s", f)
-				continue
-			}
+		// Runs which cannot be parsed are still reported, without results.
+		if run, err := parseTPCCRun(r); err != nil {
+			analyzeDiagnostics.runError(id, r, err)
+		} else {
 			res.runs = append(res.runs, run)
 		}
-
+		t.mu.Lock()
+		t.runs[ref] = res
+		t.mu.Unlock()
 	}
 	return nil
 }
@@ -979,6 +2017,13 @@ func (t *tpccAnalyzer) Analyze(cloud CloudDetails) error {
 	}
 
 	return forEachMachine(cloud, func(details CloudDetails, machineType string) error {
+		searches, err := tpccSearches(details, machineType)
+		if err != nil {
+			analyzeDiagnostics.machineError(t.bench, details, machineType, "", err)
+		}
+		t.mu.Lock()
+		t.searches = append(t.searches, searches...)
+		t.mu.Unlock()
 		return t.analyzeTPCC(details, machineType)
 	})
 }
@@ -986,38 +2031,91 @@ func (t *tpccAnalyzer) Analyze(cloud CloudDetails) error {
 var _ resultsAnalyzer = &tpccAnalyzer{}
 
 func analyzeResults() error {
-	cpu := newPerCloudAnalyzer(newCoremarkAnalyzer)
-	defer cpu.Close()
+	selected, err := selectBenchmarks(analyzeBenchmarks)
+	if err != nil {
+		return err
+	}
 
-	intraAzNet := newPerCloudAnalyzer(newIntraAzNetAnalyzer)
-	defer intraAzNet.Close()
+	var prices *pricingCatalog
+	if pricingFile != "" {
+		if prices, err = loadPricingCatalog(pricingFile); err != nil {
+			return err
+		}
+	}
 
-	crossRegionNet := newPerCloudAnalyzer(newCrossRegionNetAnalyzer)
-	defer crossRegionNet.Close()
+	analyzers := make([]resultsAnalyzer, len(selected))
+	for i, b := range selected {
+		b := b
+		analyzers[i] = newPerCloudAnalyzer(func(cloud string) resultsAnalyzer {
+			return b.NewAnalyzer(b, cloud)
+		})
+	}
 
-	fio := newPerCloudAnalyzer(newFioAnalyzer)
-	defer fio.Close()
+	analyzeCache = loadParseCache(analyzeRebuild)
 
-	tpcc := newPerCloudAnalyzer(newTPCCAnalyzer)
-	defer tpcc.Close()
+	// Hardware inventory is analyzed regardless of the selected benchmarks.
+	inventory := newPerCloudAnalyzer(newInventoryAnalyzer)
 
-	// Generate scripts.
+	// Errors of an analyzer do not prevent analysis of other results; they
+	// are recorded, along with problems of individual runs, in the errors
+	// table.
 	for _, cloudDetail := range clouds {
-		if err := cpu.Analyze(cloudDetail); err != nil {
-			return err
-		}
-		if err := intraAzNet.Analyze(cloudDetail); err != nil {
-			return fmt.Errorf("intra-az net: %v", err)
-		}
-		if err := crossRegionNet.Analyze(cloudDetail); err != nil {
-			return fmt.Errorf("cross-region net: %v", err)
+		for i, a := range analyzers {
+			if err := a.Analyze(cloudDetail); err != nil {
+				analyzeDiagnostics.add(diagnostic{
+					severity:  severityError,
+					cloud:     cloudDetail.Cloud,
+					group:     cloudDetail.Group,
+					benchmark: selected[i].Name,
+					message:   err.Error(),
+				})
+			}
 		}
-		if err := fio.Analyze(cloudDetail); err != nil {
-			return err
+		if err := inventory.Analyze(cloudDetail); err != nil {
+			analyzeDiagnostics.add(diagnostic{
+				severity:  severityWarning,
+				cloud:     cloudDetail.Cloud,
+				group:     cloudDetail.Group,
+				benchmark: "inventory",
+				message:   err.Error(),
+			})
 		}
-		if err := tpcc.Analyze(cloudDetail); err != nil {
-			return err
+	}
+	// Results tables are written when analyzers are closed, and by the
+	// tables joining results of all analyzers.  Failures to write them are
+	// recorded, and diagnostics are written last.
+	writeFailed := func(table string, err error) {
+		if err != nil {
+			analyzeDiagnostics.add(diagnostic{
+				severity:  severityError,
+				benchmark: table,
+				message:   fmt.Sprintf("failed to write results: %v", err),
+			})
 		}
 	}
+	for i, a := range analyzers {
+		writeFailed(selected[i].Name, a.Close())
+	}
+	// The inventory records diagnostics when closed.
+	writeFailed("inventory", inventory.Close())
+	writeFailed("scorecard", writeScorecard(analyzers))
+	writeFailed("sanity", writeSanity(analyzers))
+	if prices != nil {
+		writeFailed("price-performance", writePricePerformance(prices, analyzers))
+	}
+	if err := analyzeCache.save(); err != nil {
+		return fmt.Errorf("cannot save parse cache: %v", err)
+	}
+	if err := analyzeDiagnostics.write(); err != nil {
+		return err
+	}
+	numErrors := analyzeDiagnostics.count(severityError)
+	if n := numErrors + analyzeDiagnostics.count(severityWarning); n > 0 {
+		log.Printf("%d errors and %d warnings recorded in %s", numErrors, n-numErrors,
+			filepath.Dir(ResultsFile("errors")))
+	}
+	if analyzeStrict && numErrors > 0 {
+		return fmt.Errorf("%d errors recorded while analyzing results", numErrors)
+	}
 	return nil
 }
@@ -0,0 +1,366 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// copyTestdata creates the directory with files copied from testdata,
+// keyed by name.
+func copyTestdata(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range files {
+		b, err := ioutil.ReadFile(filepath.Join("testdata", src))
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, name), b, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// coremarkTestdata are the files of a coremark run.
+var coremarkTestdata = map[string]string{
+	"single-1.log": "coremark/single.log", "multi-1.log": "coremark/multi.log", "success": "coremark/empty.log",
+}
+
+// newAnalyzeTest sets up analysis of a coremark run in a temporary report.
+func newAnalyzeTest(t *testing.T) (dir string, cleanup func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "analyze-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedOutputDir, savedVersion, savedClouds := baseOutputDir, reportVersion, clouds
+	savedBenchmarks, savedFormats, savedStrict := analyzeBenchmarks, outputFormats, analyzeStrict
+	savedDiagnostics, savedCache, savedCatalog := analyzeDiagnostics, analyzeCache, catalog
+	savedCatalogFile, savedPricingFile := machineCatalogFile, pricingFile
+	cleanup = func() {
+		baseOutputDir, reportVersion, clouds = savedOutputDir, savedVersion, savedClouds
+		analyzeBenchmarks, outputFormats, analyzeStrict = savedBenchmarks, savedFormats, savedStrict
+		analyzeDiagnostics, analyzeCache, catalog = savedDiagnostics, savedCache, savedCatalog
+		machineCatalogFile, pricingFile = savedCatalogFile, savedPricingFile
+		os.RemoveAll(dir)
+	}
+	baseOutputDir, reportVersion = dir, "20220101"
+	analyzeBenchmarks, outputFormats, analyzeStrict = []string{"cpu"}, []string{"csv"}, true
+	analyzeDiagnostics, catalog = &diagnosticsCollector{}, &machineCatalog{}
+	pricingFile = ""
+	cloud := CloudDetails{
+		Cloud:        "gce",
+		Group:        "pd-ssd",
+		MachineTypes: map[string]machineConfig{"n2-standard-8": {}},
+	}
+	clouds = []CloudDetails{cloud}
+
+	run := filepath.Join(cloud.LogDir(), "n2-standard-8", "coremark-results.20220101.10:00:00-ori")
+	copyTestdata(t, run, coremarkTestdata)
+	return dir, cleanup
+}
+
+// checkAnalyzeErrors verifies that analyze fails under --strict, and that
+// the errors table records the error.
+func checkAnalyzeErrors(t *testing.T, msg string) {
+	t.Helper()
+	err := analyzeResults()
+	if err == nil || !strings.Contains(err.Error(), "1 errors recorded") {
+		t.Errorf("expected strict analyze to fail, got %v", err)
+	}
+	errors, err := ioutil.ReadFile(ResultsFile("errors.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(errors), msg) {
+		t.Errorf("expected error %q, found:\n%s", msg, errors)
+	}
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		_, cleanup := newAnalyzeTest(t)
+		defer cleanup()
+		if err := analyzeResults(); err != nil {
+			t.Fatal(err)
+		}
+		cpu, err := ioutil.ReadFile(ResultsFile("cpu.csv", "gce"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(cpu), "n2-standard-8") {
+			t.Errorf("expected n2-standard-8 results, found:\n%s", cpu)
+		}
+	})
+
+	t.Run("catalog", func(t *testing.T) {
+		dir, cleanup := newAnalyzeTest(t)
+		defer cleanup()
+		machineCatalogFile, catalog = filepath.Join(dir, "machines.json"), nil
+		if err := ioutil.WriteFile(machineCatalogFile, []byte("{"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// The error is recorded against the run, rather than aborting the
+		// analysis of the machine type.
+		checkAnalyzeErrors(t, "coremark-results.20220101.10:00:00-ori/success")
+	})
+
+	t.Run("tpcc catalog", func(t *testing.T) {
+		dir, cleanup := newAnalyzeTest(t)
+		defer cleanup()
+		analyzeBenchmarks = []string{"tpcc"}
+		run := filepath.Join(clouds[0].LogDir(), "n2-standard-8", "tpcc-results.20220101.11:00:00-125-1")
+		copyTestdata(t, run, map[string]string{
+			"tpcc-results-1000.txt": "tpcc/results.txt", "cpu_info.txt": "cpu_info/single-host.txt",
+		})
+		machineCatalogFile, catalog = filepath.Join(dir, "machines.json"), nil
+		if err := ioutil.WriteFile(machineCatalogFile, []byte("{"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		checkAnalyzeErrors(t, "machines.json")
+		// Results are reported without active warehouses per vCPU.
+		for _, table := range []string{"tpcc", "tpcc-aggregate", "tpcc-summary", "tpcc-sla-summary"} {
+			b, err := ioutil.ReadFile(ResultsFile(table+".csv", "gce"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), "n2-standard-8") {
+				t.Errorf("%s: expected n2-standard-8 results, found:\n%s", table, b)
+			}
+		}
+	})
+
+	t.Run("pricing", func(t *testing.T) {
+		dir, cleanup := newAnalyzeTest(t)
+		defer cleanup()
+		pricingFile = filepath.Join(dir, "pricing.json")
+		if err := ioutil.WriteFile(pricingFile, []byte(`{"currency": "USD", "machines": [
+			{"cloud": "gce", "region": "us-east4", "machineType": "n2-standard-4", "onDemand": 0.2}]}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		checkAnalyzeErrors(t, "no price for machine type n2-standard-8 in us-east4; cpu Multi not reported")
+	})
+
+	t.Run("scorecard", func(t *testing.T) {
+		_, cleanup := newAnalyzeTest(t)
+		defer cleanup()
+		// The scorecard, written after the results of analyzers, cannot be
+		// created.
+		if err := os.MkdirAll(ResultsFile("scorecard.csv", "gce"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		checkAnalyzeErrors(t, "scorecard,,,failed to write results")
+	})
+
+	t.Run("close", func(t *testing.T) {
+		_, cleanup := newAnalyzeTest(t)
+		defer cleanup()
+		// The results table cannot be created.
+		if err := os.MkdirAll(ResultsFile("cpu.csv", "gce"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		checkAnalyzeErrors(t, "failed to write results")
+	})
+}
+
+// readResultFiles returns the contents of result files, keyed by their path
+// relative to the results directory.
+func readResultFiles(t *testing.T) map[string][]byte {
+	t.Helper()
+	dir := filepath.Join(baseOutputDir, reportVersion, "results")
+	files := make(map[string][]byte)
+	if err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[rel] = b
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// TestAnalyzeParallelism verifies that results do not depend on the
+// number of machine types analyzed concurrently.
+func TestAnalyzeParallelism(t *testing.T) {
+	dir, cleanup := newAnalyzeTest(t)
+	defer cleanup()
+	savedParallelism, savedRebuild := analyzeParallelism, analyzeRebuild
+	defer func() { analyzeParallelism, analyzeRebuild = savedParallelism, savedRebuild }()
+	analyzeBenchmarks, analyzeStrict, analyzeRebuild = nil, false, true
+	outputFormats = []string{"csv", "json", "markdown"}
+
+	machineTypes := []string{"n2-standard-4", "n2-standard-8", "n2-standard-16", "n2-highcpu-32"}
+	for _, cloud := range []CloudDetails{
+		{Cloud: "gce", Group: "pd-ssd"}, {Cloud: "gce", Group: "pd-balanced"},
+	} {
+		cloud.MachineTypes = make(map[string]machineConfig)
+		for _, m := range machineTypes {
+			cloud.MachineTypes[m] = machineConfig{}
+			logs := filepath.Join(cloud.LogDir(), m)
+			copyTestdata(t, filepath.Join(logs, "coremark-results.20220101.10:00:00-ori"), coremarkTestdata)
+			copyTestdata(t, filepath.Join(logs, "fio-results.20220101.10:10:00"), map[string]string{
+				"fio-results.json": "fio/fio-results.json", "success": "coremark/empty.log",
+			})
+			copyTestdata(t, filepath.Join(logs, "tpcc-results.20220101.11:00:00-125-1"), map[string]string{
+				"tpcc-results-1000.txt": "tpcc/results.txt", "cpu_info.txt": "cpu_info/single-host.txt",
+			})
+			for _, mode := range []string{"intra-az", "cross-region"} {
+				copyTestdata(t, filepath.Join(logs, mode+"-netperf-results.20220101.12:00:00"), map[string]string{
+					mode + "-netperf-results.log":   "netperf/netperf-results.log",
+					"netperf_draw_plot_overall.svg": "coremark/empty.log",
+				})
+			}
+			// Runs without results are recorded in the errors table.
+			copyTestdata(t, filepath.Join(logs, "fio-results.20220102.10:10:00"), map[string]string{
+				"success": "coremark/empty.log",
+			})
+		}
+		if cloud.Group == "pd-ssd" {
+			clouds[0] = cloud
+		} else {
+			clouds = append(clouds, cloud)
+		}
+	}
+
+	var results []map[string][]byte
+	for _, parallelism := range []int{1, 8} {
+		analyzeParallelism, analyzeDiagnostics = parallelism, &diagnosticsCollector{}
+		if err := os.RemoveAll(filepath.Join(dir, reportVersion, "results")); err != nil {
+			t.Fatal(err)
+		}
+		if err := analyzeResults(); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, readResultFiles(t))
+	}
+	if len(results[0]) < 10 {
+		t.Fatalf("expected results of every benchmark, got %d files", len(results[0]))
+	}
+	for name, b := range results[0] {
+		if !bytes.Equal(b, results[1][name]) {
+			t.Errorf("%s: results differ with parallelism 1 and 8:\n%s\n%s", name, b, results[1][name])
+		}
+	}
+	for name := range results[1] {
+		if _, ok := results[0][name]; !ok {
+			t.Errorf("%s: only written with parallelism 8", name)
+		}
+	}
+}
+
+func TestTPCCCapacities(t *testing.T) {
+	savedRuns, savedMinPassing := analyzeRuns, tpccMinPassingRuns
+	defer func() { analyzeRuns, tpccMinPassingRuns = savedRuns, savedMinPassing }()
+	analyzeRuns = runsLatest
+
+	pass := func(tpmC float64) *tpccRun { return &tpccRun{tpmC: tpmC, efc: 95, p95: 100} }
+	fail := func(tpmC float64) *tpccRun { return &tpccRun{tpmC: tpmC, efc: 50, p95: 100} }
+	ta := &tpccAnalyzer{runs: make(map[runRef]*tpccResult)}
+	// addRun adds the run of the warehouses, labelled with the load per
+	// vCPU of the machine type and the run number.
+	addRun := func(machine string, vcpus, warehouses, run int, r *tpccRun) {
+		load := strconv.Itoa(warehouses / vcpus)
+		id := RunID{
+			Cloud: "gce", Group: "pd-ssd", MachineType: machine, Benchmark: "tpcc",
+			Label: fmt.Sprintf("%s-%d", load, run), Timestamp: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+		ta.runs[runRef{id: id}] = &tpccResult{
+			runs: []*tpccRun{r}, machine: machine, disktype: "pd-ssd",
+			warehouses: strconv.Itoa(warehouses), warehousePerVCPU: load,
+		}
+	}
+	addRun("n2-standard-8", 8, 1000, 1, pass(12000))
+	addRun("n2-standard-8", 8, 1000, 2, pass(12400))
+	addRun("n2-standard-8", 8, 2000, 1, pass(24000))
+	addRun("n2-standard-8", 8, 2000, 2, fail(20000))
+	addRun("n2-standard-8", 8, 3000, 1, fail(30000))
+	addRun("n2-standard-8", 8, 3000, 2, fail(30000))
+	// Loads passing above a failing one raise the capacity.
+	addRun("n2-standard-8", 8, 4000, 1, pass(48000))
+	addRun("n2-standard-8", 8, 4000, 2, fail(40000))
+	addRun("n2-standard-16", 16, 2000, 1, pass(24000))
+
+	// describe describes the capacities as "<machine type> <max passing
+	// warehouses>/<runs>/<tpmC> <first failing warehouses>/<runs>".
+	describe := func(capacities []tpccCapacity) []string {
+		var got []string
+		for _, c := range capacities {
+			s := c.machine
+			if c.maxPassing != nil {
+				s += fmt.Sprintf(" %s/%d/%g", c.maxPassing.warehouses, len(c.maxPassingRuns), c.tpmC)
+			} else {
+				s += " -"
+			}
+			if c.firstFailing != nil {
+				s += fmt.Sprintf(" %s/%d", c.firstFailing.warehouses, len(c.firstFailingRuns))
+			} else {
+				s += " -"
+			}
+			got = append(got, s)
+		}
+		return got
+	}
+	for _, tc := range []struct {
+		name       string
+		policy     *slaPolicy
+		minPassing int
+		want       []string
+	}{
+		{
+			// The tpmC is the mean of passing runs only.
+			name:       "default",
+			policy:     defaultSLAPolicy,
+			minPassing: 1,
+			want:       []string{"n2-standard-16 2000/1/24000 -", "n2-standard-8 4000/2/48000 -"},
+		},
+		{
+			name:       "min passing",
+			policy:     defaultSLAPolicy,
+			minPassing: 2,
+			want:       []string{"n2-standard-16 - 2000/1", "n2-standard-8 1000/2/12200 2000/2"},
+		},
+		{
+			// Runs without per transaction statistics do not pass.
+			name:       "tpcc-spec",
+			policy:     tpccSpecSLAPolicy,
+			minPassing: 1,
+			want:       []string{"n2-standard-16 - 2000/1", "n2-standard-8 - 1000/2"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tpccMinPassingRuns = tc.minPassing
+			if got := describe(ta.capacitiesOf(tc.policy)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Benchmark describes a benchmark: how the driver executes it, where its
+// results are stored, and how those results are analyzed.
+type Benchmark struct {
+	// Name is the workload name, as specified via driver -w flag.
+	Name string
+	// Description is shown in the driver usage.
+	Description string
+	// Function is the suffix of the bench_<Function> and
+	// fetch_bench_<Function>_results driver functions.
+	Function string
+	// Script is the script executing the benchmark on the cluster.
+	Script string
+	// ResultsDir is the directory containing benchmark results on the node.
+	// Fetched results are stored in the log directory under
+	// <ResultsDir>.<date>-<NAME_EXTRA>.
+	ResultsDir string
+	// SuccessMarker is the file (or glob) in the results directory that
+	// is present if the run produced usable results.
+	SuccessMarker string
+	// BenchArgsKey is the benchArgs key with additional benchmark arguments.
+	BenchArgsKey string
+	// ArgsFlag is the driver flag overriding additional benchmark arguments.
+	ArgsFlag string
+	// ArgsDescription describes ArgsFlag in the driver usage.
+	ArgsDescription string
+	// InAll is set if the benchmark is executed by "-w all".
+	InAll bool
+	// NewAnalyzer returns analyzer for the benchmark results.
+	NewAnalyzer func(b *Benchmark, cloud string) resultsAnalyzer
+	// CheckRun returns an error if results of the successful run in the
+	// directory cannot be used.
+	CheckRun func(b *Benchmark, id RunID, dir string) error
+
+	// bench and fetch implement the benchmark lifecycle for the run command.
+	bench, fetch func(r *runner, ctx context.Context, b *Benchmark) error
+}
+
+// ResultsGlob returns glob matching success markers of all runs of the
+// benchmark on the machine type.
+func (b *Benchmark) ResultsGlob(cloud CloudDetails, machineType string) string {
+	return path.Join(cloud.LogDir(), FormatMachineType(machineType), b.ResultsDir+".*", b.SuccessMarker)
+}
+
+// benchmarks is the list of registered benchmarks, in the order they are
+// executed by the driver.
+var benchmarks []*Benchmark
+
+func registerBenchmark(b *Benchmark) {
+	if getBenchmark(b.Name) != nil {
+		panic(fmt.Sprintf("benchmark %s already registered", b.Name))
+	}
+	benchmarks = append(benchmarks, b)
+}
+
+func getBenchmark(name string) *Benchmark {
+	for _, b := range benchmarks {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+func benchmarkNames() []string {
+	names := make([]string, len(benchmarks))
+	for i, b := range benchmarks {
+		names[i] = b.Name
+	}
+	return names
+}
+
+// selectBenchmarks returns benchmarks with the specified names, preserving
+// registration order.  All benchmarks are returned if no names specified.
+func selectBenchmarks(names []string) ([]*Benchmark, error) {
+	if len(names) == 0 || containsString(names, "all") {
+		return benchmarks, nil
+	}
+	for _, name := range names {
+		if getBenchmark(name) == nil {
+			return nil, fmt.Errorf("unknown benchmark %q; expected one of %s",
+				name, strings.Join(benchmarkNames(), ", "))
+		}
+	}
+	var selected []*Benchmark
+	for _, b := range benchmarks {
+		if containsString(names, b.Name) {
+			selected = append(selected, b)
+		}
+	}
+	return selected, nil
+}
+
+// benchArgsKeys returns benchArgs keys consumed by the benchmarks, and by
+// the TPC-C sweep planner.
+func benchArgsKeys() []string {
+	keys := make([]string, len(benchmarks), len(benchmarks)+1)
+	for i, b := range benchmarks {
+		keys[i] = b.BenchArgsKey
+	}
+	return append(keys, sweepBenchArgsKey)
+}
+
+func init() {
+	registerBenchmark(&Benchmark{
+		Name:            "cpu",
+		Description:     "Benchmark CPU",
+		Function:        "cpu",
+		Script:          "./scripts/gen/cpu.sh",
+		ResultsDir:      "coremark-results",
+		SuccessMarker:   "success",
+		BenchArgsKey:    "cpu",
+		ArgsFlag:        "C",
+		ArgsDescription: "additional CPU benchmark arguments",
+		InAll:           true,
+		NewAnalyzer:     newCoremarkAnalyzer,
+		CheckRun:        checkCoremarkRun,
+		bench:           (*runner).benchCPU,
+		fetch:           (*runner).fetchCPUResults,
+	})
+	registerBenchmark(&Benchmark{
+		Name:            "io",
+		Description:     "Benchmark IO",
+		Function:        "io",
+		Script:          "./scripts/gen/fio.sh",
+		ResultsDir:      "fio-results",
+		SuccessMarker:   "success",
+		BenchArgsKey:    "io",
+		ArgsFlag:        "I",
+		ArgsDescription: "additional IO benchmark arguments",
+		InAll:           true,
+		NewAnalyzer:     newFioAnalyzer,
+		CheckRun:        checkFioRun,
+		bench:           (*runner).benchIO,
+		fetch:           (*runner).fetchIOResults,
+	})
+	registerBenchmark(&Benchmark{
+		Name:            "tpcc",
+		Description:     "Benchmark TPCC",
+		Function:        "tpcc",
+		Script:          "./scripts/gen/tpcc.sh",
+		ResultsDir:      "tpcc-results",
+		SuccessMarker:   "tpcc-result*.txt",
+		BenchArgsKey:    "tpcc",
+		ArgsFlag:        "T",
+		ArgsDescription: "additional TPCC benchmark arguments",
+		InAll:           true,
+		NewAnalyzer:     newTPCCAnalyzer,
+		CheckRun:        checkTPCCRun,
+		bench:           (*runner).benchTPCC,
+		fetch:           (*runner).fetchTPCCResults,
+	})
+	registerBenchmark(&Benchmark{
+		Name:            "ia_net",
+		Description:     `Benchmark Net. Please don't run "ia_net" and "cr_net" on the same cluster.`,
+		Function:        "intra_az_net",
+		Script:          "./scripts/gen/network-test.sh",
+		ResultsDir:      "intra-az-netperf-results",
+		SuccessMarker:   "intra-az-netperf-results.log",
+		BenchArgsKey:    "net",
+		ArgsFlag:        "N",
+		ArgsDescription: "additional network benchmark arguments",
+		NewAnalyzer:     newIntraAzNetAnalyzer,
+		CheckRun:        checkNetRun,
+		bench:           (*runner).benchIntraAzNet,
+		fetch:           (*runner).fetchIntraAzNetResults,
+	})
+	registerBenchmark(&Benchmark{
+		Name:            "cr_net",
+		Description:     `Benchmark Cross-region Net. Please don't run "ia_net" and "cr_net" on the same cluster.`,
+		Function:        "cross_region_net",
+		Script:          "./scripts/gen/network-test.sh",
+		ResultsDir:      "cross-region-netperf-results",
+		SuccessMarker:   "cross-region-netperf-results.log",
+		BenchArgsKey:    "cross_region_net",
+		ArgsFlag:        "R",
+		ArgsDescription: "additional cross-region network benchmark arguments",
+		InAll:           true,
+		NewAnalyzer:     newCrossRegionNetAnalyzer,
+		CheckRun:        checkNetRun,
+		bench:           (*runner).benchCrossRegionNet,
+		fetch:           (*runner).fetchCrossRegionNetResults,
+	})
+}
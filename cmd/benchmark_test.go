@@ -0,0 +1,124 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestBenchmarkRegistry verifies that registered benchmarks are complete,
+// and do not share the driver flags, functions or results directories.
+func TestBenchmarkRegistry(t *testing.T) {
+	if want := []string{"cpu", "io", "tpcc", "ia_net", "cr_net"}; !reflect.DeepEqual(benchmarkNames(), want) {
+		t.Errorf("expected benchmarks %q, got %q", want, benchmarkNames())
+	}
+	seen := make(map[string]string)
+	unique := func(b *Benchmark, kind, value string) {
+		t.Helper()
+		if value == "" {
+			t.Errorf("%s: %s is not specified", b.Name, kind)
+			return
+		}
+		if other, ok := seen[kind+" "+value]; ok {
+			t.Errorf("%s: %s %s is also used by %s", b.Name, kind, value, other)
+		}
+		seen[kind+" "+value] = b.Name
+	}
+	for _, b := range benchmarks {
+		unique(b, "function", b.Function)
+		unique(b, "results directory", b.ResultsDir)
+		unique(b, "bench args key", b.BenchArgsKey)
+		unique(b, "args flag", b.ArgsFlag)
+		if b.Description == "" || b.Script == "" || b.SuccessMarker == "" || b.ArgsDescription == "" {
+			t.Errorf("%s: incomplete description %+v", b.Name, b)
+		}
+		if b.NewAnalyzer == nil || b.CheckRun == nil || b.bench == nil || b.fetch == nil {
+			t.Errorf("%s: missing analyzer, run check or run functions", b.Name)
+		}
+		if getBenchmark(b.Name) != b {
+			t.Errorf("%s: getBenchmark returned another benchmark", b.Name)
+		}
+	}
+	if getBenchmark("all") != nil {
+		t.Errorf("expected no benchmark named all")
+	}
+	if keys := benchArgsKeys(); keys[len(keys)-1] != sweepBenchArgsKey {
+		t.Errorf("expected the sweep bench args key, got %q", keys)
+	}
+
+	cloud := CloudDetails{Cloud: "gce", Group: "pd-ssd"}
+	if g := getBenchmark("io").ResultsGlob(cloud, "m5.xlarge"); !strings.HasSuffix(g, "/logs/m5-xlarge/fio-results.*/success") {
+		t.Errorf("unexpected results glob %s", g)
+	}
+}
+
+func TestRegisterBenchmark(t *testing.T) {
+	saved := benchmarks
+	defer func() { benchmarks = saved }()
+	benchmarks = append([]*Benchmark(nil), saved...)
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "benchmark cpu already registered") {
+			t.Errorf("expected duplicate registration to panic, got %v", r)
+		}
+	}()
+	registerBenchmark(&Benchmark{Name: "cpu"})
+}
+
+func TestSelectBenchmarks(t *testing.T) {
+	for _, tc := range []struct {
+		names []string
+		want  []string
+		err   string
+	}{
+		{want: benchmarkNames()},
+		{names: []string{"all"}, want: benchmarkNames()},
+		{names: []string{"io", "all"}, want: benchmarkNames()},
+		// Registration order is preserved.
+		{names: []string{"cr_net", "cpu"}, want: []string{"cpu", "cr_net"}},
+		{names: []string{"tpcc", "tpcc"}, want: []string{"tpcc"}},
+		{names: []string{"cpu", "disk"}, err: `unknown benchmark "disk"; expected one of cpu, io, tpcc, ia_net, cr_net`},
+	} {
+		selected, err := selectBenchmarks(tc.names)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%q: expected error %q, got %v", tc.names, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.names, err)
+			continue
+		}
+		var got []string
+		for _, b := range selected {
+			got = append(got, b.Name)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: expected %q, got %q", tc.names, tc.want, got)
+		}
+	}
+
+	// The intra-AZ network benchmark cannot share the cluster with the
+	// cross-region one, and is not executed by "-w all".
+	selected, err := benchmarksOrInAll(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, b := range selected {
+		got = append(got, b.Name)
+	}
+	if want := []string{"cpu", "io", "tpcc", "cr_net"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected benchmarks of all %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var analyzeRebuild bool
+
+func init() {
+	analyzeCmd.Flags().BoolVar(&analyzeRebuild, "rebuild", false,
+		"discard the parse cache and parse all logs")
+}
+
+// parser identifies a cached parser.  The version must be incremented
+// whenever the parser, or the cached representation of its results,
+// changes; entries of other versions are ignored.  TestParserVersions
+// fails if the parsed values of testdata change without a version bump.
+type parser struct {
+	name    string
+	version int
+}
+
+var (
+	fioParser      = parser{name: "fio", version: 1}
+	coremarkParser = parser{name: "coremark", version: 1}
+	netperfParser  = parser{name: "netperf", version: 2}
+	tpccParser     = parser{name: "tpcc", version: 1}
+	lscpuParser    = parser{name: "lscpu", version: 1}
+)
+
+// parseCacheFile is the name of the parse cache in the report version
+// directory.
+const parseCacheFile = "parse-cache.json"
+
+// parseCacheFormat is the version of the layout of the cache file.
+const parseCacheFormat = 1
+
+// parseCacheEntry is the parsed value of a file.  The entry is valid while
+// the size and modification time of the file and the version of the parser
+// are unchanged.
+type parseCacheEntry struct {
+	Size    int64           `json:"size"`
+	ModTime time.Time       `json:"modTime"`
+	Version int             `json:"version"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// parseCache stores results of parsing log files, so that analyze only
+// parses new and modified files.  Entries are keyed by parser and path of
+// the file, relative to the report version directory.
+type parseCache struct {
+	path string
+	dir  string
+
+	mu      sync.Mutex
+	entries map[string]*parseCacheEntry
+	hits    int
+	misses  int
+}
+
+// analyzeCache is the parse cache of the analyze command; nil when parsing
+// without the cache.
+var analyzeCache *parseCache
+
+// loadParseCache loads the parse cache of the report version.  The cache is
+// empty if it does not exist, cannot be read or rebuild is set.
+func loadParseCache(rebuild bool) *parseCache {
+	dir := path.Join(baseOutputDir, reportVersion)
+	c := &parseCache{
+		path:    path.Join(dir, parseCacheFile),
+		dir:     dir,
+		entries: make(map[string]*parseCacheEntry),
+	}
+	if rebuild {
+		return c
+	}
+	data, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("ignoring parse cache: %v", err)
+		}
+		return c
+	}
+	var file struct {
+		Format  int                         `json:"format"`
+		Entries map[string]*parseCacheEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		log.Printf("ignoring parse cache %s: %v", c.path, err)
+		return c
+	}
+	if file.Format == parseCacheFormat && file.Entries != nil {
+		c.entries = file.Entries
+	}
+	return c
+}
+
+func (c *parseCache) key(p parser, file string) string {
+	if rel, err := filepath.Rel(c.dir, file); err == nil {
+		file = rel
+	}
+	return p.name + ":" + filepath.ToSlash(file)
+}
+
+// parse stores the value parsed from the file into v, a pointer to a JSON
+// encodable value.  The cached value is used if the file did not change
+// since it was parsed; otherwise, the file is parsed with parse, and the
+// value is cached unless parse fails.  A nil cache always parses the file.
+func (c *parseCache) parse(p parser, file string, v interface{}, parse func() error) error {
+	if c == nil {
+		return parse()
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return parse()
+	}
+	key := c.key(p, file)
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && e.Version == p.version && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) {
+		if err := json.Unmarshal(e.Value, v); err == nil {
+			c.mu.Lock()
+			c.hits++
+			c.mu.Unlock()
+			return nil
+		}
+	}
+
+	if err := parse(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.misses++
+	value, err := json.Marshal(v)
+	if err != nil {
+		// Values which cannot be encoded, such as NaN, are parsed again
+		// by the next analyze.
+		delete(c.entries, key)
+		return nil
+	}
+	c.entries[key] = &parseCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Version: p.version,
+		Value:   value,
+	}
+	return nil
+}
+
+// save writes the cache, dropping entries of files which no longer exist.
+func (c *parseCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		file := filepath.FromSlash(strings.SplitN(key, ":", 2)[1])
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(c.dir, file)
+		}
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			delete(c.entries, key)
+		}
+	}
+	data, err := json.Marshal(struct {
+		Format  int                         `json:"format"`
+		Entries map[string]*parseCacheEntry `json:"entries"`
+	}{parseCacheFormat, c.entries})
+	if err != nil {
+		return err
+	}
+	if err := makeAllDirs(c.dir); err != nil {
+		return err
+	}
+	// Replace the cache atomically, so that an interrupted analyze does not
+	// corrupt it.
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	log.Printf("parse cache: %d files parsed, %d unchanged", c.misses, c.hits)
+	return nil
+}
+
+// Cached representations of parsed values with unexported fields.
+
+type cachedNetperfLog struct {
+	LatTestDuration    string    `json:"latTestDuration"`
+	MinLatency         string    `json:"minLatency"`
+	MeanLatency        string    `json:"meanLatency"`
+	Latency90          string    `json:"latency90"`
+	Latency99          string    `json:"latency99"`
+	MaxLatency         string    `json:"maxLatency"`
+	LatStdDev          string    `json:"latStdDev"`
+	TxnRate            string    `json:"txnRate"`
+	NumStreams         string    `json:"numStreams"`
+	ThroughputDuration string    `json:"throughputDuration"`
+	ThroughputUnit     string    `json:"throughputUnit"`
+	MinThroughput      string    `json:"minThroughput"`
+	MeanThroughput     string    `json:"meanThroughput"`
+	MaxThroughput      string    `json:"maxThroughput"`
+	DateTime           time.Time `json:"dateTime"`
+}
+
+func newCachedNetperfLog(res *networkResult) cachedNetperfLog {
+	return cachedNetperfLog{
+		LatTestDuration:    res.latTestDuration,
+		MinLatency:         res.minLatencyMicros,
+		MeanLatency:        res.meanLatencyMicros,
+		Latency90:          res.latencyMicros_90,
+		Latency99:          res.latencyMicros_99,
+		MaxLatency:         res.maxLatencyMicros,
+		LatStdDev:          res.latStdDevMicrosec,
+		TxnRate:            res.txnRate,
+		NumStreams:         res.numStreams,
+		ThroughputDuration: res.throughputDuration,
+		ThroughputUnit:     res.throughputUnit,
+		MinThroughput:      res.minThroughput,
+		MeanThroughput:     res.meanThroughput,
+		MaxThroughput:      res.maxThroughput,
+		DateTime:           res.dateTime,
+	}
+}
+
+func (l *cachedNetperfLog) apply(res *networkResult) {
+	res.latTestDuration = l.LatTestDuration
+	res.minLatencyMicros = l.MinLatency
+	res.meanLatencyMicros = l.MeanLatency
+	res.latencyMicros_90 = l.Latency90
+	res.latencyMicros_99 = l.Latency99
+	res.maxLatencyMicros = l.MaxLatency
+	res.latStdDevMicrosec = l.LatStdDev
+	res.txnRate = l.TxnRate
+	res.numStreams = l.NumStreams
+	res.throughputDuration = l.ThroughputDuration
+	res.throughputUnit = l.ThroughputUnit
+	res.minThroughput = l.MinThroughput
+	res.meanThroughput = l.MeanThroughput
+	res.maxThroughput = l.MaxThroughput
+	res.dateTime = l.DateTime
+}
+
+type cachedTPCCRun struct {
+	// Stats are tpmC, efc, avg, p50, p90, p95, p99 and pMax.
+	Stats      [8]float64 `json:"stats"`
+	Warehouses int64      `json:"warehouses"`
+	// Txns are avg, p50, p95, p99 and pMax of each transaction type.
+	Txns map[string][5]float64 `json:"txns,omitempty"`
+}
+
+func newCachedTPCCRun(r *tpccRun) *cachedTPCCRun {
+	c := &cachedTPCCRun{
+		Stats:      [8]float64{r.tpmC, r.efc, r.avg, r.p50, r.p90, r.p95, r.p99, r.pMax},
+		Warehouses: r.warehouses,
+	}
+	if len(r.txns) > 0 {
+		c.Txns = make(map[string][5]float64)
+		for name, t := range r.txns {
+			c.Txns[name] = [5]float64{t.avg, t.p50, t.p95, t.p99, t.pMax}
+		}
+	}
+	return c
+}
+
+func (c *cachedTPCCRun) run() *tpccRun {
+	s := c.Stats
+	r := &tpccRun{
+		tpmC: s[0], efc: s[1], avg: s[2], p50: s[3], p90: s[4], p95: s[5], p99: s[6], pMax: s[7],
+		warehouses: c.Warehouses,
+		txns:       make(map[string]*tpccTxnStats),
+	}
+	for name, t := range c.Txns {
+		r.txns[name] = &tpccTxnStats{avg: t[0], p50: t[1], p95: t[2], p99: t[3], pMax: t[4]}
+	}
+	return r
+}
+
+type cachedCPUInfo struct {
+	NumaNodes int64  `json:"numaNodes"`
+	ModelName string `json:"modelName"`
+}
@@ -0,0 +1,238 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateParserVersions = flag.Bool("update-parsers", false,
+	"rewrite testdata/parse-cache.json with the values of the current parsers")
+
+// newCacheTest sets up an empty report version directory.
+func newCacheTest(t *testing.T) (dir string, cleanup func()) {
+	t.Helper()
+	base, err := ioutil.TempDir("", "cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedOutputDir, savedVersion, savedCache := baseOutputDir, reportVersion, analyzeCache
+	cleanup = func() {
+		baseOutputDir, reportVersion, analyzeCache = savedOutputDir, savedVersion, savedCache
+		os.RemoveAll(base)
+	}
+	baseOutputDir, reportVersion = base, "20220101"
+	dir = filepath.Join(base, reportVersion)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return dir, cleanup
+}
+
+func TestParseCache(t *testing.T) {
+	dir, cleanup := newCacheTest(t)
+	defer cleanup()
+	p := filepath.Join(dir, "results.txt")
+	if err := ioutil.WriteFile(p, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// parse loads the cache, parses the file into value unless cached, and
+	// saves the cache.  It returns the value and whether the file was
+	// parsed.
+	parse := func(pr parser, rebuild bool, value float64) (v float64, parsed bool) {
+		t.Helper()
+		c := loadParseCache(rebuild)
+		if err := c.parse(pr, p, &v, func() error {
+			v, parsed = value, true
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.save(); err != nil {
+			t.Fatal(err)
+		}
+		return v, parsed
+	}
+
+	v1, v2 := parser{name: "test", version: 1}, parser{name: "test", version: 2}
+	for _, tc := range []struct {
+		name    string
+		setup   func()
+		parser  parser
+		rebuild bool
+		value   float64
+		parsed  bool
+		expect  float64
+	}{
+		{name: "miss", parser: v1, value: 1, parsed: true, expect: 1},
+		{name: "hit", parser: v1, value: 2, expect: 1},
+		{name: "version", parser: v2, value: 3, parsed: true, expect: 3},
+		{
+			name: "modified",
+			setup: func() {
+				mtime := time.Now().Add(time.Hour)
+				if err := os.Chtimes(p, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			},
+			parser: v2, value: 4, parsed: true, expect: 4,
+		},
+		{name: "unmodified", parser: v2, value: 5, expect: 4},
+		{name: "rebuild", parser: v2, rebuild: true, value: 6, parsed: true, expect: 6},
+		{name: "after rebuild", parser: v2, value: 7, expect: 6},
+		{
+			// Values which cannot be encoded are parsed every time.
+			name: "NaN", parser: v2, rebuild: true, value: math.NaN(), parsed: true, expect: math.NaN(),
+		},
+		{name: "after NaN", parser: v2, value: 8, parsed: true, expect: 8},
+	} {
+		if tc.setup != nil {
+			tc.setup()
+		}
+		v, parsed := parse(tc.parser, tc.rebuild, tc.value)
+		if parsed != tc.parsed {
+			t.Errorf("%s: expected parsed %t, got %t", tc.name, tc.parsed, parsed)
+		}
+		if v != tc.expect && !(math.IsNaN(v) && math.IsNaN(tc.expect)) {
+			t.Errorf("%s: expected value %v, got %v", tc.name, tc.expect, v)
+		}
+	}
+}
+
+// parserVersionsFile records the values parsed from testdata by every
+// cached parser, and the version of the parser.
+const parserVersionsFile = "testdata/parse-cache.json"
+
+type parserValues struct {
+	Version int                        `json:"version"`
+	Values  map[string]json.RawMessage `json:"values"`
+}
+
+// TestParserVersions verifies that the version of a parser is incremented
+// when the values it parses from testdata change, so that stale entries of
+// parse caches are not used.
+func TestParserVersions(t *testing.T) {
+	dir, cleanup := newCacheTest(t)
+	defer cleanup()
+	for dst, src := range map[string]string{
+		"fio/fio-results.json":        "fio/fio-results.json",
+		"netperf/netperf-results.log": "netperf/netperf-results.log",
+		"coremark/single.log":         "coremark/single.log",
+		"coremark/multi.log":          "coremark/multi.log",
+		"cpu_info/single-host.txt":    "cpu_info/single-host.txt",
+		"cpu_info/two-hosts.txt":      "cpu_info/two-hosts.txt",
+		"tpcc/tpcc-results.txt":       "tpcc/results.txt",
+		"tpcc/cpu_info.txt":           "cpu_info/two-hosts.txt",
+	} {
+		b, err := ioutil.ReadFile(filepath.Join("testdata", src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(dir, dst)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	analyzeCache = loadParseCache(true)
+	if err := parseFIOResults(filepath.Join(dir, "fio/fio-results.json"), &fioResults{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseNetperfResults(filepath.Join(dir, "netperf/netperf-results.log"), &networkResult{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"coremark/single.log", "coremark/multi.log"} {
+		if _, _, err := parseCoremarkLog(filepath.Join(dir, f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"cpu_info/single-host.txt", "cpu_info/two-hosts.txt"} {
+		if _, err := parseCPUInfo(filepath.Join(dir, f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := parseTPCCRun(filepath.Join(dir, "tpcc/tpcc-results.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	parsers := []parser{fioParser, coremarkParser, netperfParser, tpccParser, lscpuParser}
+	got := make(map[string]*parserValues)
+	for _, p := range parsers {
+		got[p.name] = &parserValues{Version: p.version, Values: make(map[string]json.RawMessage)}
+	}
+	for key, e := range analyzeCache.entries {
+		kv := strings.SplitN(key, ":", 2)
+		got[kv[0]].Values[kv[1]] = e.Value
+	}
+
+	if *updateParserVersions {
+		data, err := json.MarshalIndent(got, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(parserVersionsFile, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(parserVersionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]*parserValues
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	const update = "go test ./cmd -run TestParserVersions -update-parsers"
+	for _, p := range parsers {
+		w := want[p.name]
+		if w == nil || w.Version != p.version {
+			t.Errorf("%s: %s has no values of version %d; run %s", p.name, parserVersionsFile, p.version, update)
+			continue
+		}
+		var files []string
+		for f := range got[p.name].Values {
+			files = append(files, f)
+		}
+		for f := range w.Values {
+			if _, ok := got[p.name].Values[f]; !ok {
+				files = append(files, f)
+			}
+		}
+		sort.Strings(files)
+		for _, f := range files {
+			var exp bytes.Buffer
+			if v, ok := w.Values[f]; ok {
+				if err := json.Compact(&exp, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if v := got[p.name].Values[f]; !bytes.Equal(exp.Bytes(), v) {
+				t.Errorf("%s: value parsed from %s changed from %s to %s; increment the version of "+
+					"the %s parser, and run %s", p.name, f, exp.Bytes(), v, p.name, update)
+			}
+		}
+	}
+}
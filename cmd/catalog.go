@@ -0,0 +1,186 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+const defaultMachineCatalogFile = "./catalog/machines.json"
+
+var machineCatalogFile string
+
+// catalogCmd represents the catalog command
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Inspects the machine catalog",
+	Long: `The machine catalog (--machine-catalog) lists facts about machine types:
+vCPUs, memory, architecture and advertised network and disk bandwidth caps.`,
+}
+
+// catalogCheckCmd represents the catalog check command
+var catalogCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Lists configured machine types missing from the machine catalog",
+	// Missing machine types are not usage errors.
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return checkMachineCatalog()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(catalogCmd)
+	catalogCmd.AddCommand(catalogCheckCmd)
+
+	rootCmd.PersistentFlags().StringVar(&machineCatalogFile, "machine-catalog", defaultMachineCatalogFile,
+		"path to JSON machine catalog")
+}
+
+// machineInfo describes a machine type.  Zero bandwidth caps are unknown.
+type machineInfo struct {
+	Cloud       string  `json:"cloud"`
+	MachineType string  `json:"machineType"`
+	VCPUs       int     `json:"vcpus"`
+	MemoryGiB   float64 `json:"memoryGiB"`
+	// Arch is the CPU architecture as reported by uname -m.
+	Arch string `json:"arch"`
+	// NetworkGbps is the advertised network bandwidth cap.
+	NetworkGbps float64 `json:"networkGbps,omitempty"`
+	// DiskMBps is the advertised bandwidth cap of the attached storage.
+	DiskMBps float64 `json:"diskMBps,omitempty"`
+}
+
+var machineArchs = []string{"x86_64", "aarch64"}
+
+func (m *machineInfo) validate() error {
+	switch {
+	case m.Cloud == "" || m.MachineType == "":
+		return fmt.Errorf("cloud and machine type must be specified")
+	case m.VCPUs < 1:
+		return fmt.Errorf("%s/%s: vcpus must be positive", m.Cloud, m.MachineType)
+	case m.MemoryGiB <= 0:
+		return fmt.Errorf("%s/%s: memoryGiB must be positive", m.Cloud, m.MachineType)
+	case !containsString(machineArchs, m.Arch):
+		return fmt.Errorf("%s/%s: arch %q is not one of %s",
+			m.Cloud, m.MachineType, m.Arch, strings.Join(machineArchs, ", "))
+	case m.NetworkGbps < 0 || m.DiskMBps < 0:
+		return fmt.Errorf("%s/%s: bandwidth caps must not be negative", m.Cloud, m.MachineType)
+	}
+	return nil
+}
+
+// machineCatalog is the offline catalog of machine types loaded from the
+// --machine-catalog file.
+type machineCatalog struct {
+	Machines []machineInfo `json:"machines"`
+}
+
+func loadMachineCatalog(p string) (*machineCatalog, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var c machineCatalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	for i := range c.Machines {
+		m := &c.Machines[i]
+		if err := m.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		if prev := c.lookup(m.Cloud, m.MachineType); prev != m {
+			return nil, fmt.Errorf("%s: %s/%s is listed more than once", p, m.Cloud, m.MachineType)
+		}
+	}
+	return &c, nil
+}
+
+func (c *machineCatalog) lookup(cloud, machineType string) *machineInfo {
+	for i := range c.Machines {
+		if m := &c.Machines[i]; m.Cloud == cloud && m.MachineType == machineType {
+			return m
+		}
+	}
+	return nil
+}
+
+// catalog is the machine catalog, loaded on first use.
+var catalog *machineCatalog
+var catalogMu sync.Mutex
+
+// lookupMachine returns the catalog entry of the machine type, nil if the
+// catalog does not list it.  The default catalog is optional.
+func lookupMachine(cloud, machineType string) (*machineInfo, error) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	if catalog == nil {
+		c, err := loadMachineCatalog(machineCatalogFile)
+		if os.IsNotExist(err) && machineCatalogFile == defaultMachineCatalogFile {
+			log.Printf("machine catalog %s not found", machineCatalogFile)
+			c, err = &machineCatalog{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		catalog = c
+	}
+	return catalog.lookup(cloud, machineType), nil
+}
+
+// checkMachineCatalog lists machine types of the cloud details which are
+// missing from the catalog, failing if there are any.
+func checkMachineCatalog() error {
+	c, err := loadMachineCatalog(machineCatalogFile)
+	if err != nil {
+		return err
+	}
+	var checked, missing []string
+	for _, cloud := range clouds {
+		for _, machineType := range sortedMachineTypes(cloud) {
+			// Machine types are usually configured in several groups.
+			id := cloud.Cloud + "/" + machineType
+			if containsString(checked, id) {
+				continue
+			}
+			checked = append(checked, id)
+			m := c.lookup(cloud.Cloud, machineType)
+			if m == nil {
+				missing = append(missing, id)
+				fmt.Printf("%s: missing\n", id)
+				continue
+			}
+			var unknown []string
+			if m.NetworkGbps == 0 {
+				unknown = append(unknown, "network")
+			}
+			if m.DiskMBps == 0 {
+				unknown = append(unknown, "disk")
+			}
+			if len(unknown) > 0 {
+				fmt.Printf("%s: unknown %s bandwidth cap\n", id, strings.Join(unknown, " and "))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%d machine types missing from %s", len(missing), machineCatalogFile)
+	}
+	fmt.Printf("All machine types found in %s\n", machineCatalogFile)
+	return nil
+}
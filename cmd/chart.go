@@ -0,0 +1,276 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"sort"
+)
+
+// Charts are rendered as inline SVG so that the report is a single static
+// file which does not depend on any scripts.
+
+var chartColors = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+	"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac",
+}
+
+const (
+	chartWidth       = 900
+	chartLabelWidth  = 260
+	chartRightMargin = 80
+	chartBarHeight   = 12
+	chartTitleHeight = 30
+	chartAxisHeight  = 30
+	chartLegendRow   = 18
+)
+
+// barSeries is a named series of values, one per chart label.
+type barSeries struct {
+	name   string
+	values []float64
+}
+
+// niceCeil rounds v up to 1, 2 or 5 times a power of 10.
+func niceCeil(v float64) float64 {
+	if v <= 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 1
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*exp >= v {
+			return m * exp
+		}
+	}
+	return 10 * exp
+}
+
+// isFinite returns true unless v is NaN or infinite.
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func formatTick(v float64) string {
+	switch {
+	case v == 0:
+		return "0"
+	case math.Abs(v) >= 1e6:
+		return fmt.Sprintf("%.3gM", v/1e6)
+	case math.Abs(v) >= 1e3:
+		return fmt.Sprintf("%.3gk", v/1e3)
+	default:
+		return fmt.Sprintf("%.3g", v)
+	}
+}
+
+func svgText(buf *bytes.Buffer, x, y float64, anchor, class, text string) {
+	fmt.Fprintf(buf, `<text x="%.1f" y="%.1f" text-anchor="%s" class="%s">%s</text>`,
+		x, y, anchor, class, template.HTMLEscapeString(text))
+	buf.WriteByte('\n')
+}
+
+func svgLegend(buf *bytes.Buffer, y float64, names []string) {
+	x := float64(chartLabelWidth)
+	for i, name := range names {
+		fmt.Fprintf(buf, `<rect x="%.1f" y="%.1f" width="10" height="10" fill="%s"/>`,
+			x, y-9, chartColors[i%len(chartColors)])
+		svgText(buf, x+14, y, "start", "legend", name)
+		x += 24 + 7*float64(len(name))
+	}
+}
+
+// barChart renders horizontal grouped bar chart; each label has a bar for
+// every series.  NaN and infinite values are omitted, and negative values are
+// drawn as empty bars.
+func barChart(title, unit string, labels []string, series []barSeries) template.HTML {
+	maxVal := 0.0
+	for _, s := range series {
+		for _, v := range s.values {
+			if isFinite(v) && v > maxVal {
+				maxVal = v
+			}
+		}
+	}
+	maxVal = niceCeil(maxVal)
+	groupHeight := float64(chartBarHeight*len(series) + 6)
+	plotTop := float64(chartTitleHeight + chartLegendRow)
+	plotHeight := groupHeight * float64(len(labels))
+	plotWidth := float64(chartWidth - chartLabelWidth - chartRightMargin)
+	height := plotTop + plotHeight + chartAxisHeight
+	scale := func(v float64) float64 { return v / maxVal * plotWidth }
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%.0f" class="chart">`,
+		chartWidth, height)
+	buf.WriteByte('\n')
+	svgText(&buf, chartWidth/2, 18, "middle", "title", title)
+	var names []string
+	for _, s := range series {
+		names = append(names, s.name)
+	}
+	svgLegend(&buf, plotTop-4, names)
+
+	// Grid and axis.
+	const ticks = 5
+	for i := 0; i <= ticks; i++ {
+		v := maxVal * float64(i) / ticks
+		x := chartLabelWidth + scale(v)
+		fmt.Fprintf(&buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" class="grid"/>`,
+			x, plotTop, x, plotTop+plotHeight)
+		buf.WriteByte('\n')
+		svgText(&buf, x, plotTop+plotHeight+14, "middle", "tick", formatTick(v))
+	}
+	svgText(&buf, chartLabelWidth+plotWidth/2, plotTop+plotHeight+27, "middle", "axis", unit)
+
+	for i, label := range labels {
+		y := plotTop + groupHeight*float64(i)
+		svgText(&buf, chartLabelWidth-6, y+groupHeight/2+4, "end", "label", label)
+		for j, s := range series {
+			if i >= len(s.values) || !isFinite(s.values[i]) {
+				continue
+			}
+			v := s.values[i]
+			width := scale(math.Max(v, 0))
+			by := y + 3 + float64(chartBarHeight*j)
+			fmt.Fprintf(&buf, `<rect x="%d" y="%.1f" width="%.1f" height="%d" fill="%s"><title>%s</title></rect>`,
+				chartLabelWidth, by, width, chartBarHeight-1, chartColors[j%len(chartColors)],
+				template.HTMLEscapeString(fmt.Sprintf("%s %s: %g", label, s.name, v)))
+			buf.WriteByte('\n')
+			svgText(&buf, chartLabelWidth+width+3, by+chartBarHeight-2, "start", "value", formatTick(v))
+		}
+	}
+	buf.WriteString("</svg>\n")
+	return template.HTML(buf.String())
+}
+
+// scatterPoint is a point of the scatter series.  Points which did not
+// pass are drawn hollow.
+type scatterPoint struct {
+	x, y float64
+	pass bool
+}
+
+type scatterSeries struct {
+	name   string
+	points []scatterPoint
+}
+
+// refLine is a reference line y = slope * x.
+type refLine struct {
+	name  string
+	slope float64
+}
+
+// scatterChart renders series of points connected by lines, along with the
+// reference lines.  Points with NaN or infinite coordinates are omitted.
+func scatterChart(title, xUnit, yUnit string, series []scatterSeries, refs []refLine) template.HTML {
+	var maxX, maxY float64
+	finite := make([]scatterSeries, len(series))
+	for i, s := range series {
+		finite[i].name = s.name
+		for _, p := range s.points {
+			if isFinite(p.x) && isFinite(p.y) {
+				finite[i].points = append(finite[i].points, p)
+			}
+		}
+	}
+	series = finite
+	for _, s := range series {
+		for _, p := range s.points {
+			maxX = math.Max(maxX, p.x)
+			maxY = math.Max(maxY, p.y)
+		}
+	}
+	maxX, maxY = niceCeil(maxX), niceCeil(maxY)
+
+	const left, plotHeight = 80.0, 360.0
+	plotTop := float64(chartTitleHeight + chartLegendRow*((len(series)+3)/4))
+	plotWidth := float64(chartWidth) - left - chartRightMargin
+	height := plotTop + plotHeight + chartAxisHeight + 10
+	sx := func(x float64) float64 { return left + x/maxX*plotWidth }
+	sy := func(y float64) float64 { return plotTop + plotHeight - y/maxY*plotHeight }
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%.0f" class="chart">`,
+		chartWidth, height)
+	buf.WriteByte('\n')
+	svgText(&buf, chartWidth/2, 18, "middle", "title", title)
+
+	// Legend, four series per row.
+	for i, s := range series {
+		x := left + float64(i%4)*plotWidth/4
+		y := float64(chartTitleHeight) + float64(i/4)*chartLegendRow + 10
+		fmt.Fprintf(&buf, `<rect x="%.1f" y="%.1f" width="10" height="10" fill="%s"/>`,
+			x, y-9, chartColors[i%len(chartColors)])
+		svgText(&buf, x+14, y, "start", "legend", s.name)
+	}
+
+	const ticks = 5
+	for i := 0; i <= ticks; i++ {
+		x, y := maxX*float64(i)/ticks, maxY*float64(i)/ticks
+		fmt.Fprintf(&buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" class="grid"/>`,
+			sx(x), plotTop, sx(x), plotTop+plotHeight)
+		fmt.Fprintf(&buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" class="grid"/>`,
+			left, sy(y), left+plotWidth, sy(y))
+		buf.WriteByte('\n')
+		svgText(&buf, sx(x), plotTop+plotHeight+14, "middle", "tick", formatTick(x))
+		svgText(&buf, left-6, sy(y)+4, "end", "tick", formatTick(y))
+	}
+	svgText(&buf, left+plotWidth/2, plotTop+plotHeight+28, "middle", "axis", xUnit)
+	fmt.Fprintf(&buf, `<text x="14" y="%.1f" text-anchor="middle" class="axis" transform="rotate(-90 14 %.1f)">%s</text>`,
+		plotTop+plotHeight/2, plotTop+plotHeight/2, template.HTMLEscapeString(yUnit))
+	buf.WriteByte('\n')
+
+	for _, r := range refs {
+		if !isFinite(r.slope) {
+			continue
+		}
+		// Clip the line to the plot area.
+		x2, y2 := maxX, r.slope*maxX
+		if y2 > maxY {
+			x2, y2 = maxY/r.slope, maxY
+		}
+		fmt.Fprintf(&buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" class="ref"/>`,
+			sx(0), sy(0), sx(x2), sy(y2))
+		buf.WriteByte('\n')
+		svgText(&buf, sx(x2), sy(y2)-4, "end", "ref-label", r.name)
+	}
+
+	for i, s := range series {
+		color := chartColors[i%len(chartColors)]
+		points := append([]scatterPoint(nil), s.points...)
+		sort.SliceStable(points, func(a, b int) bool { return points[a].x < points[b].x })
+		var line bytes.Buffer
+		for _, p := range points {
+			fmt.Fprintf(&line, "%.1f,%.1f ", sx(p.x), sy(p.y))
+		}
+		fmt.Fprintf(&buf, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1"/>`, line.String(), color)
+		buf.WriteByte('\n')
+		for _, p := range points {
+			fill := color
+			if !p.pass {
+				fill = "white"
+			}
+			status := "pass"
+			if !p.pass {
+				status = "fail"
+			}
+			fmt.Fprintf(&buf, `<circle cx="%.1f" cy="%.1f" r="4" fill="%s" stroke="%s"><title>%s</title></circle>`,
+				sx(p.x), sy(p.y), fill, color,
+				template.HTMLEscapeString(fmt.Sprintf("%s: %g %s, %g %s (%s)", s.name, p.x, xUnit, p.y, yUnit, status)))
+			buf.WriteByte('\n')
+		}
+	}
+	buf.WriteString("</svg>\n")
+	return template.HTML(buf.String())
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/xml"
+	"html/template"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkSVG verifies that the chart is well formed, and that its numeric
+// attributes are finite and its sizes are not negative.
+func checkSVG(t *testing.T, chart template.HTML) {
+	t.Helper()
+	d := xml.NewDecoder(strings.NewReader(string(chart)))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %v\n%s", err, chart)
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, a := range el.Attr {
+			switch a.Name.Local {
+			case "x", "y", "x1", "y1", "x2", "y2", "cx", "cy", "width", "height":
+				v, err := strconv.ParseFloat(a.Value, 64)
+				if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+					t.Errorf("<%s %s=%q>: not a finite number", el.Name.Local, a.Name.Local, a.Value)
+				} else if (a.Name.Local == "width" || a.Name.Local == "height") && v < 0 {
+					t.Errorf("<%s %s=%q>: negative size", el.Name.Local, a.Name.Local, a.Value)
+				}
+			case "points":
+				for _, p := range strings.Fields(strings.Replace(a.Value, ",", " ", -1)) {
+					if v, err := strconv.ParseFloat(p, 64); err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+						t.Errorf("<%s points=%q>: not finite numbers", el.Name.Local, a.Value)
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestChartNonFiniteValues(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	for _, tc := range []struct {
+		name   string
+		values []float64
+	}{
+		{"finite", []float64{1, 2.5, 0}},
+		{"non-finite", []float64{nan, inf, math.Inf(-1)}},
+		{"mixed", []float64{nan, 10, inf}},
+		{"negative", []float64{-5, 10, -inf}},
+		{"all negative", []float64{-5, -10, nan}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			labels := []string{"a", "b", "c"}
+			checkSVG(t, barChart("bars", "unit", labels, []barSeries{
+				{name: "s1", values: tc.values},
+				{name: "s2", values: []float64{1, 2, 3}},
+			}))
+
+			var points []scatterPoint
+			for i, v := range tc.values {
+				points = append(points, scatterPoint{x: v, y: float64(i)}, scatterPoint{x: float64(i), y: v})
+			}
+			series := []scatterSeries{{name: "s1", points: points}}
+			checkSVG(t, scatterChart("scatter", "x", "y", series,
+				[]refLine{{name: "max", slope: 12.86}, {name: "nan", slope: nan}}))
+			if len(series[0].points) != len(points) {
+				t.Errorf("scatterChart modified its series")
+			}
+		})
+	}
+}
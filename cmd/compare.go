@@ -0,0 +1,506 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var compareBase, compareHead string
+var compareThreshold = 0.05
+
+// compareCmd represents the compare command
+var compareCmd = &cobra.Command{
+	Use:   "compare",
+	Short: "Compares analyzed results of two report versions",
+	Long: `Matches rows of the analyzed results of the base and head report versions
+and computes absolute and relative deltas of every metric.  Changes exceeding
+the threshold, or beyond the run-to-run noise, are flagged.  Results of the clouds
+specified via --cloud-details are compared.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if compareBase == "" || compareHead == "" {
+			return fmt.Errorf("both --base and --head must be specified")
+		}
+		if err := checkOutputFormats(); err != nil {
+			return err
+		}
+		return compareResults(compareBase, compareHead)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	compareCmd.Flags().StringVar(&compareBase, "base", "", "base report version")
+	compareCmd.Flags().StringVar(&compareHead, "head", "", "head report version")
+	compareCmd.Flags().Float64Var(&compareThreshold, "threshold", compareThreshold,
+		"relative change (e.g. 0.05 for 5%) above which changes are flagged")
+	compareCmd.Flags().StringSliceVar(&outputFormats, "format", outputFormats,
+		fmt.Sprintf("comma separated list of output formats: %s", strings.Join(resultFormatNames(), ", ")))
+}
+
+// comparedTable describes how rows of the analyzed results table are matched.
+// Empty column names are not present in the table.
+type comparedTable struct {
+	cloud, group, machine string
+	// job lists additional columns identifying the row.
+	job []string
+	// ignore lists non-metric columns.
+	ignore []string
+}
+
+// comparedTables lists results tables which can be compared.  Repeated TPC-C
+// runs are best compared via tpcc-aggregate; tpcc covers reports without it.
+var comparedTables = map[string]comparedTable{
+	"cpu": {cloud: "Cloud", group: "Group", machine: "MachineType", ignore: []string{"Date", "Run", "Sanity"}},
+	"tpcc": {cloud: "Cloud", group: "Group", machine: "MachineType",
+		job: []string{"warehousePerVCPU", "Warehouses"}, ignore: []string{"Date", "Run", "Sanity"}},
+	"fio": {cloud: "Cloud", group: "Group", machine: "Machine", job: []string{"Job", "BS", "IoDepth"},
+		ignore: []string{"Date", "Run", "Sanity"}},
+	"intra-az-net": {cloud: "Cloud", group: "DiskType", machine: "MachineType",
+		ignore: []string{"DateTime(Zulu)", "Run", "ClientRegion", "ServerRegion", "ThrptUnit", "Sanity"}},
+	"cross-region-net": {cloud: "Cloud", group: "DiskType", machine: "MachineType",
+		ignore: []string{"DateTime(Zulu)", "Run", "ClientRegion", "ServerRegion", "ThrptUnit", "Sanity"}},
+	"tpcc-aggregate": {cloud: "Cloud", group: "Group", machine: "MachineType",
+		job: []string{"warehousePerVCPU", "Warehouses"}},
+	"tpcc-summary": {cloud: "Cloud", group: "Group", machine: "MachineType"},
+	"tpcc-sla-summary": {cloud: "Cloud", group: "Group", machine: "MachineType",
+		job: []string{"Policy"}},
+	"price-performance": {cloud: "Cloud", group: "Group", machine: "MachineType",
+		job: []string{"Benchmark", "Metric", "Term"}, ignore: []string{"Region", "Unit", "Currency"}},
+}
+
+// resultsTable is an analyzed results table read from CSV file.
+type resultsTable struct {
+	columns []string
+	rows    [][]string
+}
+
+func (t *resultsTable) columnIndex(name string) int {
+	for i, c := range t.columns {
+		if c == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func readResultsTable(p string) (*resultsTable, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	// Some tables have a variable number of columns.
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: empty results file", p)
+	}
+	return &resultsTable{columns: records[0], rows: records[1:]}, nil
+}
+
+// readResults reads the specified analyzed CSV results tables of the report
+// version, keyed by cloud and table name.
+func readResults(version string, tables []string) (map[string]map[string]*resultsTable, error) {
+	dir := path.Join(baseOutputDir, version, "results")
+	files, err := filepath.Glob(path.Join(dir, "*", "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no CSV results found in %s; run analyze first", dir)
+	}
+	results := make(map[string]map[string]*resultsTable)
+	for _, f := range files {
+		cloud := filepath.Base(filepath.Dir(f))
+		table := strings.TrimSuffix(filepath.Base(f), ".csv")
+		if !containsString(tables, table) {
+			continue
+		}
+		t, err := readResultsTable(f)
+		if err != nil {
+			return nil, err
+		}
+		if results[cloud] == nil {
+			results[cloud] = make(map[string]*resultsTable)
+		}
+		results[cloud][table] = t
+	}
+	return results, nil
+}
+
+// rowKey identifies a row of the results table.
+type rowKey struct {
+	cloud, group, machine, job string
+}
+
+func (ct comparedTable) keyOf(t *resultsTable, row []string) rowKey {
+	get := func(col string) string {
+		if i := t.columnIndex(col); i >= 0 && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	var job []string
+	for _, c := range ct.job {
+		job = append(job, fmt.Sprintf("%s=%s", c, get(c)))
+	}
+	return rowKey{
+		cloud:   get(ct.cloud),
+		group:   get(ct.group),
+		machine: get(ct.machine),
+		job:     strings.Join(job, ";"),
+	}
+}
+
+// runColumn lists the labels of the runs of the row.
+const runColumn = "Run"
+
+// restrict returns the comparedTable matching rows of the base and head
+// tables on the key columns present in both.  For instance, rows of results
+// predating groups are matched by cloud and machine type.  Rows are further
+// keyed by run if either table has several rows of the same key, e.g. when
+// analyzed with --runs all.
+func (ct comparedTable) restrict(tables ...*resultsTable) comparedTable {
+	present := func(col string) bool {
+		for _, t := range tables {
+			if t != nil && t.columnIndex(col) < 0 {
+				return false
+			}
+		}
+		return true
+	}
+	res := comparedTable{ignore: append([]string(nil), ct.ignore...)}
+	for _, c := range []struct{ from, to *string }{
+		{&ct.cloud, &res.cloud}, {&ct.group, &res.group}, {&ct.machine, &res.machine},
+	} {
+		if *c.from != "" && present(*c.from) {
+			*c.to = *c.from
+		} else if *c.from != "" {
+			res.ignore = append(res.ignore, *c.from)
+		}
+	}
+	for _, c := range ct.job {
+		if present(c) {
+			res.job = append(res.job, c)
+		} else {
+			res.ignore = append(res.ignore, c)
+		}
+	}
+	if containsString(res.job, runColumn) || !present(runColumn) {
+		return res
+	}
+	for _, t := range tables {
+		if len(res.duplicateKeys(t)) > 0 {
+			res.job = append(res.job, runColumn)
+			break
+		}
+	}
+	return res
+}
+
+// duplicateKeys returns keys shared by several rows of the table.
+func (ct comparedTable) duplicateKeys(t *resultsTable) []rowKey {
+	if t == nil {
+		return nil
+	}
+	var dups []rowKey
+	count := make(map[rowKey]int)
+	for _, r := range t.rows {
+		k := ct.keyOf(t, r)
+		if count[k]++; count[k] == 2 {
+			dups = append(dups, k)
+		}
+	}
+	return dups
+}
+
+func (k rowKey) String() string {
+	s := fmt.Sprintf("%s/%s/%s", k.cloud, k.group, k.machine)
+	if k.job != "" {
+		s += " " + k.job
+	}
+	return s
+}
+
+func (ct comparedTable) isMetric(col string) bool {
+	if col == ct.cloud || col == ct.group || col == ct.machine {
+		return false
+	}
+	return !containsString(ct.job, col) && !containsString(ct.ignore, col)
+}
+
+// indexRows returns table rows keyed by rowKey, along with keys in table
+// order.  Rows sharing a key cannot be matched, and are an error.
+func (ct comparedTable) indexRows(t *resultsTable) ([]rowKey, map[rowKey][]string, error) {
+	var keys []rowKey
+	rows := make(map[rowKey][]string)
+	if t == nil {
+		return nil, rows, nil
+	}
+	if dups := ct.duplicateKeys(t); len(dups) > 0 {
+		var names []string
+		for _, k := range dups {
+			names = append(names, k.String())
+		}
+		return nil, nil, fmt.Errorf("several rows of %s", strings.Join(names, ", "))
+	}
+	for _, r := range t.rows {
+		k := ct.keyOf(t, r)
+		keys = append(keys, k)
+		rows[k] = r
+	}
+	return keys, rows, nil
+}
+
+// Comparison status of the metric.
+const (
+	compareUnchanged = "unchanged"
+	compareChanged   = "changed"
+	compareAdded     = "added"
+	compareRemoved   = "removed"
+)
+
+// metricDelta is a comparison of a single metric.
+type metricDelta struct {
+	table  string
+	key    rowKey
+	metric string
+	base   interface{}
+	head   interface{}
+	delta  float64
+	rel    float64
+	// noisy is set if the change is within run-to-run noise.
+	noisy   bool
+	flagged bool
+	status  string
+}
+
+// ciColumns returns confidence interval columns of the mean metric, if any.
+func ciColumns(metric string) (lo, hi string, ok bool) {
+	if !strings.HasSuffix(metric, "Mean") {
+		return "", "", false
+	}
+	prefix := strings.TrimSuffix(metric, "Mean")
+	return prefix + "CILow", prefix + "CIHigh", true
+}
+
+func parseMetric(t *resultsTable, row []string, col string) (float64, bool) {
+	i := t.columnIndex(col)
+	if i < 0 || i >= len(row) {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(row[i]), 64)
+	if err != nil || math.IsNaN(v) {
+		return 0, false
+	}
+	return v, true
+}
+
+// withinNoise returns true if confidence intervals of the base and head
+// metric overlap; known is false if the metric has no confidence
+// intervals.
+func withinNoise(base, head *resultsTable, baseRow, headRow []string, metric string) (within, known bool) {
+	loCol, hiCol, ok := ciColumns(metric)
+	if !ok {
+		return false, false
+	}
+	bLo, ok1 := parseMetric(base, baseRow, loCol)
+	bHi, ok2 := parseMetric(base, baseRow, hiCol)
+	hLo, ok3 := parseMetric(head, headRow, loCol)
+	hHi, ok4 := parseMetric(head, headRow, hiCol)
+	if !(ok1 && ok2 && ok3 && ok4) {
+		return false, false
+	}
+	return bLo <= hHi && hLo <= bHi, true
+}
+
+func compareTables(name string, ct comparedTable, base, head *resultsTable) ([]metricDelta, error) {
+	ct = ct.restrict(base, head)
+	baseKeys, baseRows, err := ct.indexRows(base)
+	if err != nil {
+		return nil, fmt.Errorf("base %s: %v", name, err)
+	}
+	headKeys, headRows, err := ct.indexRows(head)
+	if err != nil {
+		return nil, fmt.Errorf("head %s: %v", name, err)
+	}
+	keys := baseKeys
+	for _, k := range headKeys {
+		if _, ok := baseRows[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	// Metrics are the union of metric columns of both tables, in column order.
+	var metrics []string
+	for _, t := range []*resultsTable{base, head} {
+		if t == nil {
+			continue
+		}
+		for _, c := range t.columns {
+			if ct.isMetric(c) && !containsString(metrics, c) {
+				metrics = append(metrics, c)
+			}
+		}
+	}
+
+	var deltas []metricDelta
+	for _, k := range keys {
+		baseRow, inBase := baseRows[k]
+		headRow, inHead := headRows[k]
+		for _, m := range metrics {
+			d := metricDelta{table: name, key: k, metric: m, delta: math.NaN(), rel: math.NaN()}
+			var b, h float64
+			var okBase, okHead bool
+			if inBase {
+				b, okBase = parseMetric(base, baseRow, m)
+			}
+			if inHead {
+				h, okHead = parseMetric(head, headRow, m)
+			}
+			switch {
+			case okBase && okHead:
+				d.base, d.head = b, h
+				d.delta = h - b
+				if b != 0 {
+					d.rel = d.delta / math.Abs(b)
+				} else if d.delta != 0 {
+					d.rel = math.Inf(1)
+				} else {
+					d.rel = 0
+				}
+				// Changes beyond the threshold, or outside the noise band
+				// of metrics with confidence intervals, are flagged.
+				within, known := withinNoise(base, head, baseRow, headRow, m)
+				d.noisy = known && within
+				d.flagged = math.Abs(d.rel) > compareThreshold || known && !within
+				d.status = compareUnchanged
+				if d.delta != 0 {
+					d.status = compareChanged
+				}
+			case okBase && !inHead:
+				d.base = b
+				d.status = compareRemoved
+				d.flagged = true
+			case okHead && !inBase:
+				d.head = h
+				d.status = compareAdded
+				d.flagged = true
+			default:
+				// Not a numeric metric.
+				continue
+			}
+			deltas = append(deltas, d)
+		}
+	}
+	return deltas, nil
+}
+
+const compareCSVHeader = "Table,Cloud,Group,MachineType,Job,Metric,Base,Head,Delta,RelDelta,WithinNoise,Flagged,Status"
+
+func compareResults(baseVersion, headVersion string) (err error) {
+	var tables []string
+	for name := range comparedTables {
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+
+	base, err := readResults(baseVersion, tables)
+	if err != nil {
+		return err
+	}
+	head, err := readResults(headVersion, tables)
+	if err != nil {
+		return err
+	}
+
+	// Compare clouds specified via cloud details.
+	cloudNames := cloudDetailsNames()
+
+	var deltas []metricDelta
+	for _, cloud := range cloudNames {
+		for _, name := range tables {
+			b, h := base[cloud][name], head[cloud][name]
+			if b == nil && h == nil {
+				continue
+			}
+			d, err := compareTables(name, comparedTables[name], b, h)
+			if err != nil {
+				return fmt.Errorf("%s: %v", cloud, err)
+			}
+			deltas = append(deltas, d...)
+		}
+	}
+
+	dir := path.Join(baseOutputDir, headVersion, "results", "compare-"+baseVersion)
+	if err := makeAllDirs(dir); err != nil {
+		return err
+	}
+	wr, err := newResultWriterInDir(dir, "comparison", strings.Split(compareCSVHeader, ","))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	for _, d := range deltas {
+		if err := wr.Write([]interface{}{
+			d.table, d.key.cloud, d.key.group, d.key.machine, d.key.job, d.metric,
+			d.base, d.head, d.delta, d.rel, d.noisy, d.flagged, d.status,
+		}); err != nil {
+			return err
+		}
+	}
+
+	printFlaggedDeltas(deltas)
+	fmt.Printf("Comparison of %s to %s written to %s\n", headVersion, baseVersion, dir)
+	return nil
+}
+
+// printFlaggedDeltas prints a table of flagged changes.
+func printFlaggedDeltas(deltas []metricDelta) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tCLOUD\tGROUP\tMACHINE\tJOB\tMETRIC\tBASE\tHEAD\tCHANGE\tSTATUS")
+	flagged := 0
+	for _, d := range deltas {
+		if !d.flagged {
+			continue
+		}
+		flagged++
+		change := ""
+		if !math.IsNaN(d.rel) {
+			change = fmt.Sprintf("%+.1f%%", d.rel*100)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.table, d.key.cloud, d.key.group, d.key.machine, d.key.job, d.metric,
+			formatValue(d.base), formatValue(d.head), change, d.status)
+	}
+	_ = w.Flush()
+	fmt.Printf("%d of %d metrics flagged (threshold %.1f%%)\n", flagged, len(deltas), compareThreshold*100)
+}
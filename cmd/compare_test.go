@@ -0,0 +1,168 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func csvTable(csv string) *resultsTable {
+	var records [][]string
+	for _, l := range strings.Split(strings.TrimSpace(csv), "\n") {
+		records = append(records, strings.Split(strings.TrimSpace(l), ","))
+	}
+	return &resultsTable{columns: records[0], rows: records[1:]}
+}
+
+// deltaOf returns the delta of the metric of the row of the key.
+func deltaOf(t *testing.T, deltas []metricDelta, key rowKey, metric string) metricDelta {
+	t.Helper()
+	for _, d := range deltas {
+		if d.key == key && d.metric == metric {
+			return d
+		}
+	}
+	t.Fatalf("no delta of %s %s in %v", key, metric, deltas)
+	return metricDelta{}
+}
+
+func TestCompareTables(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		table      string
+		base, head string
+		key        rowKey
+		metric     string
+		delta      float64
+		err        string
+	}{
+		{
+			// Results predating groups are matched by cloud and machine type.
+			name:  "legacy cpu",
+			table: "cpu",
+			base: `Cloud,Date,MachineType,Cores,Single,Multi,Multi/vCPU
+				gce,20220101,n2-standard-8,8,100,800,100`,
+			head: `Cloud,Group,Date,Run,MachineType,Cores,Single,Multi,Multi/vCPU,Sanity
+				gce,pd-ssd,20230101,ori,n2-standard-8,8,110,880,110,`,
+			key:    rowKey{cloud: "gce", machine: "n2-standard-8"},
+			metric: "Multi",
+			delta:  80,
+		},
+		{
+			name:  "legacy tpcc",
+			table: "tpcc",
+			base: `Cloud,Group,Date,MachineType,Warehouses,warehousePerVCPU,Pass,TpmC,Efc
+				gce,pd-ssd,20220101,n2-standard-8,1000,125,true,12000,93.3`,
+			head: `Cloud,Group,Date,Run,MachineType,Warehouses,warehousePerVCPU,Pass,TpmC,Efc,Sanity
+				gce,pd-ssd,20230101,125-1,n2-standard-8,1000,125,true,12500,97.2,`,
+			key:    rowKey{cloud: "gce", group: "pd-ssd", machine: "n2-standard-8", job: "warehousePerVCPU=125;Warehouses=1000"},
+			metric: "TpmC",
+			delta:  500,
+		},
+		{
+			// Rows of every run, as analyzed with --runs all, are keyed by run.
+			name:  "all runs",
+			table: "cpu",
+			base: `Cloud,Group,Date,Run,MachineType,Cores,Single,Multi,Multi/vCPU,Sanity
+				gce,pd-ssd,20220101,ori,n2-standard-8,8,100,800,100,
+				gce,pd-ssd,20220101,rerun,n2-standard-8,8,100,810,100,`,
+			head: `Cloud,Group,Date,Run,MachineType,Cores,Single,Multi,Multi/vCPU,Sanity
+				gce,pd-ssd,20230101,ori,n2-standard-8,8,100,850,100,
+				gce,pd-ssd,20230101,rerun,n2-standard-8,8,100,820,100,`,
+			key:    rowKey{cloud: "gce", group: "pd-ssd", machine: "n2-standard-8", job: "Run=rerun"},
+			metric: "Multi",
+			delta:  10,
+		},
+		{
+			name:  "duplicate keys",
+			table: "cpu",
+			base: `Cloud,Date,MachineType,Cores,Single,Multi,Multi/vCPU
+				gce,20220101,n2-standard-8,8,100,800,100
+				gce,20220101,n2-standard-8,8,100,810,100`,
+			head: `Cloud,Group,Date,Run,MachineType,Cores,Single,Multi,Multi/vCPU,Sanity
+				gce,pd-ssd,20230101,ori,n2-standard-8,8,110,880,110,`,
+			err: "base cpu: several rows of gce//n2-standard-8",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			deltas, err := compareTables(tc.table, comparedTables[tc.table], csvTable(tc.base), csvTable(tc.head))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range deltas {
+				if d.status == compareAdded || d.status == compareRemoved {
+					t.Errorf("unmatched row: %s %s %s", d.key, d.metric, d.status)
+				}
+			}
+			if d := deltaOf(t, deltas, tc.key, tc.metric); d.delta != tc.delta {
+				t.Errorf("expected %s delta %v, got %v", tc.metric, tc.delta, d.delta)
+			}
+		})
+	}
+}
+
+func TestCompareFlagged(t *testing.T) {
+	key := rowKey{cloud: "gce", group: "pd-ssd", machine: "n2-standard-8"}
+	for _, tc := range []struct {
+		name       string
+		base, head string
+		noisy      bool
+		flagged    bool
+	}{
+		{
+			name:  "within threshold and noise",
+			base:  "100,90,110",
+			head:  "102,92,112",
+			noisy: true,
+		},
+		{
+			// The change is small, but beyond the run-to-run noise.
+			name:    "outside noise",
+			base:    "100,99,101",
+			head:    "102,101.5,102.5",
+			flagged: true,
+		},
+		{
+			// The change is within the noise, but exceeds the threshold.
+			name:    "exceeds threshold",
+			base:    "100,80,120",
+			head:    "110,90,130",
+			noisy:   true,
+			flagged: true,
+		},
+		{
+			// Metrics without confidence intervals are flagged by the
+			// threshold alone.
+			name: "no intervals",
+			base: "100,,",
+			head: "102,,",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			const header = "Cloud,Group,MachineType,TpmCMean,TpmCCILow,TpmCCIHigh\n"
+			base := csvTable(header + "gce,pd-ssd,n2-standard-8," + tc.base)
+			head := csvTable(header + "gce,pd-ssd,n2-standard-8," + tc.head)
+			deltas, err := compareTables("tpcc-summary", comparedTables["tpcc-summary"], base, head)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := deltaOf(t, deltas, key, "TpmCMean"); d.noisy != tc.noisy || d.flagged != tc.flagged {
+				t.Errorf("expected noisy %t and flagged %t, got %t and %t", tc.noisy, tc.flagged, d.noisy, d.flagged)
+			}
+		})
+	}
+}
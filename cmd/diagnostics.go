@@ -0,0 +1,185 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var analyzeStrict bool
+
+func init() {
+	analyzeCmd.Flags().BoolVar(&analyzeStrict, "strict", false,
+		"fail if any error was recorded while analyzing results")
+}
+
+// diagnostic is a problem encountered while analyzing results.  Errors
+// (severityError) mark results which could not be analyzed, warnings
+// suspicious results which were analyzed.  Fields identifying the run are
+// empty if not known.
+type diagnostic struct {
+	severity    string
+	cloud       string
+	group       string
+	machineType string
+	benchmark   string
+	run         string
+	file        string
+	message     string
+}
+
+// diagnosticsCollector records problems encountered by the analyzers.
+type diagnosticsCollector struct {
+	mu          sync.Mutex
+	diagnostics []diagnostic
+}
+
+// analyzeDiagnostics collects diagnostics of the analyze command.
+var analyzeDiagnostics = &diagnosticsCollector{}
+
+// add records the diagnostic.  Identical diagnostics, e.g. of results
+// reported in several tables, are recorded once.
+func (c *diagnosticsCollector) add(d diagnostic) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.diagnostics {
+		if e == d {
+			return
+		}
+	}
+
+	where := strings.Join(nonEmpty(d.cloud, d.group, d.machineType, d.benchmark, d.run), "/")
+	if d.file != "" {
+		where = d.file
+	}
+	log.Printf("%s: %s: %s", strings.ToUpper(d.severity), where, d.message)
+	c.diagnostics = append(c.diagnostics, d)
+}
+
+// runError records an error of the run, which is excluded from results.
+func (c *diagnosticsCollector) runError(id RunID, file string, err error) {
+	c.add(runDiagnostic(severityError, id, file, err.Error()))
+}
+
+// runWarning records a problem of the run, which is still analyzed.
+func (c *diagnosticsCollector) runWarning(id RunID, file string, format string, args ...interface{}) {
+	c.add(runDiagnostic(severityWarning, id, file, fmt.Sprintf(format, args...)))
+}
+
+// machineError records an error of the results of the machine type which
+// could not be attributed to a run, e.g. because the run identity could not
+// be determined.
+func (c *diagnosticsCollector) machineError(
+	b *Benchmark, cloud CloudDetails, machineType, file string, err error,
+) {
+	c.add(diagnostic{
+		severity:    severityError,
+		cloud:       cloud.Cloud,
+		group:       cloud.Group,
+		machineType: machineType,
+		benchmark:   b.Name,
+		file:        file,
+		message:     err.Error(),
+	})
+}
+
+func runDiagnostic(severity string, id RunID, file, message string) diagnostic {
+	return diagnostic{
+		severity:    severity,
+		cloud:       id.Cloud,
+		group:       id.Group,
+		machineType: id.MachineType,
+		benchmark:   id.Benchmark,
+		run:         runLabel([]runRef{{id: id}}),
+		file:        file,
+		message:     message,
+	}
+}
+
+func nonEmpty(values ...string) []string {
+	var res []string
+	for _, v := range values {
+		if v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func (c *diagnosticsCollector) count(severity string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, d := range c.diagnostics {
+		if d.severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+const errorsCSVHeader = "Severity,Cloud,Group,MachineType,Benchmark,Run,File,Message"
+
+// errorsFormats are always written, besides the requested output formats.
+var errorsFormats = []string{"csv", "json"}
+
+// write emits the errors table into the results directory, even if no
+// problems were found, so that a stale table never outlives its results.
+func (c *diagnosticsCollector) write() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	formats := append([]string(nil), errorsFormats...)
+	for _, f := range outputFormats {
+		if !containsString(formats, f) {
+			formats = append(formats, f)
+		}
+	}
+	dir := filepath.Dir(ResultsFile("errors"))
+	var wr multiResultWriter
+	for _, f := range formats {
+		w, err := resultFormats[f].newWriter(dir, "errors", strings.Split(errorsCSVHeader, ","))
+		if err != nil {
+			_ = wr.Close()
+			return err
+		}
+		wr = append(wr, w)
+	}
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		ka := []string{a.cloud, a.group, a.machineType, a.benchmark, a.run, a.file, a.severity, a.message}
+		kb := []string{b.cloud, b.group, b.machineType, b.benchmark, b.run, b.file, b.severity, b.message}
+		for k := range ka {
+			if ka[k] != kb[k] {
+				return ka[k] < kb[k]
+			}
+		}
+		return false
+	})
+	for _, d := range c.diagnostics {
+		if err := wr.Write([]interface{}{
+			d.severity, d.cloud, d.group, d.machineType, d.benchmark, d.run, d.file, d.message,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -13,9 +13,10 @@ import (
 	"bytes"
 	"fmt"
 	"hash/crc32"
+	"log"
 	"os"
 	"path"
-	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
@@ -26,12 +27,18 @@ import (
 var scriptsDir string
 var lifetime string
 var usage string
+var generateBenchNames []string
+var generateBenchmarks []*Benchmark
 
 // generateCmd represents the generate command
 var generateCmd = &cobra.Command{
 	Use:   "generate",
 	Short: "Generates scripts necessary for execution of cloud report benchmarks.",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		if generateBenchmarks, err = selectBenchmarks(generateBenchNames); err != nil {
+			return err
+		}
 		for _, cloud := range clouds {
 			if err := generateCloudScripts(cloud); err != nil {
 				return err
@@ -54,6 +61,9 @@ func init() {
 	generateCmd.Flags().StringVarP(&lifetime, "lifetime", "l",
 		"6h", "cluster lifetime")
 	generateCmd.Flags().StringVarP(&usage, "usage", "u", "cloud-report-2022", "usage label")
+	generateCmd.Flags().StringSliceVar(&generateBenchNames, "bench", nil,
+		fmt.Sprintf("comma separated list of benchmarks supported by the driver script: %s; all if not specified",
+			strings.Join(benchmarkNames(), ", ")))
 }
 
 type scriptData struct {
@@ -63,6 +73,7 @@ type scriptData struct {
 	Lifetime            string
 	Usage               string
 	MachineType         string
+	MachineTypeArg      string
 	ScriptsDir          string
 	EvaledArgs          string
 	DefaultAmi          string
@@ -70,9 +81,20 @@ type scriptData struct {
 	DefaultNodeLocation string
 	AlterNodeLocations  map[string]string
 	BenchArgs           map[string]string
+	Benchmarks          []*Benchmark
+	// Machine is the catalog entry of the machine type, if any.
+	Machine *machineInfo
+
+	args clusterArgs
 }
 
 const driverTemplate = `#!/bin/bash
+{{- with .Machine}}
+
+# {{.MachineType}}: {{.VCPUs}} vCPUs, {{.MemoryGiB}} GiB memory, {{.Arch}}
+{{- if .NetworkGbps}}, network up to {{.NetworkGbps}} Gbps{{end}}
+{{- if .DiskMBps}}, disk up to {{.DiskMBps}} MB/s{{end}}
+{{- end}}
 
 NAME_EXTRA=${NAME_EXTRA:=ori}
 
@@ -102,7 +124,7 @@ exec &> >(tee -a "$logdir/driver-$NAME_EXTRA.log")
 # Create roachprod cluster
 function create_cluster() {
   roachprod create "$CLUSTER" -n $NODES --lifetime "{{.Lifetime}}" --clouds "$CLOUD" \
-    --$CLOUD-machine-type "{{.MachineType}}" {{.DefaultNodeLocation}} {{.EvaledArgs}} {{.DefaultAmi}} \
+    --{{.MachineTypeArg}} "{{.MachineType}}" {{.DefaultNodeLocation}} {{.EvaledArgs}} {{.DefaultAmi}} \
     --label {{.Usage}}
 
   roachprod run "$CLUSTER" -- tmux new -s "$TMUX_SESSION" -d
@@ -114,7 +136,7 @@ function create_cluster() {
 # Create roachprod in us-west2
 function create_west_cluster() {
   roachprod create "$WEST_CLUSTER" -u $USER -n 1 --lifetime "{{.Lifetime}}" --clouds "$CLOUD" \
-    --$CLOUD-machine-type "{{.MachineType}}" {{.AlterNodeLocations.west}} {{.EvaledArgs}} {{.AlterAmis.west}} \
+    --{{.MachineTypeArg}} "{{.MachineType}}" {{.AlterNodeLocations.west}} {{.EvaledArgs}} {{.AlterAmis.west}} \
     --label {{.Usage}}
 
   roachprod run "$WEST_CLUSTER" -- tmux new -s "$TMUX_SESSION" -d
@@ -192,6 +214,52 @@ function results_dir() {
   echo "$logdir/$1.$(date +%Y%m%d.%T)-$NAME_EXTRA"
 }
 
+# json_escape escapes the string for inclusion in JSON.
+function json_escape() {
+  printf '%s' "$1" | sed -e 's/\\/\\\\/g' -e 's/"/\\"/g' | tr -d '\n'
+}
+
+# write_run_manifest records metadata of the benchmark run being fetched
+# in the results directory.  See runManifest in cmd/manifest.go.
+function write_run_manifest() {
+  local target_dir=$1
+  local name=''
+  local args=''
+  case "$current_bench" in
+{{- range .Benchmarks}}
+    bench_{{.Function}}) name="{{.Name}}"; args="${{.Function}}_extra_args{{if eq .Name "tpcc"}} $TPCC_EXTRA_ARGS{{end}}" ;;
+{{- end}}
+  esac
+
+  local started="null"
+  if [ -n "${bench_started[$current_bench]}" ]
+  then
+    started="\"${bench_started[$current_bench]}\""
+  fi
+  local crdb_version=$(roachprod run "$CLUSTER":1 -- ./cockroach version 2>/dev/null || true)
+  local crdb_tag=$(echo "$crdb_version" | awk -F': *' '/^Build Tag/ {print $2}')
+  local crdb_sha=$(echo "$crdb_version" | awk -F': *' '/^Build Commit ID/ {print $2}')
+  local checksums=$(cd "{{.ScriptsDir}}" && sha256sum gen/*.sh | awk '{printf "%s\"%s\": \"%s\"", sep, $2, $1; sep=", "}')
+
+  cat > "$target_dir/run.json" <<EOF
+{
+  "cloud": "$CLOUD",
+  "group": "{{.CloudDetails.Group}}",
+  "machineType": "{{.MachineType}}",
+  "benchmark": "$name",
+  "cluster": "$CLUSTER",
+  "nameExtra": "$(json_escape "$NAME_EXTRA")",
+  "nodes": $NODES,
+  "cockroachVersion": "$(json_escape "$crdb_tag")",
+  "cockroachSHA": "$(json_escape "$crdb_sha")",
+  "benchArgs": "$(json_escape "$args")",
+  "scriptChecksums": {$checksums},
+  "start": $started,
+  "end": "$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+}
+EOF
+}
+
 function copy_result_with_retry() {
   local node=$1
   local fetch_dir=$2
@@ -231,6 +299,7 @@ function copy_result_with_retry() {
      roachprod run "$CLUSTER" -- cpufetch -s legacy > "$target_dir/cpu_info.txt"
      roachprod run "$CLUSTER" -- lscpu  >> "$target_dir/cpu_info.txt"
   fi
+  write_run_manifest "$target_dir"
 }
 
 # Run CPU benchmark
@@ -398,7 +467,7 @@ function bench_intra_az_net() {
   local server_node="$CLUSTER":2
   local client_node="$CLUSTER":1
 
-  run_netperf_between_server_client $client_node $server_node $INTER_AZ_PORT intra-az "$net_extra_args"
+  run_netperf_between_server_client $client_node $server_node $INTER_AZ_PORT intra-az "$intra_az_net_extra_args"
 }
 
 # Wait for Netperf benchmark to complete and fetch results.
@@ -410,7 +479,9 @@ function fetch_bench_intra_az_net_results() {
   fi
 
   roachprod run ${CLUSTER}:1 ./scripts/gen/network-test.sh -- -w -m intra-az
-  roachprod get ${CLUSTER}:1 ./intra-az-netperf-results $(results_dir "intra-az-netperf-results")
+  target_dir=$(results_dir "intra-az-netperf-results")
+  roachprod get ${CLUSTER}:1 ./intra-az-netperf-results "$target_dir"
+  write_run_manifest "$target_dir"
 }
 
 # bench_cross_region_net is run the cross-region network tests.
@@ -426,7 +497,9 @@ function bench_cross_region_net() {
 # to finish and the fetch the results from the server node.
 function fetch_bench_cross_region_net_results() {
   roachprod run ${CLUSTER}:1 ./scripts/gen/network-test.sh -- -w -m cross-region
-  roachprod get ${CLUSTER}:1 ./cross-region-netperf-results $(results_dir "cross-region-netperf-results")
+  target_dir=$(results_dir "cross-region-netperf-results")
+  roachprod get ${CLUSTER}:1 ./cross-region-netperf-results "$target_dir"
+  write_run_manifest "$target_dir"
 }
 
 # Destroy roachprod cluster
@@ -446,19 +519,15 @@ Usage: $0 [-b <bootstrap>]... [-w <workload>]... [-d] [-c cockroach_binary]
          -b setup: execute setup script on the cluster
          -b all: all of the above steps
    -w: Specify workloads (benchmarks) to execute.
-       -w cpu : Benchmark CPU
-       -w io  : Benchmark IO
-       -w ia_net : Benchmark Net. Please don't run "ia_net" and "cr_net" on the same cluster.
-       -w cr_net : Benchmark Cross-region Net. Please don't run "ia_net" and "cr_net" on the same cluster.
-       -w tpcc: Benchmark TPCC
+{{- range .Benchmarks}}
+       -w {{.Name}} : {{.Description}}
+{{- end}}
        -w all : All of the above
    -c: Override cockroach binary to stage (local path to binary or release version)
    -r: Do not start benchmarks specified by -w.  Instead, resume waiting for their completion.
-   -I: additional IO benchmark arguments
-   -N: additional network benchmark arguments
-   -C: additional CPU benchmark arguments
-   -T: additional TPCC benchmark arguments
-   -R: additional cross-region network benchmark arguments
+{{- range .Benchmarks}}
+   -{{.ArgsFlag}}: {{.ArgsDescription}}
+{{- end}}
    -n: override number of nodes in a cluster
    -d: Destroy cluster
 "
@@ -466,19 +535,19 @@ exit 1
 }
 
 benchmarks=()
+declare -A bench_started
+current_bench=''
 f_resume=''
 do_create=''
 do_upload=''
 do_setup=''
 do_destroy=''
-io_extra_args='{{with $arg := .BenchArgs.io}}{{$arg}}{{end}}'
-cpu_extra_args='{{with $arg := .BenchArgs.cpu}}{{$arg}}{{end}}'
-tpcc_extra_args='{{with $arg := .BenchArgs.tpcc}}{{$arg}}{{end}}'
-intra_az_net_extra_args='{{with $arg := .BenchArgs.net}}{{$arg}}{{end}}'
-cross_region_net_extra_args='{{with $arg := .BenchArgs.cross_region_net}}{{$arg}}{{end}}'
+{{- range .Benchmarks}}
+{{.Function}}_extra_args='{{index $.BenchArgs .BenchArgsKey}}'
+{{- end}}
 cockroach_binary=''
 
-while getopts 'c:b:w:dn:I:N:C:T:R:r' flag; do
+while getopts 'c:b:w:dn:{{range .Benchmarks}}{{.ArgsFlag}}:{{end}}r' flag; do
   case "${flag}" in
     b) case "${OPTARG}" in
         all)
@@ -495,23 +564,19 @@ while getopts 'c:b:w:dn:I:N:C:T:R:r' flag; do
     ;;
     c) cockroach_binary="${OPTARG}" ;;
     w) case "${OPTARG}" in
-         cpu) benchmarks+=("bench_cpu") ;;
-         io) benchmarks+=("bench_io") ;;
-         ia_net) benchmarks+=("bench_intra_az_net") ;;
-         cr_net) benchmarks+=("bench_cross_region_net") ;;
-         tpcc) benchmarks+=("bench_tpcc") ;;
-         all) benchmarks+=("bench_cpu" "bench_io" "bench_tpcc" "bench_cross_region_net") ;;
+{{- range .Benchmarks}}
+         {{.Name}}) benchmarks+=("bench_{{.Function}}") ;;
+{{- end}}
+         all) benchmarks+=({{range .Benchmarks}}{{if .InAll}} "bench_{{.Function}}"{{end}}{{end}} ) ;;
          *) usage "Invalid -w value '${OPTARG}'";;
        esac
     ;;
     d) do_destroy='true' ;;
     r) f_resume='true' ;;
     n) NODES="${OPTARG}" ;;
-    I) io_extra_args="${OPTARG}" ;;
-    C) cpu_extra_args="${OPTARG}" ;;
-    T) tpcc_extra_args="${OPTARG}" ;;
-    N) intra_az_net_extra_args="${OPTARG}" ;;
-    R) cross_region_net_extra_args="${OPTARG}" ;;
+{{- range .Benchmarks}}
+    {{.ArgsFlag}}) {{.Function}}_extra_args="${OPTARG}" ;;
+{{- end}}
     *) usage ;;
   esac
 done
@@ -537,6 +602,7 @@ then
   # Execute requested benchmarks.
   for bench in "${benchmarks[@]}"
   do
+    bench_started[$bench]=$(date -u +%Y-%m-%dT%H:%M:%SZ)
     $bench
   done
 fi
@@ -546,6 +612,7 @@ for bench in "${benchmarks[@]}"
 do
   echo "Waiting for $bench to complete"
   fetch="fetch_${bench}_results"
+  current_bench=$bench
   $fetch
 done
 
@@ -595,69 +662,162 @@ func hashStrings(vals ...string) uint32 {
 	return hasher.Sum32()
 }
 
-func generateCloudScripts(cloud CloudDetails) error {
-	if err := makeAllDirs(cloud.BasePath(), cloud.ScriptDir(), cloud.LogDir()); err != nil {
-		return err
+// roachprodArg is an evaluated roachprod create argument.
+type roachprodArg struct {
+	name, val string
+	// flagOnly arguments are passed without a value.
+	flagOnly bool
+}
+
+// String returns argument quoted for use in the shell script.
+func (a roachprodArg) String() string {
+	if a.flagOnly {
+		return "--" + a.name
 	}
+	return fmt.Sprintf("--%s=%q", a.name, a.val)
+}
 
-	scriptTemplate := template.Must(template.New("script").Parse(driverTemplate))
-	for machineType, machineConfig := range cloud.MachineTypes {
-		clusterName := fmt.Sprintf("cldrprt%d-%s-%d",
-			(1+time.Now().Year())%1000, machineType,
-			hashStrings(cloud.Cloud, cloud.Group, reportVersion))
-		validClusterName := regexp.MustCompile(`[\.|\_]`)
-		clusterName = validClusterName.ReplaceAllString(clusterName, "-")
-
-		templateArgs := scriptData{
-			CloudDetails:       cloud,
-			Cluster:            clusterName,
-			Lifetime:           lifetime,
-			Usage:              fmt.Sprintf("usage=%s", usage),
-			MachineType:        machineType,
-			ScriptsDir:         scriptsDir,
-			BenchArgs:          combineArgs(machineConfig.BenchArgs, cloud.BenchArgs),
-			AlterNodeLocations: make(map[string]string),
-			AlterAmis:          make(map[string]string),
-		}
+// flag returns argument as passed to roachprod when executed directly.
+func (a roachprodArg) flag() string {
+	if a.flagOnly {
+		return "--" + a.name
+	}
+	return fmt.Sprintf("--%s=%s", a.name, a.val)
+}
 
-		// Evaluate roachprodArgs: those maybe templatized.
-		evaledArgs := make(map[string]string)
-		combinedArgs := combineArgs(machineConfig.RoachprodArgs, cloud.RoachprodArgs)
-		if err := evalArgs(combinedArgs, templateArgs, evaledArgs); err != nil {
-			return err
+func joinArgs(args []roachprodArg) string {
+	strs := make([]string, len(args))
+	for i, a := range args {
+		strs[i] = a.String()
+	}
+	return strings.Join(strs, " ")
+}
+
+func argFlags(args ...[]roachprodArg) []string {
+	var flags []string
+	for _, l := range args {
+		for _, a := range l {
+			flags = append(flags, a.flag())
 		}
+	}
+	return flags
+}
+
+// clusterArgs are roachprod create arguments for the machine type split by
+// their purpose.
+type clusterArgs struct {
+	nodeLocation []roachprodArg
+	image        []roachprodArg
+	extra        []roachprodArg
+	// Node locations and images for the alternate regions.
+	alterNodeLocations map[string][]roachprodArg
+	alterImages        map[string][]roachprodArg
+}
+
+// clusterName returns the name of the cluster used to benchmark machine type.
+func clusterName(provider Provider, cloud CloudDetails, machineType string) string {
+	return provider.ClusterName(fmt.Sprintf("cldrprt%d-%s-%d",
+		(1+time.Now().Year())%1000, machineType,
+		hashStrings(cloud.Cloud, cloud.Group, reportVersion)))
+}
+
+// newScriptData returns template arguments for the machine type driver script.
+func newScriptData(
+	provider Provider, cloud CloudDetails, machineType string, machineConfig machineConfig,
+) (scriptData, error) {
+	templateArgs := scriptData{
+		CloudDetails:       cloud,
+		Cluster:            clusterName(provider, cloud, machineType),
+		Lifetime:           lifetime,
+		Usage:              fmt.Sprintf("usage=%s", usage),
+		MachineType:        machineType,
+		MachineTypeArg:     provider.MachineTypeArg(),
+		ScriptsDir:         scriptsDir,
+		BenchArgs:          combineArgs(machineConfig.BenchArgs, cloud.BenchArgs),
+		Benchmarks:         generateBenchmarks,
+		AlterNodeLocations: make(map[string]string),
+		AlterAmis:          make(map[string]string),
+	}
+	m, err := lookupMachine(cloud.Cloud, machineType)
+	if err != nil {
+		return scriptData{}, err
+	}
+	templateArgs.Machine = m
 
-		buf := bytes.NewBuffer(nil)
-		for arg, val := range evaledArgs {
-			if buf.Len() > 0 {
-				buf.WriteByte(' ')
+	// Evaluate roachprodArgs: those maybe templatized.
+	evaledArgs := make(map[string]string)
+	combinedArgs := combineArgs(machineConfig.RoachprodArgs, cloud.RoachprodArgs)
+	if err := evalArgs(combinedArgs, templateArgs, evaledArgs); err != nil {
+		return scriptData{}, err
+	}
+
+	args := clusterArgs{
+		alterNodeLocations: make(map[string][]roachprodArg),
+		alterImages:        make(map[string][]roachprodArg),
+	}
+	names := make([]string, 0, len(evaledArgs))
+	for arg := range evaledArgs {
+		names = append(names, arg)
+	}
+	sort.Strings(names)
+
+	for _, arg := range names {
+		val := evaledArgs[arg]
+		switch {
+		case containsString(provider.ZoneArgs(), arg):
+			if !(len(val) > 0) {
+				return scriptData{}, fmt.Errorf("zone config for %s is no specified", arg)
 			}
-			switch arg {
-			case "gce-zones", "aws-zones", "azure-locations", "azure-availability-zone":
-				if !(len(val) > 0) {
-					return fmt.Errorf("zone config for %s is no specified", arg)
-				}
-				templateArgs.DefaultNodeLocation += fmt.Sprintf("--%s=%q ", arg, val)
-			case "aws-image-ami", "gce-image":
-				templateArgs.DefaultAmi = fmt.Sprintf("--%s=%q", arg, val)
-			default:
-				if region, label := analyzeAlterZone(arg); label != "" {
-					templateArgs.AlterNodeLocations[region] += fmt.Sprintf("--%s=%q ", label, val)
-				} else if region, label := analyzeAlterImage(arg); label != "" {
-					if val != "" {
-						templateArgs.AlterAmis[region] = fmt.Sprintf("--%s=%q", label, val)
-					} else {
-						templateArgs.AlterAmis[region] = ""
-					}
+			args.nodeLocation = append(args.nodeLocation, roachprodArg{name: arg, val: val})
+		case arg == provider.ImageArg():
+			args.image = []roachprodArg{{name: arg, val: val}}
+		default:
+			if region, label := analyzeAlterZone(provider, arg); label != "" {
+				args.alterNodeLocations[region] = append(args.alterNodeLocations[region],
+					roachprodArg{name: label, val: val})
+			} else if region, label := analyzeAlterImage(provider, arg); label != "" {
+				if val != "" {
+					args.alterImages[region] = []roachprodArg{{name: label, val: val}}
 				} else {
-					fmt.Fprintf(buf, "--%s", arg)
-					if len(val) > 0 {
-						fmt.Fprintf(buf, "=%q", val)
-					}
+					args.alterImages[region] = nil
 				}
+			} else {
+				args.extra = append(args.extra, roachprodArg{name: arg, val: val, flagOnly: len(val) == 0})
 			}
 		}
-		templateArgs.EvaledArgs = buf.String()
+	}
+
+	templateArgs.args = args
+	templateArgs.DefaultNodeLocation = joinArgs(args.nodeLocation)
+	templateArgs.DefaultAmi = joinArgs(args.image)
+	templateArgs.EvaledArgs = joinArgs(args.extra)
+	for region, l := range args.alterNodeLocations {
+		templateArgs.AlterNodeLocations[region] = joinArgs(l)
+	}
+	for region, l := range args.alterImages {
+		templateArgs.AlterAmis[region] = joinArgs(l)
+	}
+	return templateArgs, nil
+}
+
+func generateCloudScripts(cloud CloudDetails) error {
+	provider, err := getProvider(cloud.Cloud)
+	if err != nil {
+		return err
+	}
+	if err := makeAllDirs(cloud.BasePath(), cloud.ScriptDir(), cloud.LogDir()); err != nil {
+		return err
+	}
+
+	scriptTemplate := template.Must(template.New("script").Parse(driverTemplate))
+	for machineType, machineConfig := range cloud.MachineTypes {
+		templateArgs, err := newScriptData(provider, cloud, machineType, machineConfig)
+		if err != nil {
+			return err
+		}
+		if templateArgs.Machine == nil {
+			log.Printf("WARN: %s/%s is missing from the machine catalog", cloud.Cloud, machineType)
+		}
 
 		scriptName := path.Join(
 			cloud.ScriptDir(),
@@ -668,6 +828,10 @@ func generateCloudScripts(cloud CloudDetails) error {
 		}
 
 		if err := scriptTemplate.Execute(f, templateArgs); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
 			return err
 		}
 	}
@@ -676,30 +840,11 @@ func generateCloudScripts(cloud CloudDetails) error {
 }
 
 // analyzeAlterZone is to parse argument that may contain zone location information for an alternative region.
-func analyzeAlterZone(arg string) (string, string) {
-	gceZoneRegex := regexp.MustCompile(`^(.+)-(gce-zones)$`)
-	awsZoneRegex := regexp.MustCompile(`^(.+)-(aws-zones)$`)
-	azureLocationRegex := regexp.MustCompile(`^(.+)-(azure-locations)$`)
-	azureAzRegex := regexp.MustCompile(`^(.+)-(azure-availability-zone)$`)
-	zoneRegex := []*regexp.Regexp{gceZoneRegex, awsZoneRegex, azureLocationRegex, azureAzRegex}
-	for _, regex := range zoneRegex {
-		if regex.MatchString(arg) {
-			return regex.FindStringSubmatch(arg)[1], regex.FindStringSubmatch(arg)[2]
-		}
-	}
-	return "", ""
+func analyzeAlterZone(p Provider, arg string) (string, string) {
+	return alternateArg(arg, p.ZoneArgs()...)
 }
 
 // analyzeAlterImage is to parse argument that may contain image information for an alternative region.
-func analyzeAlterImage(arg string) (string, string) {
-	azureImageRegex := regexp.MustCompile(`^(.+)-(azure-image-ami)$`)
-	awsImageRegex := regexp.MustCompile(`^(.+)-(aws-image-ami)$`)
-	gceImageRegex := regexp.MustCompile(`^(.+)-(gce-image)$`)
-	ImageRegex := []*regexp.Regexp{azureImageRegex, awsImageRegex, gceImageRegex}
-	for _, regex := range ImageRegex {
-		if regex.MatchString(arg) {
-			return regex.FindStringSubmatch(arg)[1], regex.FindStringSubmatch(arg)[2]
-		}
-	}
-	return "", ""
+func analyzeAlterImage(p Provider, arg string) (string, string) {
+	return alternateArg(arg, p.ImageArg())
 }
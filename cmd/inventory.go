@@ -0,0 +1,445 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// cpuInventory describes the CPU of a host as reported by lscpu and, if
+// available, cpufetch.
+type cpuInventory struct {
+	arch, model, microarch                  string
+	sockets, coresPerSocket, threadsPerCore int64
+	cpus, numaNodes                         int64
+	// numaCPUs lists CPUs of each NUMA node.
+	numaCPUs         []string
+	l1d, l1i, l2, l3 string
+	flags            []string
+}
+
+func (c *cpuInventory) hasFlag(flag string) bool {
+	return containsString(c.flags, flag)
+}
+
+// generation identifies the CPU generation: the microarchitecture if known,
+// the model otherwise.
+func (c *cpuInventory) generation() string {
+	// The driver removes spaces from cpufetch output.
+	if c.microarch != "" {
+		return strings.Replace(c.microarch, " ", "", -1)
+	}
+	return c.model
+}
+
+var numaCPUsRegex = regexp.MustCompile(`^NUMA node\d+ CPU\(s\)$`)
+
+// lscpuKeys are the parsed keys of lscpu output.
+var lscpuKeys = []string{
+	"Architecture", "Model name", "Socket(s)", "Core(s) per socket", "Thread(s) per core",
+	"CPU(s)", "NUMA node(s)", "L1d cache", "L1i cache", "L2 cache", "L3 cache", "Flags",
+}
+
+// parseCPUInventory parses (possibly concatenated) output of cpufetch and
+// lscpu.  Each lscpu section produces one cpuInventory; cpufetch output,
+// which may have its spaces removed by the driver, provides the
+// microarchitecture of the corresponding section.
+func parseCPUInventory(name string, r io.Reader) ([]*cpuInventory, error) {
+	var cpus []*cpuInventory
+	var microarchs []string
+	var cur *cpuInventory
+	seen := make(map[string]bool)
+	err := scanLines(name, r, func(lineNo int, line string) error {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			return nil
+		}
+		key, val := strings.TrimSpace(line[:colon]), strings.TrimSpace(line[colon+1:])
+		// Keys of cpufetch output may be preceded by the logo.
+		cpufetchKey := strings.ToLower(strings.Replace(key, " ", "", -1))
+		if strings.HasSuffix(cpufetchKey, "microarchitecture") || strings.HasSuffix(cpufetchKey, "uarch") {
+			microarchs = append(microarchs, val)
+			return nil
+		}
+		numaCPUs := numaCPUsRegex.MatchString(key)
+		if !numaCPUs && !containsString(lscpuKeys, key) {
+			return nil
+		}
+
+		// A repeated key starts the output of the next host.
+		if cur == nil || seen[key] {
+			cur = &cpuInventory{}
+			cpus = append(cpus, cur)
+			seen = make(map[string]bool)
+		}
+		if numaCPUs {
+			cur.numaCPUs = append(cur.numaCPUs, val)
+			return nil
+		}
+		seen[key] = true
+
+		parseInt := func(v *int64) error {
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return newParseError(name, lineNo, "error parsing %s %q: %v", key, val, err)
+			}
+			*v = n
+			return nil
+		}
+		switch key {
+		case "Architecture":
+			cur.arch = val
+		case "Model name":
+			cur.model = val
+		case "Socket(s)":
+			return parseInt(&cur.sockets)
+		case "Core(s) per socket":
+			return parseInt(&cur.coresPerSocket)
+		case "Thread(s) per core":
+			return parseInt(&cur.threadsPerCore)
+		case "CPU(s)":
+			return parseInt(&cur.cpus)
+		case "NUMA node(s)":
+			return parseInt(&cur.numaNodes)
+		case "L1d cache":
+			cur.l1d = val
+		case "L1i cache":
+			cur.l1i = val
+		case "L2 cache":
+			cur.l2 = val
+		case "L3 cache":
+			cur.l3 = val
+		case "Flags":
+			cur.flags = strings.Fields(val)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(cpus) == 0 {
+		return nil, newParseError(name, 0, "no lscpu output found")
+	}
+	for i, c := range cpus {
+		switch {
+		case i < len(microarchs):
+			c.microarch = microarchs[i]
+		case len(microarchs) > 0:
+			c.microarch = microarchs[0]
+		}
+	}
+	return cpus, nil
+}
+
+// memoryInventory describes memory of a host as reported by lshw -c memory.
+type memoryInventory struct {
+	// size is the size of the system memory.
+	size string
+	// dimms lists sizes and speeds of the populated memory banks.
+	dimms []dimmInventory
+}
+
+type dimmInventory struct {
+	size, speed string
+}
+
+var dimmSpeedRegex = regexp.MustCompile(`(\d+)\s*MHz`)
+
+// parseMemoryInventory parses output of lshw -c memory.
+func parseMemoryInventory(name string, r io.Reader) (*memoryInventory, error) {
+	var mem memoryInventory
+	var section string
+	var bank *dimmInventory
+	var description string
+	endBank := func() {
+		if bank != nil && bank.size != "" {
+			if bank.speed == "" {
+				if m := dimmSpeedRegex.FindStringSubmatch(description); m != nil {
+					bank.speed = m[1] + "MHz"
+				}
+			}
+			mem.dimms = append(mem.dimms, *bank)
+		}
+		bank, description = nil, ""
+	}
+	err := scanLines(name, r, func(lineNo int, line string) error {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "*-") {
+			endBank()
+			section = strings.SplitN(line[2:], ":", 2)[0]
+			if section == "bank" {
+				bank = &dimmInventory{}
+			}
+			return nil
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			return nil
+		}
+		key, val := strings.TrimSpace(line[:colon]), strings.TrimSpace(line[colon+1:])
+		switch {
+		case section == "memory" && key == "size":
+			mem.size = val
+		case bank != nil && key == "size":
+			bank.size = val
+		case bank != nil && key == "clock":
+			if fields := strings.Fields(val); len(fields) > 0 {
+				bank.speed = fields[0]
+			}
+		case bank != nil && key == "description":
+			description = val
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	endBank()
+	if mem.size == "" && len(mem.dimms) == 0 {
+		return nil, newParseError(name, 0, "no lshw memory output found")
+	}
+	return &mem, nil
+}
+
+// distinct returns sorted distinct values joined with ";".
+func distinct(values []string) string {
+	var d []string
+	for _, v := range values {
+		if v != "" && !containsString(d, v) {
+			d = append(d, v)
+		}
+	}
+	sort.Strings(d)
+	return strings.Join(d, ";")
+}
+
+// hostInventory is the inventory of a host of a run.
+type hostInventory struct {
+	group, machineType string
+	// source is the file the inventory was read from, relative to the log
+	// directory of the machine type.
+	source string
+	node   int
+	cpu    *cpuInventory
+	mem    *memoryInventory
+}
+
+type inventoryAnalyzer struct {
+	cloud string
+	mu    sync.Mutex
+	hosts []*hostInventory
+}
+
+func newInventoryAnalyzer(cloud string) resultsAnalyzer {
+	return &inventoryAnalyzer{cloud: cloud}
+}
+
+// Analyze reads CPU and memory inventories collected by the driver when
+// setting up the cluster, and CPU inventories of all nodes collected with
+// TPC-C results.
+func (a *inventoryAnalyzer) Analyze(cloud CloudDetails) error {
+	if cloud.Cloud != a.cloud {
+		return fmt.Errorf("expected %s cloud, got %s", a.cloud, cloud.Cloud)
+	}
+	return forEachMachine(cloud, func(details CloudDetails, machineType string) error {
+		return a.analyzeMachine(details, machineType)
+	})
+}
+
+func (a *inventoryAnalyzer) analyzeMachine(cloud CloudDetails, machineType string) error {
+	logDir := path.Join(cloud.LogDir(), FormatMachineType(machineType))
+	clusterInfo, err := filepath.Glob(path.Join(logDir, "*_cpu_info.txt"))
+	if err != nil {
+		return err
+	}
+	runInfo, err := filepath.Glob(path.Join(logDir, "*", "cpu_info.txt"))
+	if err != nil {
+		return err
+	}
+	for _, p := range append(clusterInfo, runInfo...) {
+		var cpus []*cpuInventory
+		if err := parseFile(p, func(name string, r io.Reader) (err error) {
+			cpus, err = parseCPUInventory(name, r)
+			return err
+		}); err != nil {
+			analyzeDiagnostics.add(a.diagnostic(cloud, machineType, p, "failed to parse cpu inventory: %v", err))
+			continue
+		}
+
+		// Memory is only collected from the first node of the cluster.
+		var mem *memoryInventory
+		if strings.HasSuffix(p, "_cpu_info.txt") {
+			ramInfo := strings.TrimSuffix(p, "_cpu_info.txt") + "_ram_info.txt"
+			if err := parseFile(ramInfo, func(name string, r io.Reader) (err error) {
+				mem, err = parseMemoryInventory(name, r)
+				return err
+			}); err != nil {
+				analyzeDiagnostics.add(a.diagnostic(cloud, machineType, ramInfo,
+					"failed to parse memory inventory: %v", err))
+			}
+		}
+
+		source, err := filepath.Rel(logDir, p)
+		if err != nil {
+			return err
+		}
+		for i, cpu := range cpus {
+			h := &hostInventory{
+				group:       cloud.Group,
+				machineType: machineType,
+				source:      source,
+				node:        i + 1,
+				cpu:         cpu,
+			}
+			if i == 0 {
+				h.mem = mem
+			}
+			a.mu.Lock()
+			a.hosts = append(a.hosts, h)
+			a.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// diagnostic returns a warning about the inventory of the machine type;
+// inventory problems do not affect benchmark results.
+func (a *inventoryAnalyzer) diagnostic(
+	cloud CloudDetails, machineType, file string, format string, args ...interface{},
+) diagnostic {
+	return diagnostic{
+		severity:    severityWarning,
+		cloud:       cloud.Cloud,
+		group:       cloud.Group,
+		machineType: machineType,
+		benchmark:   "inventory",
+		file:        file,
+		message:     fmt.Sprintf(format, args...),
+	}
+}
+
+// inventoryKey identifies the machine type of a group.
+type inventoryKey struct {
+	group, machineType string
+}
+
+// generations returns CPU generations observed on each machine type of every
+// group.  Hosts without cpufetch output take the microarchitecture of other
+// hosts with the same model.
+func (a *inventoryAnalyzer) generations() map[inventoryKey][]string {
+	microarchs := make(map[string]string)
+	for _, h := range a.hosts {
+		if h.cpu.microarch != "" {
+			microarchs[h.cpu.model] = h.cpu.microarch
+		}
+	}
+	generations := make(map[inventoryKey][]string)
+	for _, h := range a.hosts {
+		g := h.cpu.generation()
+		if h.cpu.microarch == "" && microarchs[h.cpu.model] != "" {
+			g = (&cpuInventory{microarch: microarchs[h.cpu.model]}).generation()
+		}
+		k := inventoryKey{group: h.group, machineType: h.machineType}
+		if g != "" && !containsString(generations[k], g) {
+			generations[k] = append(generations[k], g)
+		}
+	}
+	for _, g := range generations {
+		sort.Strings(g)
+	}
+	return generations
+}
+
+const inventoryCSVHeader = "Cloud,Group,MachineType,Source,Node,Arch,Model,Microarchitecture," +
+	"Sockets,CoresPerSocket,ThreadsPerCore,CPUs,NumaNodes,NumaCPUs,L1d,L1i,L2,L3," +
+	"AVX512,AVX512VNNI,AMX,Memory,DIMMs,DIMMSize,DIMMSpeed,MixedGenerations"
+
+func (a *inventoryAnalyzer) Close() (err error) {
+	if len(a.hosts) == 0 {
+		return nil
+	}
+	generations := a.generations()
+	var mixed []inventoryKey
+	for k, g := range generations {
+		if len(g) > 1 {
+			mixed = append(mixed, k)
+		}
+	}
+	sort.Slice(mixed, func(i, j int) bool {
+		if mixed[i].group != mixed[j].group {
+			return mixed[i].group < mixed[j].group
+		}
+		return mixed[i].machineType < mixed[j].machineType
+	})
+	for _, k := range mixed {
+		analyzeDiagnostics.add(a.diagnostic(CloudDetails{Cloud: a.cloud, Group: k.group}, k.machineType, "",
+			"runs landed on different CPU generations: %s", strings.Join(generations[k], ", ")))
+	}
+
+	wr, err := newResultWriter("inventory", strings.Split(inventoryCSVHeader, ","), a.cloud)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	sort.SliceStable(a.hosts, func(i, j int) bool {
+		hi, hj := a.hosts[i], a.hosts[j]
+		if hi.group != hj.group {
+			return hi.group < hj.group
+		}
+		if hi.machineType != hj.machineType {
+			return hi.machineType < hj.machineType
+		}
+		if hi.source != hj.source {
+			return hi.source < hj.source
+		}
+		return hi.node < hj.node
+	})
+	for _, h := range a.hosts {
+		c := h.cpu
+		fields := []interface{}{
+			a.cloud, h.group, h.machineType, h.source, h.node,
+			c.arch, c.model, c.microarch,
+			c.sockets, c.coresPerSocket, c.threadsPerCore, c.cpus, c.numaNodes,
+			strings.Join(c.numaCPUs, ";"),
+			c.l1d, c.l1i, c.l2, c.l3,
+			c.hasFlag("avx512f"), c.hasFlag("avx512_vnni"), c.hasFlag("amx_tile"),
+		}
+		if h.mem != nil {
+			var sizes, speeds []string
+			for _, d := range h.mem.dimms {
+				sizes = append(sizes, d.size)
+				speeds = append(speeds, d.speed)
+			}
+			fields = append(fields, h.mem.size, len(h.mem.dimms), distinct(sizes), distinct(speeds))
+		} else {
+			fields = append(fields, nil, nil, nil, nil)
+		}
+		fields = append(fields, len(generations[inventoryKey{group: h.group, machineType: h.machineType}]) > 1)
+		if err := wr.Write(fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ resultsAnalyzer = &inventoryAnalyzer{}
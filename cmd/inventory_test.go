@@ -0,0 +1,85 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestInventoryMixedGenerations verifies that CPU generations are compared
+// among hosts of the same group and machine type.
+func TestInventoryMixedGenerations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedOutputDir, savedVersion, savedFormats := baseOutputDir, reportVersion, outputFormats
+	savedDiagnostics := analyzeDiagnostics
+	defer func() {
+		baseOutputDir, reportVersion, outputFormats = savedOutputDir, savedVersion, savedFormats
+		analyzeDiagnostics = savedDiagnostics
+	}()
+	baseOutputDir, reportVersion, outputFormats = dir, "20220101", []string{"csv"}
+	analyzeDiagnostics = &diagnosticsCollector{}
+
+	cascadeLake := &cpuInventory{model: "Intel(R) Xeon(R) CPU @ 2.80GHz", microarch: "Cascade Lake"}
+	iceLake := &cpuInventory{model: "Intel(R) Xeon(R) CPU @ 2.60GHz", microarch: "Ice Lake"}
+	// The microarchitecture of hosts without cpufetch output is taken from
+	// hosts with the same model.
+	iceLakeModel := &cpuInventory{model: iceLake.model}
+	a := &inventoryAnalyzer{cloud: "gce", hosts: []*hostInventory{
+		{group: "pd-ssd", machineType: "n2-standard-8", source: "a", node: 1, cpu: cascadeLake},
+		{group: "pd-balanced", machineType: "n2-standard-8", source: "b", node: 1, cpu: iceLake},
+		{group: "pd-ssd", machineType: "n2-standard-16", source: "c", node: 1, cpu: cascadeLake},
+		{group: "pd-ssd", machineType: "n2-standard-16", source: "d", node: 1, cpu: iceLakeModel},
+	}}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []diagnostic{{
+		severity:    severityWarning,
+		cloud:       "gce",
+		group:       "pd-ssd",
+		machineType: "n2-standard-16",
+		benchmark:   "inventory",
+		message:     "runs landed on different CPU generations: CascadeLake, IceLake",
+	}}
+	if !reflect.DeepEqual(analyzeDiagnostics.diagnostics, want) {
+		t.Errorf("expected diagnostics %+v, got %+v", want, analyzeDiagnostics.diagnostics)
+	}
+
+	f, err := os.Open(ResultsFile("inventory.csv", "gce"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixed := make(map[string]string)
+	for _, r := range records[1:] {
+		mixed[r[1]+"/"+r[2]+"/"+r[3]] = r[len(r)-1]
+	}
+	if exp := map[string]string{
+		"pd-balanced/n2-standard-8/b": "false",
+		"pd-ssd/n2-standard-8/a":      "false",
+		"pd-ssd/n2-standard-16/c":     "true",
+		"pd-ssd/n2-standard-16/d":     "true",
+	}; !reflect.DeepEqual(mixed, exp) {
+		t.Errorf("expected MixedGenerations %v, got %v", exp, mixed)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runManifestFile is the name of the manifest written by the driver into
+// every results directory.
+const runManifestFile = "run.json"
+
+// runManifest describes the benchmark run which produced the results in
+// the directory.  Analyzers prefer the manifest over the identity inferred
+// from the results path, which is only used for results of older drivers.
+type runManifest struct {
+	Cloud       string `json:"cloud"`
+	Group       string `json:"group"`
+	MachineType string `json:"machineType"`
+	Benchmark   string `json:"benchmark"`
+	Cluster     string `json:"cluster"`
+	NameExtra   string `json:"nameExtra"`
+	Nodes       int    `json:"nodes"`
+	// CockroachVersion and CockroachSHA are the build tag and commit of the
+	// staged cockroach binary, if known.
+	CockroachVersion string `json:"cockroachVersion,omitempty"`
+	CockroachSHA     string `json:"cockroachSHA,omitempty"`
+	BenchArgs        string `json:"benchArgs"`
+	// ScriptChecksums maps benchmark scripts, relative to the scripts
+	// directory, to their SHA-256 checksums.
+	ScriptChecksums map[string]string `json:"scriptChecksums"`
+	// Start is unknown if the driver only fetched results of the run.
+	Start *time.Time `json:"start"`
+	End   *time.Time `json:"end"`
+	// SearchProbe identifies runs of the TPC-C capacity search.
+	SearchProbe *tpccSearchProbe `json:"searchProbe,omitempty"`
+}
+
+// readRunManifest reads the manifest of the results directory.  Nil
+// manifest is returned if the directory does not have one.
+func readRunManifest(dir string) (*runManifest, error) {
+	p := path.Join(dir, runManifestFile)
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m runManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	return &m, nil
+}
+
+func writeRunManifest(dir string, m *runManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(dir, runManifestFile), append(data, '\n'), 0644)
+}
+
+// scriptChecksums returns checksums of the benchmark scripts in the
+// scripts directory.
+func scriptChecksums(scriptsDir string) (map[string]string, error) {
+	files, err := filepath.Glob(path.Join(scriptsDir, "gen", "*.sh"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	checksums := make(map[string]string)
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		rel, err := filepath.Rel(scriptsDir, f)
+		if err != nil {
+			return nil, err
+		}
+		checksums[filepath.ToSlash(rel)] = hex.EncodeToString(sum[:])
+	}
+	return checksums, nil
+}
+
+// parseCockroachVersion extracts build tag and commit from the output of
+// "cockroach version".
+func parseCockroachVersion(out string) (version, sha string) {
+	for _, line := range strings.Split(out, "\n") {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		val := strings.TrimSpace(line[colon+1:])
+		switch strings.TrimSpace(line[:colon]) {
+		case "Build Tag":
+			version = val
+		case "Build Commit ID":
+			sha = val
+		}
+	}
+	return version, sha
+}
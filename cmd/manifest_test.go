@@ -0,0 +1,100 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Results of older drivers do not have the manifest.
+	if m, err := readRunManifest(dir); m != nil || err != nil {
+		t.Errorf("expected no manifest, got %+v, %v", m, err)
+	}
+
+	start := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	want := &runManifest{
+		Cloud:            "gce",
+		Group:            "pd-ssd",
+		MachineType:      "n2-standard-8",
+		Benchmark:        "tpcc",
+		Cluster:          "cldrprt22-gce-n2-standard-8-pd-ssd",
+		NameExtra:        "base-search-3",
+		Nodes:            4,
+		CockroachVersion: "v21.2.3",
+		CockroachSHA:     "1a2b3c",
+		BenchArgs:        "-w 1000",
+		ScriptChecksums:  map[string]string{"gen/tpcc.sh": "abc"},
+		Start:            &start,
+		End:              &end,
+		SearchProbe:      &tpccSearchProbe{Search: "base", Probe: 3, Active: 500, Repeat: 1},
+	}
+	if err := writeRunManifest(dir, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readRunManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, runManifestFile), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRunManifest(dir); err == nil || !strings.Contains(err.Error(), runManifestFile) {
+		t.Errorf("expected error of %s, got %v", runManifestFile, err)
+	}
+}
+
+// TestParseNetperfLogTestMode verifies that the test mode of netperf
+// results is that of the benchmark of the run, whatever the name of the
+// results directory.
+func TestParseNetperfLogTestMode(t *testing.T) {
+	dir, cleanup := newCacheTest(t)
+	defer cleanup()
+	savedCatalog := catalog
+	defer func() { catalog = savedCatalog }()
+	catalog, analyzeCache = &machineCatalog{}, nil
+
+	run := filepath.Join(dir, "gce", "pd-ssd", "logs", "n2-standard-8", "netperf-results.rerun")
+	copyTestdata(t, run, map[string]string{
+		"netperf-results.log":           "netperf/netperf-results.log",
+		"netperf_draw_plot_overall.svg": "coremark/empty.log",
+	})
+	for bench, mode := range map[string]string{"ia_net": "intra-az", "cr_net": "cross-region"} {
+		id := RunID{Cloud: "gce", Group: "pd-ssd", MachineType: "n2-standard-8", Benchmark: bench}
+		var res networkResult
+		if err := parseNetperfLog(filepath.Join(run, "netperf-results.log"), &res, id); err != nil {
+			t.Fatal(err)
+		}
+		if res.testMode != mode {
+			t.Errorf("%s: expected test mode %s, got %s", bench, mode, res.testMode)
+		}
+	}
+	id := RunID{Cloud: "gce", Group: "pd-ssd", MachineType: "n2-standard-8", Benchmark: "cpu"}
+	if err := parseNetperfLog(filepath.Join(run, "netperf-results.log"), &networkResult{}, id); err == nil {
+		t.Errorf("expected error parsing netperf log of cpu run")
+	}
+}
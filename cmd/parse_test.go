@@ -0,0 +1,306 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkParseError verifies that err is a parseError of the file at the
+// line, whose message contains msg.
+func checkParseError(t *testing.T, err error, file string, line int, msg string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected error %q at %s:%d, got none", msg, file, line)
+	}
+	var pe *parseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected parseError, got %T: %v", err, err)
+	}
+	if pe.file != file || pe.line != line {
+		t.Errorf("expected error at %s:%d, got %s:%d: %v", file, line, pe.file, pe.line, err)
+	}
+	if !strings.Contains(err.Error(), msg) {
+		t.Errorf("expected error containing %q, got %q", msg, err)
+	}
+}
+
+// parseTestdata parses the file of the testdata directory with parse.
+func parseTestdata(t *testing.T, file string, parse func(name string, r io.Reader) error) error {
+	t.Helper()
+	return parseFile(filepath.Join("testdata", file), parse)
+}
+
+func TestParseCoremarkOutput(t *testing.T) {
+	for _, tc := range []struct {
+		file  string
+		cores int64
+		iters float64
+		// errLine and errMsg describe the expected parseError.
+		errLine int
+		errMsg  string
+	}{
+		{file: "coremark/single.log", cores: 1, iters: 39132.713296},
+		{file: "coremark/multi.log", cores: 8, iters: 267230.820621},
+		{file: "coremark/truncated.log", errLine: 16, errMsg: `expected "CoreMark ... : <iterations/sec>"`},
+		{file: "coremark/bad-cores.log", errLine: 46, errMsg: `error parsing cores "eight"`},
+		{file: "coremark/empty.log", errMsg: "no coremark output found"},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			var cores int64
+			var iters float64
+			err := parseTestdata(t, tc.file, func(name string, r io.Reader) (err error) {
+				cores, iters, err = parseCoremarkOutput(name, r)
+				return err
+			})
+			if tc.errMsg != "" {
+				checkParseError(t, err, filepath.Join("testdata", tc.file), tc.errLine, tc.errMsg)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cores != tc.cores || iters != tc.iters {
+				t.Errorf("expected %d cores and %f iterations/sec, got %d and %f",
+					tc.cores, tc.iters, cores, iters)
+			}
+		})
+	}
+}
+
+func TestParseStartTimeFromLog(t *testing.T) {
+	want := time.Date(2022, 1, 10, 7, 33, 17, 0, time.UTC)
+	for _, tc := range []struct {
+		date string
+		err  bool
+	}{
+		{date: "Mon Jan 10 07:33:17 UTC 2022"},
+		{date: "Mon 10 Jan 2022 07:33:17 AM UTC"},
+		{date: "2022-01-10 07:33:17", err: true},
+	} {
+		t.Run(tc.date, func(t *testing.T) {
+			var res networkResult
+			content := "********** start multistream_netperf.sh " + tc.date + "************\n"
+			err := parseStartTimeFromLog("netperf.log", content, &res)
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error, got %s", res.dateTime)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !res.dateTime.Equal(want) {
+				t.Errorf("expected %s, got %s", want, res.dateTime)
+			}
+		})
+	}
+}
+
+func TestParseCPUInventory(t *testing.T) {
+	cascadeLake := &cpuInventory{
+		arch:           "x86_64",
+		model:          "Intel(R) Xeon(R) CPU @ 2.80GHz",
+		microarch:      "CascadeLake",
+		sockets:        1,
+		coresPerSocket: 4,
+		threadsPerCore: 2,
+		cpus:           8,
+		numaNodes:      1,
+		numaCPUs:       []string{"0-7"},
+		l1d:            "128 KiB",
+		l1i:            "128 KiB",
+		l2:             "4 MiB",
+		l3:             "33 MiB",
+	}
+	iceLake := &cpuInventory{
+		arch:           "x86_64",
+		model:          "Intel(R) Xeon(R) Platinum 8375C CPU @ 2.90GHz",
+		microarch:      "Ice Lake",
+		sockets:        2,
+		coresPerSocket: 8,
+		threadsPerCore: 2,
+		cpus:           32,
+		numaNodes:      2,
+		numaCPUs:       []string{"0-7,16-23", "8-15,24-31"},
+		l1d:            "768 KiB",
+		l1i:            "512 KiB",
+		l2:             "20 MiB",
+		l3:             "108 MiB",
+	}
+	for _, tc := range []struct {
+		file string
+		cpus []*cpuInventory
+		// flags are expected to be reported by every host.
+		flags   []string
+		errLine int
+		errMsg  string
+	}{
+		{file: "cpu_info/single-host.txt", cpus: []*cpuInventory{cascadeLake},
+			flags: []string{"avx512f", "avx512_vnni"}},
+		{file: "cpu_info/two-hosts.txt", cpus: []*cpuInventory{iceLake, iceLake},
+			flags: []string{"avx512f", "sha_ni"}},
+		{file: "cpu_info/bad-sockets.txt", errLine: 19, errMsg: `error parsing Socket(s) "-"`},
+		{file: "coremark/single.log", errMsg: "no lscpu output found"},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			var cpus []*cpuInventory
+			err := parseTestdata(t, tc.file, func(name string, r io.Reader) (err error) {
+				cpus, err = parseCPUInventory(name, r)
+				return err
+			})
+			if tc.errMsg != "" {
+				checkParseError(t, err, filepath.Join("testdata", tc.file), tc.errLine, tc.errMsg)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(cpus) != len(tc.cpus) {
+				t.Fatalf("expected %d hosts, got %d", len(tc.cpus), len(cpus))
+			}
+			for i, c := range cpus {
+				for _, f := range tc.flags {
+					if !c.hasFlag(f) {
+						t.Errorf("host %d: expected flag %s in %v", i, f, c.flags)
+					}
+				}
+				got := *c
+				got.flags = nil
+				if !reflect.DeepEqual(&got, tc.cpus[i]) {
+					t.Errorf("host %d: expected %+v, got %+v", i, tc.cpus[i], &got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLscpuOutput(t *testing.T) {
+	for _, tc := range []struct {
+		file   string
+		cpus   []cpuInfo
+		errMsg string
+	}{
+		{file: "cpu_info/single-host.txt",
+			cpus: []cpuInfo{{numaNodes: 1, modelName: "Intel(R) Xeon(R) CPU @ 2.80GHz"}}},
+		{file: "cpu_info/two-hosts.txt", cpus: []cpuInfo{
+			{numaNodes: 2, modelName: "Intel(R) Xeon(R) Platinum 8375C CPU @ 2.90GHz"},
+			{numaNodes: 2, modelName: "Intel(R) Xeon(R) Platinum 8375C CPU @ 2.90GHz"},
+		}},
+		{file: "cpu_info/no-model.txt", errMsg: "expected NUMA node count and model name of every host"},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			var cpus []cpuInfo
+			err := parseTestdata(t, tc.file, func(name string, r io.Reader) (err error) {
+				cpus, err = parseLscpuOutput(name, r)
+				return err
+			})
+			if tc.errMsg != "" {
+				checkParseError(t, err, filepath.Join("testdata", tc.file), 0, tc.errMsg)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cpus, tc.cpus) {
+				t.Errorf("expected %+v, got %+v", tc.cpus, cpus)
+			}
+		})
+	}
+}
+
+func TestParseMemoryInventory(t *testing.T) {
+	for _, tc := range []struct {
+		file   string
+		mem    *memoryInventory
+		errMsg string
+	}{
+		// The speed of banks without clock is read from their description.
+		{file: "ram_info/lshw.txt", mem: &memoryInventory{size: "32GiB", dimms: []dimmInventory{
+			{size: "16GiB", speed: "2933MHz"}, {size: "16GiB"},
+		}}},
+		{file: "ram_info/dimm-clock.txt", mem: &memoryInventory{size: "64GiB", dimms: []dimmInventory{
+			{size: "32GiB", speed: "3200MHz"}, {size: "32GiB", speed: "3200MHz"},
+		}}},
+		{file: "ram_info/no-memory.txt", errMsg: "no lshw memory output found"},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			var mem *memoryInventory
+			err := parseTestdata(t, tc.file, func(name string, r io.Reader) (err error) {
+				mem, err = parseMemoryInventory(name, r)
+				return err
+			})
+			if tc.errMsg != "" {
+				checkParseError(t, err, filepath.Join("testdata", tc.file), 0, tc.errMsg)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(mem, tc.mem) {
+				t.Errorf("expected %+v, got %+v", tc.mem, mem)
+			}
+		})
+	}
+}
+
+func TestParseTPCCOutput(t *testing.T) {
+	for _, tc := range []struct {
+		file    string
+		run     *tpccRun
+		errLine int
+		errMsg  string
+	}{
+		{file: "tpcc/results.txt", run: &tpccRun{
+			tpmC: 30733.3, efc: 95.6, avg: 180.8, p50: 167.8, p90: 369.1, p95: 419.4, p99: 570.4, pMax: 1677.7,
+			warehouses: 1000,
+			txns: map[string]*tpccTxnStats{
+				"delivery":    {avg: 21.4, p50: 19.9, p95: 31.5, p99: 41.9, pMax: 121.6},
+				"newOrder":    {avg: 38.9, p50: 33.6, p95: 67.1, p99: 88.1, pMax: 453.0},
+				"orderStatus": {avg: 5.1, p50: 4.7, p95: 9.4, p99: 12.1, pMax: 60.8},
+				"payment":     {avg: 17.9, p50: 16.3, p95: 33.6, p99: 46.1, pMax: 285.2},
+				"stockLevel":  {avg: 20.1, p50: 18.9, p95: 35.7, p99: 46.1, pMax: 104.9},
+			},
+		}},
+		{file: "tpcc/truncated.txt", errLine: 14, errMsg: `error parsing "stockLevel"`},
+		{file: "tpcc/bad-txn.txt", errLine: 18, errMsg: `error parsing "3x.6"`},
+		{file: "tpcc/bad-tpmc.txt", errLine: 34, errMsg: `error parsing "30733,3"`},
+		{file: "tpcc/no-init.txt", errLine: 1, errMsg: `expected "Initializing <n> connections"`},
+		{file: "tpcc/bad-conns.txt", errLine: 1, errMsg: `error parsing connections "many"`},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			var run *tpccRun
+			err := parseTestdata(t, tc.file, func(name string, r io.Reader) (err error) {
+				run, err = parseTPCCOutput(name, r)
+				return err
+			})
+			if tc.errMsg != "" {
+				checkParseError(t, err, filepath.Join("testdata", tc.file), tc.errLine, tc.errMsg)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(run, tc.run) {
+				t.Errorf("expected %+v, got %+v", tc.run, run)
+				for name, txn := range run.txns {
+					t.Logf("%s: %+v", name, txn)
+				}
+			}
+		})
+	}
+}
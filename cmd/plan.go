@@ -0,0 +1,194 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Flags of the commands planning driver invocations.
+var planCockroachBinary string
+var planJSON bool
+var planFile string
+
+func addDriverPlanFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&planCockroachBinary, "cockroach-binary", "c", "",
+		"cockroach binary passed to the driver via -c")
+	cmd.Flags().BoolVar(&planJSON, "json", false, "emit the plan as JSON instead of a shell script")
+	cmd.Flags().StringVar(&planFile, "plan-file", "-", `path to the plan, "-" for stdout`)
+}
+
+// planReason describes why the benchmark is run.
+type planReason struct {
+	Benchmark string `json:"benchmark"`
+	// Run is the results directory of the checked run, if any.
+	Run    string `json:"run,omitempty"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// driverInvocation is a single invocation of the driver script.
+type driverInvocation struct {
+	Cloud         string       `json:"cloud"`
+	Group         string       `json:"group"`
+	MachineType   string       `json:"machineType"`
+	Script        string       `json:"script"`
+	Workloads     []string     `json:"workloads"`
+	NameExtra     string       `json:"nameExtra"`
+	TPCCExtraArgs string       `json:"tpccExtraArgs,omitempty"`
+	Command       string       `json:"command"`
+	Reasons       []planReason `json:"reasons"`
+}
+
+func newDriverInvocation(cloud CloudDetails, machineType, nameExtra, tpccArgs string) *driverInvocation {
+	script := path.Join(cloud.ScriptDir(), FormatMachineType(machineType)+".sh")
+	if !filepath.IsAbs(script) {
+		script = "./" + script
+	}
+	return &driverInvocation{
+		Cloud:         cloud.Cloud,
+		Group:         cloud.Group,
+		MachineType:   machineType,
+		Script:        script,
+		NameExtra:     nameExtra,
+		TPCCExtraArgs: tpccArgs,
+	}
+}
+
+// add adds the benchmark to the invocation.
+func (inv *driverInvocation) add(reason planReason) {
+	if !containsString(inv.Workloads, reason.Benchmark) {
+		inv.Workloads = append(inv.Workloads, reason.Benchmark)
+	}
+	inv.Reasons = append(inv.Reasons, reason)
+}
+
+func (inv *driverInvocation) command() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "CRL_USERNAME=$USER NAME_EXTRA=%s", inv.NameExtra)
+	if inv.TPCCExtraArgs != "" {
+		fmt.Fprintf(&sb, " TPCC_EXTRA_ARGS='%s'", inv.TPCCExtraArgs)
+	}
+	fmt.Fprintf(&sb, " %s -b all", inv.Script)
+	for _, w := range inv.Workloads {
+		fmt.Fprintf(&sb, " -w %s", w)
+	}
+	if planCockroachBinary != "" {
+		fmt.Fprintf(&sb, " -c %s", planCockroachBinary)
+	}
+	sb.WriteString(" -d")
+	return sb.String()
+}
+
+// tpccExtraArgs returns TPCC_EXTRA_ARGS of the TPC-C experiment run with
+// the <warehousePerVCPU>-<run> label, as set by run_tpcc_experiment.sh:
+// loads of 1000 and more are the number of active warehouses.
+func tpccExtraArgs(label string) string {
+	l := tpccLabelRegex.FindStringSubmatch(label)
+	if l == nil {
+		return ""
+	}
+	if atoiOrZero(l[1]) < 1000 {
+		return "-a " + l[1]
+	}
+	return "-A " + l[1]
+}
+
+// lessRunLabel orders TPC-C experiment labels numerically.
+func lessRunLabel(a, b string) bool {
+	la, lb := tpccLabelRegex.FindStringSubmatch(a), tpccLabelRegex.FindStringSubmatch(b)
+	if la == nil || lb == nil {
+		return a < b
+	}
+	if la[1] != lb[1] {
+		return atoiOrZero(la[1]) < atoiOrZero(lb[1])
+	}
+	return atoiOrZero(la[2]) < atoiOrZero(lb[2])
+}
+
+// writeDriverPlan writes the plan as specified by the plan flags.  What
+// describes the planned runs.
+func writeDriverPlan(plan []*driverInvocation, what string) (err error) {
+	for _, inv := range plan {
+		inv.Command = inv.command()
+	}
+
+	out := io.Writer(os.Stdout)
+	if planFile != "-" {
+		f, err := os.OpenFile(planFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		out = f
+	}
+
+	if planJSON {
+		if plan == nil {
+			plan = []*driverInvocation{}
+		}
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := out.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	} else {
+		if err := writeDriverScript(out, plan, what); err != nil {
+			return err
+		}
+	}
+	if planFile != "-" {
+		fmt.Printf("Planned %d %s in %s\n", len(plan), what, planFile)
+	}
+	return nil
+}
+
+// writeDriverScript writes the plan as a shell script, one driver invocation
+// per line, preceded by the reasons for the run.
+func writeDriverScript(out io.Writer, plan []*driverInvocation, what string) error {
+	lines := []string{
+		"#!/bin/bash",
+		fmt.Sprintf("# %s planned by cloud-report.", strings.ToUpper(what[:1])+what[1:]),
+		"# Every invocation creates, benchmarks and destroys its own cluster;",
+		"# consider running them concurrently, e.g. in separate tmux windows.",
+	}
+	if len(plan) == 0 {
+		lines = append(lines, fmt.Sprintf("# No %s needed.", what))
+	}
+	for _, inv := range plan {
+		lines = append(lines, "")
+		for _, r := range inv.Reasons {
+			reason := fmt.Sprintf("# %s/%s/%s %s: %s", inv.Cloud, inv.Group, inv.MachineType, r.Benchmark, r.Reason)
+			if r.Detail != "" {
+				reason += " (" + strings.Replace(r.Detail, "\n", " ", -1) + ")"
+			} else if r.Run != "" {
+				reason += " (" + r.Run + ")"
+			}
+			lines = append(lines, reason)
+		}
+		lines = append(lines, inv.Command)
+	}
+	_, err := io.WriteString(out, strings.Join(lines, "\n")+"\n")
+	return err
+}
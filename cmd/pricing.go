@@ -0,0 +1,365 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hoursPerMonth is used to convert monthly storage prices to hourly prices.
+const hoursPerMonth = 730
+
+// Pricing terms reported by the price-performance analysis.
+const (
+	termOnDemand = "on-demand"
+	term1Year    = "1y"
+	term3Year    = "3y"
+)
+
+var pricingTerms = []string{termOnDemand, term1Year, term3Year}
+
+// machinePrice is the hourly price of a machine type in a region.
+// Committed prices are the effective hourly prices under 1 or 3 year
+// commitment; zero if not available.
+type machinePrice struct {
+	Cloud       string  `json:"cloud"`
+	Region      string  `json:"region"`
+	MachineType string  `json:"machineType"`
+	OnDemand    float64 `json:"onDemand"`
+	Commit1Y    float64 `json:"commit1y"`
+	Commit3Y    float64 `json:"commit3y"`
+}
+
+func (p *machinePrice) hourly(term string) float64 {
+	switch term {
+	case termOnDemand:
+		return p.OnDemand
+	case term1Year:
+		return p.Commit1Y
+	case term3Year:
+		return p.Commit3Y
+	default:
+		return 0
+	}
+}
+
+// storagePrice is the monthly price of the storage used by the cloud
+// details group in a region.  Provisioned IOPS and throughput above the
+// included baseline are charged separately.  Storage prices do not depend
+// on the pricing term.
+type storagePrice struct {
+	Cloud        string  `json:"cloud"`
+	Region       string  `json:"region"`
+	Group        string  `json:"group"`
+	PerGBMonth   float64 `json:"perGBMonth"`
+	PerIOPSMonth float64 `json:"perIOPSMonth"`
+	IncludedIOPS float64 `json:"includedIOPS"`
+	PerMBpsMonth float64 `json:"perMBpsMonth"`
+	IncludedMBps float64 `json:"includedMBps"`
+}
+
+// pricingCatalog is the offline catalog of machine and storage prices
+// loaded from the --pricing file.  Entries with an empty region apply to
+// all regions.
+type pricingCatalog struct {
+	Currency string         `json:"currency"`
+	Machines []machinePrice `json:"machines"`
+	Storage  []storagePrice `json:"storage"`
+}
+
+var pricingFile string
+
+// tpccNodes is the number of CockroachDB nodes in the TPC-C cluster.
+var tpccNodes = 3
+
+func loadPricingCatalog(p string) (*pricingCatalog, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var c pricingCatalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	if c.Currency == "" {
+		c.Currency = "USD"
+	}
+	return &c, nil
+}
+
+func (c *pricingCatalog) machinePrice(cloud, region, machineType string) *machinePrice {
+	var fallback *machinePrice
+	for i := range c.Machines {
+		m := &c.Machines[i]
+		if m.Cloud != cloud || m.MachineType != machineType {
+			continue
+		}
+		if m.Region == region {
+			return m
+		}
+		if m.Region == "" {
+			fallback = m
+		}
+	}
+	return fallback
+}
+
+func (c *pricingCatalog) storagePrice(cloud, region, group string) *storagePrice {
+	var fallback *storagePrice
+	for i := range c.Storage {
+		s := &c.Storage[i]
+		if s.Cloud != cloud || s.Group != group {
+			continue
+		}
+		if s.Region == region {
+			return s
+		}
+		if s.Region == "" {
+			fallback = s
+		}
+	}
+	return fallback
+}
+
+// perfMetric is a benchmark result which can be related to its cost.
+type perfMetric struct {
+	benchmark   string
+	group       string
+	machineType string
+	metric      string
+	unit        string
+	value       float64
+	// nodes is the number of machines needed to achieve the value.
+	nodes int
+	// storage is set if the value depends on the provisioned storage.
+	storage bool
+}
+
+// pricePerformer is implemented by analyzers producing results which can
+// be joined with the pricing catalog.
+type pricePerformer interface {
+	perfMetrics() []perfMetric
+}
+
+// storageConfig describes storage provisioned for each node.
+type storageConfig struct {
+	sizeGB, iops, throughputMBps float64
+}
+
+// machineRoachprodArgs returns roachprod arguments of the machine type in
+// the cloud details group: common arguments of the group overridden by
+// machine specific arguments.
+func machineRoachprodArgs(cloud, group, machineType string) (map[string]string, error) {
+	for _, details := range clouds {
+		if details.Cloud != cloud || details.Group != group {
+			continue
+		}
+		config, ok := details.MachineTypes[machineType]
+		if !ok {
+			continue
+		}
+		args := make(map[string]string)
+		for k, v := range details.RoachprodArgs {
+			args[k] = v
+		}
+		for k, v := range config.RoachprodArgs {
+			args[k] = v
+		}
+		return args, nil
+	}
+	return nil, fmt.Errorf("%s/%s/%s: machine type not found in cloud details", cloud, group, machineType)
+}
+
+// machineRegion returns the region the machine type in the cloud details
+// group runs in, as specified via roachprod arguments.  The default client
+// region of the provider is used if the arguments do not locate the nodes.
+func machineRegion(provider Provider, cloud, group, machineType string) (string, error) {
+	args, err := machineRoachprodArgs(cloud, group, machineType)
+	if err != nil {
+		return "", err
+	}
+	if region := provider.Region(args); region != "" {
+		return region, nil
+	}
+	region, _ := provider.DefaultRegions()
+	return region, nil
+}
+
+// machineStorage returns storage provisioned for the machine type in the
+// cloud details group, as specified via roachprod arguments.
+func machineStorage(provider Provider, cloud, group, machineType string) (storageConfig, error) {
+	args, err := machineRoachprodArgs(cloud, group, machineType)
+	if err != nil {
+		return storageConfig{}, err
+	}
+	var s storageConfig
+	va := provider.VolumeArgs()
+	for _, a := range []struct {
+		arg string
+		val *float64
+	}{
+		{va.sizeGB, &s.sizeGB},
+		{va.iops, &s.iops},
+		{va.throughputMBps, &s.throughputMBps},
+	} {
+		if a.arg == "" || args[a.arg] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(args[a.arg]), 64)
+		if err != nil {
+			return storageConfig{}, fmt.Errorf("%s/%s/%s: invalid %s: %v", cloud, group, machineType, a.arg, err)
+		}
+		*a.val = v
+	}
+	return s, nil
+}
+
+// hourly returns the hourly cost of the storage config.
+func (s *storagePrice) hourly(c storageConfig) float64 {
+	monthly := c.sizeGB*s.PerGBMonth +
+		math.Max(0, c.iops-s.IncludedIOPS)*s.PerIOPSMonth +
+		math.Max(0, c.throughputMBps-s.IncludedMBps)*s.PerMBpsMonth
+	return monthly / hoursPerMonth
+}
+
+const pricePerformanceCSVHeader = "Cloud,Group,MachineType,Region,Benchmark,Metric,Unit,Value,Nodes,Term," +
+	"Currency,MachineHourly,StorageHourly,HourlyCost,MonthlyCost,MonthlyCostPerUnit"
+
+// writePricePerformance joins results of the analyzers with the pricing
+// catalog and emits price-performance of each benchmark result.
+func writePricePerformance(catalog *pricingCatalog, analyzers []resultsAnalyzer) error {
+	metrics := make(map[string][]perfMetric)
+	forEachCloudAnalyzer(analyzers, func(cloud string, a resultsAnalyzer) {
+		if pp, ok := a.(pricePerformer); ok {
+			metrics[cloud] = append(metrics[cloud], pp.perfMetrics()...)
+		}
+	})
+
+	var cloudNames []string
+	for cloud := range metrics {
+		cloudNames = append(cloudNames, cloud)
+	}
+	sort.Strings(cloudNames)
+	for _, cloud := range cloudNames {
+		if err := writeCloudPricePerformance(catalog, cloud, metrics[cloud]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pricingError records that price-performance of the metric is not
+// reported.
+func pricingError(cloud string, m perfMetric, format string, args ...interface{}) {
+	analyzeDiagnostics.add(diagnostic{
+		severity:    severityError,
+		cloud:       cloud,
+		group:       m.group,
+		machineType: m.machineType,
+		benchmark:   "price-performance",
+		message: fmt.Sprintf("%s; %s %s not reported",
+			fmt.Sprintf(format, args...), m.benchmark, m.metric),
+	})
+}
+
+func writeCloudPricePerformance(catalog *pricingCatalog, cloud string, metrics []perfMetric) (err error) {
+	provider, err := getProvider(cloud)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(metrics, func(i, j int) bool {
+		a, b := metrics[i], metrics[j]
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		if a.machineType != b.machineType {
+			return a.machineType < b.machineType
+		}
+		if a.benchmark != b.benchmark {
+			return a.benchmark < b.benchmark
+		}
+		return a.metric < b.metric
+	})
+
+	wr, err := newResultWriter("price-performance", strings.Split(pricePerformanceCSVHeader, ","), cloud)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	for _, m := range metrics {
+		region, err := machineRegion(provider, cloud, m.group, m.machineType)
+		if err != nil {
+			return err
+		}
+		mp := catalog.machinePrice(cloud, region, m.machineType)
+		if mp == nil {
+			pricingError(cloud, m, "no price for machine type %s in %s", m.machineType, region)
+			continue
+		}
+		var storageHourly float64
+		if m.storage {
+			sp := catalog.storagePrice(cloud, region, m.group)
+			if sp == nil {
+				pricingError(cloud, m, "no storage price for group %s in %s", m.group, region)
+				continue
+			}
+			sc, err := machineStorage(provider, cloud, m.group, m.machineType)
+			if err != nil {
+				return err
+			}
+			storageHourly = sp.hourly(sc)
+		}
+
+		for _, term := range pricingTerms {
+			machineHourly := mp.hourly(term)
+			if machineHourly == 0 {
+				continue
+			}
+			hourly := float64(m.nodes) * (machineHourly + storageHourly)
+			monthly := hourly * hoursPerMonth
+			perUnit := math.NaN()
+			if m.value > 0 {
+				perUnit = monthly / m.value
+			}
+			if err := wr.Write([]interface{}{
+				cloud,
+				m.group,
+				m.machineType,
+				region,
+				m.benchmark,
+				m.metric,
+				m.unit,
+				m.value,
+				m.nodes,
+				term,
+				catalog.Currency,
+				machineHourly,
+				storageHourly,
+				hourly,
+				monthly,
+				perUnit,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
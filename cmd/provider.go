@@ -0,0 +1,108 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Provider describes cloud specific knowledge needed to generate benchmark
+// scripts and to analyze their results.  Each supported cloud registers its
+// Provider via registerProvider.
+type Provider interface {
+	// Name returns the name of the cloud, as understood by roachprod --clouds.
+	Name() string
+	// ZoneArgs returns roachprod arguments which specify node locations.
+	ZoneArgs() []string
+	// ImageArg returns roachprod argument which specifies machine image.
+	ImageArg() string
+	// MachineTypeArg returns roachprod argument which specifies machine type.
+	MachineTypeArg() string
+	// DefaultRegions returns client and server regions used by the
+	// cross-region network benchmark.
+	DefaultRegions() (client, server string)
+	// Region returns the region of the nodes located by the roachprod
+	// arguments; empty if the arguments do not specify the location.
+	Region(roachprodArgs map[string]string) string
+	// ClusterName returns a valid cluster name derived from the specified name.
+	ClusterName(name string) string
+	// VolumeArgs returns roachprod arguments which specify provisioned storage.
+	VolumeArgs() volumeArgs
+}
+
+// volumeArgs names roachprod arguments describing provisioned storage.
+// Empty names are not supported by the cloud.
+type volumeArgs struct {
+	// sizeGB is the volume size in GB.
+	sizeGB string
+	// iops is the provisioned IOPS.
+	iops string
+	// throughputMBps is the provisioned throughput in MB/s.
+	throughputMBps string
+}
+
+var providers = make(map[string]Provider)
+
+func registerProvider(p Provider) {
+	if _, ok := providers[p.Name()]; ok {
+		panic(fmt.Sprintf("provider %s already registered", p.Name()))
+	}
+	providers[p.Name()] = p
+}
+
+// getProvider returns the provider for the specified cloud.
+func getProvider(cloud string) (Provider, error) {
+	if p, ok := providers[cloud]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unsupported cloud %q; expected one of %s",
+		cloud, strings.Join(providerNames(), ", "))
+}
+
+func providerNames() []string {
+	var names []string
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// firstValue returns the first of comma separated values of the argument.
+func firstValue(args map[string]string, arg string) string {
+	return strings.TrimSpace(strings.Split(args[arg], ",")[0])
+}
+
+var invalidClusterNameChars = regexp.MustCompile(`[\.|\_]`)
+
+// defaultClusterName replaces characters roachprod does not permit
+// in cluster names.
+func defaultClusterName(name string) string {
+	return invalidClusterNameChars.ReplaceAllString(name, "-")
+}
+
+// alternateArg parses argument that may specify zone location or image for
+// an alternative region: <region>-<arg>, where arg is one of the specified
+// arguments.  Returns region and arg, or empty strings if the argument is
+// not an alternate region argument.
+func alternateArg(arg string, args ...string) (string, string) {
+	for _, a := range args {
+		if a == "" {
+			continue
+		}
+		if strings.HasSuffix(arg, "-"+a) && len(arg) > len(a)+1 {
+			return strings.TrimSuffix(arg, "-"+a), a
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import "strings"
+
+type awsProvider struct{}
+
+var _ Provider = awsProvider{}
+
+func init() {
+	registerProvider(awsProvider{})
+}
+
+func (awsProvider) Name() string {
+	return "aws"
+}
+
+func (awsProvider) ZoneArgs() []string {
+	return []string{"aws-zones"}
+}
+
+func (awsProvider) ImageArg() string {
+	return "aws-image-ami"
+}
+
+func (awsProvider) MachineTypeArg() string {
+	return "aws-machine-type"
+}
+
+func (awsProvider) DefaultRegions() (client, server string) {
+	return "us-east-1", "us-west-2"
+}
+
+// Region returns the region of the first of aws-zones, e.g. us-east-1 of
+// us-east-1a.
+func (awsProvider) Region(roachprodArgs map[string]string) string {
+	return strings.TrimRight(firstValue(roachprodArgs, "aws-zones"), "abcdefghijklmnopqrstuvwxyz")
+}
+
+func (awsProvider) ClusterName(name string) string {
+	return defaultClusterName(name)
+}
+
+func (awsProvider) VolumeArgs() volumeArgs {
+	return volumeArgs{
+		sizeGB:         "aws-ebs-volume-size",
+		iops:           "aws-ebs-iops",
+		throughputMBps: "aws-ebs-throughput",
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+type azureProvider struct{}
+
+var _ Provider = azureProvider{}
+
+func init() {
+	registerProvider(azureProvider{})
+}
+
+func (azureProvider) Name() string {
+	return "azure"
+}
+
+func (azureProvider) ZoneArgs() []string {
+	return []string{"azure-locations", "azure-availability-zone"}
+}
+
+func (azureProvider) ImageArg() string {
+	return "azure-image-ami"
+}
+
+func (azureProvider) MachineTypeArg() string {
+	return "azure-machine-type"
+}
+
+func (azureProvider) DefaultRegions() (client, server string) {
+	return "eastus", "westus2"
+}
+
+// Region returns the first of azure-locations, which are regions.
+func (azureProvider) Region(roachprodArgs map[string]string) string {
+	return firstValue(roachprodArgs, "azure-locations")
+}
+
+func (azureProvider) ClusterName(name string) string {
+	return defaultClusterName(name)
+}
+
+func (azureProvider) VolumeArgs() volumeArgs {
+	return volumeArgs{sizeGB: "azure-volume-size"}
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import "strings"
+
+type gceProvider struct{}
+
+var _ Provider = gceProvider{}
+
+func init() {
+	registerProvider(gceProvider{})
+}
+
+func (gceProvider) Name() string {
+	return "gce"
+}
+
+func (gceProvider) ZoneArgs() []string {
+	return []string{"gce-zones"}
+}
+
+func (gceProvider) ImageArg() string {
+	return "gce-image"
+}
+
+func (gceProvider) MachineTypeArg() string {
+	return "gce-machine-type"
+}
+
+func (gceProvider) DefaultRegions() (client, server string) {
+	return "us-east4", "us-west1"
+}
+
+// Region returns the region of the first of gce-zones, e.g. us-central1 of
+// us-central1-c.
+func (gceProvider) Region(roachprodArgs map[string]string) string {
+	zone := firstValue(roachprodArgs, "gce-zones")
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
+
+func (gceProvider) ClusterName(name string) string {
+	return defaultClusterName(name)
+}
+
+func (gceProvider) VolumeArgs() volumeArgs {
+	return volumeArgs{sizeGB: "gce-pd-volume-size"}
+}
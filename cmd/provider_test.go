@@ -0,0 +1,37 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import "testing"
+
+func TestProviderRegion(t *testing.T) {
+	for _, tc := range []struct {
+		cloud  string
+		args   map[string]string
+		region string
+	}{
+		{"gce", map[string]string{"gce-zones": "us-central1-c"}, "us-central1"},
+		{"gce", map[string]string{"gce-zones": "europe-west4-a,europe-west4-b"}, "europe-west4"},
+		{"gce", map[string]string{"gce-pd-volume-size": "2500"}, ""},
+		{"aws", map[string]string{"aws-zones": "us-east-1a"}, "us-east-1"},
+		{"aws", map[string]string{"aws-zones": "us-west-2b,us-west-2c"}, "us-west-2"},
+		{"aws", nil, ""},
+		{"azure", map[string]string{"azure-locations": "eastus", "azure-availability-zone": "1"}, "eastus"},
+		{"azure", map[string]string{}, ""},
+	} {
+		p, err := getProvider(tc.cloud)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if region := p.Region(tc.args); region != tc.region {
+			t.Errorf("%s %v: expected region %q, got %q", tc.cloud, tc.args, tc.region, region)
+		}
+	}
+}
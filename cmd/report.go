@@ -0,0 +1,359 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var reportHTML bool
+var reportFile string
+
+// reportCmd represents the report command
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Renders analyzed results as a report",
+	Long: `Renders results produced by the analyze command as a single static HTML
+file with embedded SVG charts.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !reportHTML {
+			return fmt.Errorf("no report format specified; use --html")
+		}
+		return renderHTMLReport()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+
+	reportCmd.Flags().BoolVar(&reportHTML, "html", false, "render HTML report")
+	reportCmd.Flags().StringVar(&reportFile, "report-file", "",
+		"path to the rendered report; defaults to report.html in the results directory")
+}
+
+// TPC-C specification limits throughput to 12.86 tpmC per warehouse.
+const tpccMaxTpmCPerWarehouse = 12.86
+
+// reportTables lists results tables rendered in the report.
+var reportTables = []string{"cpu", "fio", "intra-az-net", "cross-region-net", "tpcc"}
+
+type reportPlot struct {
+	Title string
+	Src   template.URL
+}
+
+type reportSection struct {
+	Title  string
+	Charts []template.HTML
+	Plots  []reportPlot
+}
+
+type reportData struct {
+	Version  string
+	Sections []reportSection
+}
+
+const reportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Cloud Report {{.Version}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+svg.chart { display: block; margin: 1em 0; }
+svg text { font-size: 11px; fill: #333; }
+svg text.title { font-size: 14px; font-weight: bold; }
+svg text.axis { font-size: 12px; }
+svg line.grid { stroke: #ddd; }
+svg line.ref { stroke: #e15759; stroke-dasharray: 6 3; }
+svg text.ref-label { fill: #e15759; }
+figure { display: inline-block; margin: 1em; }
+figure img { max-width: 800px; }
+</style>
+</head>
+<body>
+<h1>Cloud Report {{.Version}}</h1>
+{{- range .Sections}}
+<h2>{{.Title}}</h2>
+{{- range .Charts}}
+{{.}}
+{{- end}}
+{{- range .Plots}}
+<figure><img src="{{.Src}}" alt="{{.Title}}"><figcaption>{{.Title}}</figcaption></figure>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`
+
+// value returns the value of the column in the row.
+func (t *resultsTable) value(row []string, col string) string {
+	if i := t.columnIndex(col); i >= 0 && i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// number returns the numeric value of the column in the row, or NaN.
+func (t *resultsTable) number(row []string, col string) float64 {
+	if v, ok := parseMetric(t, row, col); ok {
+		return v
+	}
+	return math.NaN()
+}
+
+// reportRow is a row of the results table of the cloud.
+type reportRow struct {
+	cloud string
+	table *resultsTable
+	row   []string
+}
+
+func (r reportRow) label(cols ...string) string {
+	parts := []string{r.cloud}
+	for _, c := range cols {
+		parts = append(parts, r.table.value(r.row, c))
+	}
+	return strings.Join(parts, "/")
+}
+
+// collectRows returns rows of the table for all clouds, sorted by label.
+func collectRows(
+	results map[string]map[string]*resultsTable, cloudNames []string, table string, labelCols ...string,
+) []reportRow {
+	var rows []reportRow
+	for _, cloud := range cloudNames {
+		t := results[cloud][table]
+		if t == nil {
+			continue
+		}
+		for _, r := range t.rows {
+			rows = append(rows, reportRow{cloud: cloud, table: t, row: r})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].label(labelCols...) < rows[j].label(labelCols...)
+	})
+	return rows
+}
+
+// seriesOf returns the named series of the column values of the rows,
+// transformed by fn.
+func seriesOf(name string, rows []reportRow, col string, fn func(float64) float64) barSeries {
+	s := barSeries{name: name}
+	for _, r := range rows {
+		v := r.table.number(r.row, col)
+		if fn != nil {
+			v = fn(v)
+		}
+		s.values = append(s.values, v)
+	}
+	return s
+}
+
+func labelsOf(rows []reportRow, cols ...string) []string {
+	var labels []string
+	for _, r := range rows {
+		labels = append(labels, r.label(cols...))
+	}
+	return labels
+}
+
+func cpuReportSection(results map[string]map[string]*resultsTable, cloudNames []string) reportSection {
+	rows := collectRows(results, cloudNames, "cpu", "Group", "MachineType")
+	labels := labelsOf(rows, "Group", "MachineType")
+	return reportSection{
+		Title: "CPU (coremark)",
+		Charts: []template.HTML{
+			barChart("Single-core coremark", "iterations/s", labels,
+				[]barSeries{seriesOf("Single", rows, "Single", nil)}),
+			barChart("Multi-core coremark per vCPU", "iterations/s", labels,
+				[]barSeries{seriesOf("Multi/vCPU", rows, "Multi/vCPU", nil)}),
+		},
+	}
+}
+
+func fioReportSection(results map[string]map[string]*resultsTable, cloudNames []string) reportSection {
+	section := reportSection{Title: "IO (fio)"}
+	rows := collectRows(results, cloudNames, "fio", "Group", "Machine")
+	var jobs []string
+	for _, r := range rows {
+		if job := r.table.value(r.row, "Job"); !containsString(jobs, job) {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Strings(jobs)
+
+	toMiB := func(v float64) float64 { return v / 1024 }
+	toMS := func(v float64) float64 { return v / 1e6 }
+	for _, job := range jobs {
+		var jobRows []reportRow
+		hasOp := map[string]bool{}
+		for _, r := range rows {
+			if r.table.value(r.row, "Job") != job {
+				continue
+			}
+			jobRows = append(jobRows, r)
+			for _, op := range []string{"Rd", "Wr"} {
+				if r.table.number(r.row, op+"IOPs") > 0 {
+					hasOp[op] = true
+				}
+			}
+		}
+		labels := labelsOf(jobRows, "Group", "Machine")
+		var lat []barSeries
+		for _, op := range []string{"Rd", "Wr"} {
+			if !hasOp[op] {
+				continue
+			}
+			for _, pct := range []string{"90", "99", "99.9"} {
+				lat = append(lat, seriesOf(fmt.Sprintf("%s p%s", op, pct), jobRows, op+pct, toMS))
+			}
+		}
+		section.Charts = append(section.Charts,
+			barChart(fmt.Sprintf("fio %s: IOPS", job), "IOPS", labels, []barSeries{
+				seriesOf("Read", jobRows, "RdIOP/s", nil),
+				seriesOf("Write", jobRows, "WrIOP/s", nil),
+			}),
+			barChart(fmt.Sprintf("fio %s: bandwidth", job), "MiB/s", labels, []barSeries{
+				seriesOf("Read", jobRows, "RdBW(KiB/s)", toMiB),
+				seriesOf("Write", jobRows, "WrBW(KiB/s)", toMiB),
+			}),
+			barChart(fmt.Sprintf("fio %s: completion latency percentiles", job), "ms", labels, lat),
+		)
+	}
+	return section
+}
+
+// inlineSVG returns data URL embedding the SVG file.
+func inlineSVG(p string) (template.URL, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(data)), nil
+}
+
+func netReportSection(
+	results map[string]map[string]*resultsTable, cloudNames []string, table, title string,
+) reportSection {
+	rows := collectRows(results, cloudNames, table, "DiskType", "MachineType")
+	labels := labelsOf(rows, "DiskType", "MachineType")
+	unit := "throughput"
+	if len(rows) > 0 {
+		unit = rows[0].table.value(rows[0].row, "ThrptUnit")
+	}
+	section := reportSection{
+		Title: title,
+		Charts: []template.HTML{
+			barChart(title+": throughput", unit, labels, []barSeries{
+				seriesOf("Min", rows, "MinThrpt", nil),
+				seriesOf("Mean", rows, "MeanThrpt", nil),
+				seriesOf("Max", rows, "MaxThrpt", nil),
+			}),
+			barChart(title+": latency", "microseconds", labels, []barSeries{
+				seriesOf("Mean", rows, "meanLat(microseconds)", nil),
+				seriesOf("p90", rows, "p90Lat(microseconds)", nil),
+				seriesOf("p99", rows, "p99Lat(microseconds)", nil),
+			}),
+		},
+	}
+
+	// Plot paths are relative to the report version directory.
+	for i, r := range rows {
+		p := r.table.value(r.row, "ThrptTimeSeriesPlotPath")
+		if p == "" {
+			continue
+		}
+		src, err := inlineSVG(path.Join(baseOutputDir, reportVersion, p))
+		if err != nil {
+			log.Printf("skipping throughput plot of %s: %v", labels[i], err)
+			continue
+		}
+		section.Plots = append(section.Plots, reportPlot{Title: labels[i] + " throughput", Src: src})
+	}
+	return section
+}
+
+func tpccReportSection(results map[string]map[string]*resultsTable, cloudNames []string) reportSection {
+	rows := collectRows(results, cloudNames, "tpcc", "Group", "MachineType")
+	var series []scatterSeries
+	for _, r := range rows {
+		name := r.label("Group", "MachineType")
+		if len(series) == 0 || series[len(series)-1].name != name {
+			series = append(series, scatterSeries{name: name})
+		}
+		s := &series[len(series)-1]
+		s.points = append(s.points, scatterPoint{
+			x:    r.table.number(r.row, "Warehouses"),
+			y:    r.table.number(r.row, "TpmC"),
+			pass: r.table.value(r.row, "Pass") == "true",
+		})
+	}
+	return reportSection{
+		Title: "TPC-C",
+		Charts: []template.HTML{
+			scatterChart("TPC-C tpmC vs. warehouses (hollow points failed)", "warehouses", "tpmC", series,
+				[]refLine{{name: "85% efficiency", slope: 0.85 * tpccMaxTpmCPerWarehouse}}),
+		},
+	}
+}
+
+func renderHTMLReport() error {
+	results, err := readResults(reportVersion, reportTables)
+	if err != nil {
+		return err
+	}
+	cloudNames := cloudDetailsNames()
+
+	data := reportData{
+		Version: reportVersion,
+		Sections: []reportSection{
+			cpuReportSection(results, cloudNames),
+			fioReportSection(results, cloudNames),
+			netReportSection(results, cloudNames, "intra-az-net", "Intra-AZ network (netperf)"),
+			netReportSection(results, cloudNames, "cross-region-net", "Cross-region network (netperf)"),
+			tpccReportSection(results, cloudNames),
+		},
+	}
+
+	tmpl, err := template.New("report").Parse(reportTemplate)
+	if err != nil {
+		return err
+	}
+	p := reportFile
+	if p == "" {
+		p = ResultsFile("report.html")
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(f, data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Report written to %s\n", p)
+	return nil
+}
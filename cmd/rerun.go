@@ -0,0 +1,406 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/spf13/cobra"
+)
+
+var rerunBenchmarks []string
+var rerunNameExtra string
+var rerunWarehousesPerVCPU []int
+var rerunTPCCRuns int
+
+// planRerunsCmd represents the plan-reruns command
+var planRerunsCmd = &cobra.Command{
+	Use:   "plan-reruns",
+	Short: "Plans driver invocations filling gaps in benchmark results",
+	Long: `Finds benchmark runs which are missing, failed or produced unusable results
+(unparsable logs, empty log files, TPC-C runs with zero tpmC, fio jobs without IOs)
+and prints the driver invocations rerunning them, as a shell script or as JSON.
+
+Runs are identified by their NAME_EXTRA label; only the newest successful run of
+every label is checked.  TPC-C runs are expected for every load and run of the
+non-adaptive sweep plan of the machine type (see the sweep command) or, without
+one, for every warehouse per vCPU load and run number found in the results of any
+machine type, unless specified via --warehouse-per-vcpu and --tpcc-runs.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		selected, err := benchmarksOrInAll(rerunBenchmarks)
+		if err != nil {
+			return err
+		}
+		plan, err := planReruns(selected)
+		if err != nil {
+			return err
+		}
+		return writeDriverPlan(plan, "reruns")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planRerunsCmd)
+
+	planRerunsCmd.Flags().StringSliceVar(&rerunBenchmarks, "bench", nil,
+		fmt.Sprintf("comma separated list of benchmarks to check: %s; benchmarks executed by \"-w all\" if not specified",
+			strings.Join(benchmarkNames(), ", ")))
+	planRerunsCmd.Flags().StringVar(&rerunNameExtra, "name-extra", "ori",
+		"NAME_EXTRA of reruns of benchmarks which never ran or whose runs are not labelled")
+	planRerunsCmd.Flags().IntSliceVar(&rerunWarehousesPerVCPU, "warehouse-per-vcpu", nil,
+		"expected TPC-C warehouse per vCPU loads; loads found in the results if not specified")
+	planRerunsCmd.Flags().IntVar(&rerunTPCCRuns, "tpcc-runs", 0,
+		"expected number of TPC-C runs of every load; the highest run number found in the results if not specified")
+	addDriverPlanFlags(planRerunsCmd)
+}
+
+// Problems of benchmark runs, in addition to the status of the benchmark.
+const (
+	// rerunParseError means that results of the run cannot be parsed.
+	rerunParseError = "parse-error"
+	// rerunZeroTpmC means that TPC-C run reported no throughput.
+	rerunZeroTpmC = "zero-tpmc"
+	// rerunZeroIO means that some of the fio jobs did not perform any IO.
+	rerunZeroIO = "zero-io"
+)
+
+// runAnomaly is returned by Benchmark.CheckRun if results of the run parse
+// correctly, but are implausible.
+type runAnomaly struct {
+	problem, detail string
+}
+
+func (a *runAnomaly) Error() string {
+	return a.problem + ": " + a.detail
+}
+
+// benchmarksOrInAll returns benchmarks with the specified names, or the
+// benchmarks executed by "-w all" if no names specified.
+func benchmarksOrInAll(names []string) ([]*Benchmark, error) {
+	if len(names) > 0 {
+		return selectBenchmarks(names)
+	}
+	var selected []*Benchmark
+	for _, b := range benchmarks {
+		if b.InAll {
+			selected = append(selected, b)
+		}
+	}
+	return selected, nil
+}
+
+// runDir is a results directory of the benchmark run.
+type runDir struct {
+	id        RunID
+	dir       string
+	succeeded bool
+}
+
+// labelledRuns returns runs of the benchmark on the machine type, keyed by
+// their label.
+func labelledRuns(b *Benchmark, cloud CloudDetails, machineType string) (map[string][]runDir, error) {
+	dirs, err := filepath.Glob(path.Join(cloud.LogDir(), FormatMachineType(machineType), b.ResultsDir+".*"))
+	if err != nil {
+		return nil, err
+	}
+	runs := make(map[string][]runDir)
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		id, err := runIDOfDir(b, cloud, machineType, dir, dir)
+		if err != nil {
+			return nil, err
+		}
+		// Runs of the capacity search are not rerun individually; the search
+		// is resumed instead.
+		if tpccSearchLabelRegex.MatchString(id.Label) {
+			continue
+		}
+		markers, err := filepath.Glob(path.Join(dir, b.SuccessMarker))
+		if err != nil {
+			return nil, err
+		}
+		runs[id.Label] = append(runs[id.Label], runDir{id: id, dir: dir, succeeded: len(markers) > 0})
+	}
+	return runs, nil
+}
+
+// checkRuns checks the newest successful run of the label, which is the
+// one analyzed by default.  Nil reason is returned if its results are usable.
+func checkRuns(b *Benchmark, runs []runDir) (*planReason, error) {
+	var newest *runDir
+	for i := range runs {
+		if runs[i].succeeded && (newest == nil || runs[i].id.Timestamp.After(newest.id.Timestamp)) {
+			newest = &runs[i]
+		}
+	}
+	if newest == nil {
+		return &planReason{
+			Benchmark: b.Name,
+			Reason:    statusFailed,
+			Detail:    fmt.Sprintf("none of %d runs produced %s", len(runs), b.SuccessMarker),
+		}, nil
+	}
+
+	reason := &planReason{Benchmark: b.Name, Run: newest.dir}
+	empty, err := emptyLogFiles(newest.dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(empty) > 0 {
+		reason.Reason = statusEmptyLogs
+		reason.Detail = strings.Join(empty, ", ")
+		return reason, nil
+	}
+	err = b.CheckRun(b, newest.id, newest.dir)
+	if err == nil {
+		return nil, nil
+	}
+	var a *runAnomaly
+	if errors.As(err, &a) {
+		reason.Reason, reason.Detail = a.problem, a.detail
+	} else {
+		reason.Reason, reason.Detail = rerunParseError, err.Error()
+	}
+	return reason, nil
+}
+
+func checkCoremarkRun(b *Benchmark, id RunID, dir string) error {
+	for _, kind := range []string{"single", "multi"} {
+		glob := path.Join(dir, kind+"-*.log")
+		logs, err := filepath.Glob(glob)
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return fmt.Errorf("%s: no %s-*.log files", dir, kind)
+		}
+		if _, _, err := parseCoremarkLogs(glob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFioRun(b *Benchmark, id RunID, dir string) error {
+	p := path.Join(dir, "fio-results.json")
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	var res fioResults
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("%s: %v", p, err)
+	}
+	if len(res.Jobs) == 0 {
+		return fmt.Errorf("%s: no fio jobs", p)
+	}
+	var idle []string
+	for _, j := range res.Jobs {
+		if j.ReadStats.TotalIOS+j.WriteStats.TotalIOS == 0 {
+			idle = append(idle, j.Name)
+		}
+	}
+	if len(idle) > 0 {
+		return &runAnomaly{
+			problem: rerunZeroIO,
+			detail:  fmt.Sprintf("%s: jobs without IOs: %s", p, strings.Join(idle, ", ")),
+		}
+	}
+	return nil
+}
+
+func checkNetRun(b *Benchmark, id RunID, dir string) error {
+	logs, err := filepath.Glob(path.Join(dir, "*-netperf-result*"))
+	if err != nil {
+		return err
+	}
+	if len(logs) != 1 {
+		return fmt.Errorf("%s: unexpected number of netperf runs found. expected 1, found %d", dir, len(logs))
+	}
+	return parseNetperfLog(logs[0], &networkResult{}, id)
+}
+
+func checkTPCCRun(b *Benchmark, id RunID, dir string) error {
+	files, err := filepath.Glob(path.Join(dir, b.SuccessMarker))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		run, err := parseTPCCRun(f)
+		if err != nil {
+			return err
+		}
+		if run.tpmC == 0 {
+			return &runAnomaly{
+				problem: rerunZeroTpmC,
+				detail:  fmt.Sprintf("%s: no throughput with %d warehouses", f, run.warehouses),
+			}
+		}
+	}
+	return nil
+}
+
+// expectedTPCCLabels returns labels of TPC-C experiment runs expected for
+// every machine type.
+func expectedTPCCLabels(observed []string) []string {
+	loads := rerunWarehousesPerVCPU
+	runs := rerunTPCCRuns
+	if len(loads) == 0 || runs == 0 {
+		var observedLoads []int
+		maxRun := 0
+		for _, label := range observed {
+			l := tpccLabelRegex.FindStringSubmatch(label)
+			if l == nil {
+				continue
+			}
+			load := atoiOrZero(l[1])
+			found := false
+			for _, o := range observedLoads {
+				found = found || o == load
+			}
+			if !found {
+				observedLoads = append(observedLoads, load)
+			}
+			if run := atoiOrZero(l[2]); run > maxRun {
+				maxRun = run
+			}
+		}
+		if len(loads) == 0 {
+			loads = observedLoads
+		}
+		if runs == 0 {
+			runs = maxRun
+		}
+	}
+
+	var labels []string
+	for _, load := range loads {
+		for run := 1; run <= runs; run++ {
+			labels = append(labels, fmt.Sprintf("%d-%d", load, run))
+		}
+	}
+	return labels
+}
+
+// planReruns returns driver invocations rerunning missing, failed and
+// anomalous runs of the selected benchmarks.  Benchmarks rerun with the same
+// label share the invocation, except for network benchmarks which cannot
+// run on the same cluster.
+func planReruns(selected []*Benchmark) ([]*driverInvocation, error) {
+	type series struct {
+		cloud       CloudDetails
+		machineType string
+		b           *Benchmark
+		runs        map[string][]runDir
+	}
+	var all []series
+	var observedTPCC []string
+	for _, cloud := range clouds {
+		for _, machineType := range sortedMachineTypes(cloud) {
+			for _, b := range selected {
+				runs, err := labelledRuns(b, cloud, machineType)
+				if err != nil {
+					return nil, err
+				}
+				if b.Name == "tpcc" {
+					for label := range runs {
+						observedTPCC = append(observedTPCC, label)
+					}
+				}
+				all = append(all, series{cloud: cloud, machineType: machineType, b: b, runs: runs})
+			}
+		}
+	}
+	expectedTPCC := expectedTPCCLabels(observedTPCC)
+
+	type invocationKey struct {
+		cloud, group, machineType, nameExtra, tpccExtraArgs string
+		intraAz                                             bool
+	}
+	var plan []*driverInvocation
+	invocations := make(map[invocationKey]*driverInvocation)
+	add := func(s series, label string, reason planReason) {
+		nameExtra := label
+		if nameExtra == "" {
+			nameExtra = rerunNameExtra
+		}
+		k := invocationKey{
+			cloud:       s.cloud.Cloud,
+			group:       s.cloud.Group,
+			machineType: s.machineType,
+			nameExtra:   nameExtra,
+			intraAz:     s.b.Name == "ia_net",
+		}
+		if s.b.Name == "tpcc" {
+			k.tpccExtraArgs = tpccExtraArgs(label)
+		}
+		inv, ok := invocations[k]
+		if !ok {
+			inv = newDriverInvocation(s.cloud, s.machineType, k.nameExtra, k.tpccExtraArgs)
+			invocations[k] = inv
+			plan = append(plan, inv)
+		}
+		inv.add(reason)
+	}
+
+	for _, s := range all {
+		var labels []string
+		for label := range s.runs {
+			labels = append(labels, label)
+		}
+		if s.b.Name == "tpcc" {
+			expected := expectedTPCC
+			if len(rerunWarehousesPerVCPU) == 0 && rerunTPCCRuns == 0 {
+				sweep, err := sweepOf(s.cloud, s.machineType)
+				if err != nil {
+					return nil, err
+				}
+				if sweep != nil && !sweep.adaptive {
+					expected = sweep.labels(sweep.loads)
+				}
+			}
+			for _, label := range expected {
+				if _, ok := s.runs[label]; !ok {
+					labels = append(labels, label)
+				}
+			}
+		}
+		if len(labels) == 0 {
+			labels = append(labels, rerunNameExtra)
+		}
+		sort.Slice(labels, func(i, j int) bool { return lessRunLabel(labels[i], labels[j]) })
+
+		for _, label := range labels {
+			runs, ok := s.runs[label]
+			if !ok {
+				add(s, label, planReason{Benchmark: s.b.Name, Reason: statusMissing})
+				continue
+			}
+			reason, err := checkRuns(s.b, runs)
+			if err != nil {
+				return nil, err
+			}
+			if reason != nil {
+				add(s, label, *reason)
+			}
+		}
+	}
+	return plan, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanReruns(t *testing.T) {
+	dir, cleanup := newCacheTest(t)
+	defer cleanup()
+	savedClouds, savedNameExtra, savedSweep := clouds, rerunNameExtra, sweepSpec
+	savedLoads, savedRuns := rerunWarehousesPerVCPU, rerunTPCCRuns
+	defer func() {
+		clouds, rerunNameExtra, sweepSpec = savedClouds, savedNameExtra, savedSweep
+		rerunWarehousesPerVCPU, rerunTPCCRuns = savedLoads, savedRuns
+	}()
+	clouds = []CloudDetails{{
+		Cloud: "gce", Group: "pd-ssd",
+		MachineTypes: map[string]machineConfig{"n2-standard-8": {}, "n2-standard-16": {}},
+	}}
+	rerunNameExtra, sweepSpec = "ori", ""
+	rerunWarehousesPerVCPU, rerunTPCCRuns = nil, 0
+
+	logs := filepath.Join(dir, "gce", "pd-ssd", "logs")
+	tpccRun := func(results string) map[string]string {
+		return map[string]string{"tpcc-results-8000.txt": results, "cpu_info.txt": "cpu_info/single-host.txt"}
+	}
+	// Only the newest successful run of the label is checked.
+	copyTestdata(t, filepath.Join(logs, "n2-standard-16", "coremark-results.20220101.09:00:00-ori"), coremarkTestdata)
+	copyTestdata(t, filepath.Join(logs, "n2-standard-16", "coremark-results.20220101.10:00:00-ori"), map[string]string{
+		"single-1.log": "coremark/empty.log", "multi-1.log": "coremark/multi.log", "success": "coremark/empty.log",
+	})
+	copyTestdata(t, filepath.Join(logs, "n2-standard-16", "tpcc-results.20220101.11:00:00-1000-2"),
+		tpccRun("tpcc/truncated.txt"))
+
+	copyTestdata(t, filepath.Join(logs, "n2-standard-8", "coremark-results.20220101.10:00:00-ori"), coremarkTestdata)
+	copyTestdata(t, filepath.Join(logs, "n2-standard-8", "fio-results.20220101.10:10:00-ori"), map[string]string{
+		"success": "coremark/empty.log",
+	})
+	if err := ioutil.WriteFile(filepath.Join(logs, "n2-standard-8", "fio-results.20220101.10:10:00-ori", "fio-results.json"),
+		[]byte(`{"jobs": [{"jobname": "rd-iops", "read": {"total_ios": 10}}, {"jobname": "wr-iops"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	copyTestdata(t, filepath.Join(logs, "n2-standard-8", "tpcc-results.20220101.11:00:00-1000-1"),
+		tpccRun("tpcc/results.txt"))
+	// Runs of the capacity search are not checked.
+	copyTestdata(t, filepath.Join(logs, "n2-standard-8", "tpcc-results.20220101.12:00:00-base-search-3"),
+		tpccRun("tpcc/truncated.txt"))
+	copyTestdata(t, filepath.Join(logs, "n2-standard-8", "cross-region-netperf-results.20220101.13:00:00"),
+		map[string]string{"netperf_draw_plot_overall.svg": "coremark/empty.log"})
+
+	// describe describes the invocations as "<machine type> <NAME_EXTRA>
+	// <TPCC_EXTRA_ARGS>: <benchmark>:<reason>[@<run>]...".
+	describe := func(plan []*driverInvocation) []string {
+		var invs []string
+		for _, inv := range plan {
+			var reasons []string
+			for _, r := range inv.Reasons {
+				s := r.Benchmark + ":" + r.Reason
+				if r.Run != "" {
+					s += "@" + filepath.Base(r.Run)
+				}
+				reasons = append(reasons, s)
+			}
+			invs = append(invs, fmt.Sprintf("%s %s %s: %s",
+				inv.MachineType, inv.NameExtra, inv.TPCCExtraArgs, strings.Join(reasons, " ")))
+		}
+		return invs
+	}
+
+	selected, err := benchmarksOrInAll(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := planReruns(selected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"n2-standard-16 ori : cpu:empty-logs@coremark-results.20220101.10:00:00-ori io:missing cr_net:missing",
+		"n2-standard-16 1000-1 -A 1000: tpcc:missing",
+		"n2-standard-16 1000-2 -A 1000: tpcc:parse-error@tpcc-results.20220101.11:00:00-1000-2",
+		"n2-standard-8 ori : io:zero-io@fio-results.20220101.10:10:00-ori cr_net:failed",
+		"n2-standard-8 1000-2 -A 1000: tpcc:missing",
+	}
+	if got := describe(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected plan\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	for _, inv := range plan {
+		for _, r := range inv.Reasons {
+			if r.Reason == rerunZeroIO && !strings.Contains(r.Detail, "jobs without IOs: wr-iops") {
+				t.Errorf("expected idle wr-iops job, got %q", r.Detail)
+			}
+		}
+	}
+
+	// The expected TPC-C loads and runs override those of the results.
+	rerunWarehousesPerVCPU, rerunTPCCRuns = []int{500}, 1
+	plan, err = planReruns([]*Benchmark{getBenchmark("tpcc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"n2-standard-16 500-1 -a 500: tpcc:missing",
+		"n2-standard-16 1000-2 -A 1000: tpcc:parse-error@tpcc-results.20220101.11:00:00-1000-2",
+		"n2-standard-8 500-1 -a 500: tpcc:missing",
+	}
+	if got := describe(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected plan\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestExpectedTPCCLabels(t *testing.T) {
+	savedLoads, savedRuns := rerunWarehousesPerVCPU, rerunTPCCRuns
+	defer func() { rerunWarehousesPerVCPU, rerunTPCCRuns = savedLoads, savedRuns }()
+	observed := []string{"2000-1", "500-3", "ori", "base-search-2", "2000-2"}
+	for _, tc := range []struct {
+		name  string
+		loads []int
+		runs  int
+		want  []string
+	}{
+		{
+			name: "observed",
+			want: []string{"2000-1", "2000-2", "2000-3", "500-1", "500-2", "500-3"},
+		},
+		{
+			name:  "loads",
+			loads: []int{1000},
+			want:  []string{"1000-1", "1000-2", "1000-3"},
+		},
+		{
+			name: "runs",
+			runs: 1,
+			want: []string{"2000-1", "500-1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rerunWarehousesPerVCPU, rerunTPCCRuns = tc.loads, tc.runs
+			if got := expectedTPCCLabels(observed); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,499 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ResultWriter emits rows of analyzed benchmark results.
+// Row values are typed: string, int64, float64, fixedPoint, bool or
+// time.Time.  Each value corresponds to the column at the same position.
+type ResultWriter interface {
+	Write(row []interface{}) error
+	Close() error
+}
+
+// resultFormat describes a back end capable of storing analyzed results.
+type resultFormat struct {
+	// newWriter returns a writer for the table with the specified name and
+	// columns; the results are stored in the dir directory.
+	newWriter func(dir, name string, columns []string) (ResultWriter, error)
+	// check, if set, verifies that the format can be written, so that a
+	// missing dependency is reported before any results are analyzed.
+	check func() error
+}
+
+var resultFormats = map[string]resultFormat{
+	"csv":      {newWriter: newCSVResultWriter},
+	"json":     {newWriter: newJSONResultWriter},
+	"ndjson":   {newWriter: newNDJSONResultWriter},
+	"markdown": {newWriter: newMarkdownResultWriter},
+	"sqlite":   {newWriter: newSQLiteResultWriter, check: checkSQLite},
+}
+
+// outputFormats is the list of formats requested via --format flag.
+var outputFormats = []string{"csv"}
+
+func resultFormatNames() []string {
+	var names []string
+	for name := range resultFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func checkOutputFormats() error {
+	if len(outputFormats) == 0 {
+		return fmt.Errorf("at least one output format required")
+	}
+	for _, f := range outputFormats {
+		format, ok := resultFormats[f]
+		if !ok {
+			return fmt.Errorf("unknown output format %q; expected one of %s",
+				f, strings.Join(resultFormatNames(), ", "))
+		}
+		if format.check != nil {
+			if err := format.check(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newResultWriter returns ResultWriter writing the results table with the
+// specified name into the results directory in every requested output format.
+func newResultWriter(name string, columns []string, subdirs ...string) (ResultWriter, error) {
+	return newResultWriterInDir(filepath.Dir(ResultsFile(name, subdirs...)), name, columns)
+}
+
+// newResultWriterInDir is like newResultWriter, but writes results into the
+// specified directory, which must exist.
+func newResultWriterInDir(dir, name string, columns []string) (ResultWriter, error) {
+	var writers multiResultWriter
+	for _, f := range outputFormats {
+		format, ok := resultFormats[f]
+		if !ok {
+			return nil, fmt.Errorf("unknown output format %q", f)
+		}
+		w, err := format.newWriter(dir, name, columns)
+		if err != nil {
+			_ = writers.Close()
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+	return writers, nil
+}
+
+type multiResultWriter []ResultWriter
+
+func (m multiResultWriter) Write(row []interface{}) error {
+	for _, w := range m {
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m multiResultWriter) Close() (err error) {
+	for _, w := range m {
+		if cerr := w.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// fixedPoint is a float value formatted with the number of decimal places
+// in textual formats.
+type fixedPoint struct {
+	value  float64
+	places int
+}
+
+// formatValue returns textual representation of the typed value.
+func formatValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case int:
+		return fmt.Sprintf("%d", t)
+	case int64:
+		return fmt.Sprintf("%d", t)
+	case float64:
+		return fmt.Sprintf("%f", t)
+	case fixedPoint:
+		return fmt.Sprintf("%.*f", t.places, t.value)
+	case bool:
+		return fmt.Sprintf("%t", t)
+	case time.Time:
+		return formatTime(t)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// formatTime returns the RFC 3339 representation of the time in UTC, which
+// every result format uses.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func createResultFile(dir, fname string) (*os.File, error) {
+	return os.OpenFile(filepath.Join(dir, fname), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+// csvResultWriter writes RFC 4180 CSV, quoting values as needed.
+type csvResultWriter struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func newCSVResultWriter(dir, name string, columns []string) (ResultWriter, error) {
+	f, err := createResultFile(dir, name+".csv")
+	if err != nil {
+		return nil, err
+	}
+	w := &csvResultWriter{f: f, w: csv.NewWriter(f)}
+	if err := w.w.Write(columns); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (c *csvResultWriter) Write(row []interface{}) error {
+	fields := make([]string, len(row))
+	for i, v := range row {
+		fields[i] = formatValue(v)
+	}
+	return c.w.Write(fields)
+}
+
+func (c *csvResultWriter) Close() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		_ = c.f.Close()
+		return err
+	}
+	return c.f.Close()
+}
+
+// record is a single row of results which marshals as JSON object
+// preserving column order.
+type record struct {
+	columns []string
+	values  []interface{}
+}
+
+func jsonValue(v interface{}) interface{} {
+	if f, ok := v.(fixedPoint); ok {
+		v = f.value
+	}
+	switch t := v.(type) {
+	case float64:
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return nil
+		}
+	case time.Time:
+		return formatTime(t)
+	}
+	return v
+}
+
+func (r record) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, c := range r.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		var v interface{}
+		if i < len(r.values) {
+			v = jsonValue(r.values[i])
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonResultWriter writes results as a JSON array of objects.
+type jsonResultWriter struct {
+	f       *os.File
+	columns []string
+	records []record
+}
+
+func newJSONResultWriter(dir, name string, columns []string) (ResultWriter, error) {
+	f, err := createResultFile(dir, name+".json")
+	if err != nil {
+		return nil, err
+	}
+	return &jsonResultWriter{f: f, columns: columns, records: []record{}}, nil
+}
+
+func (j *jsonResultWriter) Write(row []interface{}) error {
+	j.records = append(j.records, record{columns: j.columns, values: row})
+	return nil
+}
+
+func (j *jsonResultWriter) Close() error {
+	b, err := json.MarshalIndent(j.records, "", "  ")
+	if err == nil {
+		_, err = fmt.Fprintf(j.f, "%s\n", b)
+	}
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ndjsonResultWriter writes results as newline delimited JSON objects.
+type ndjsonResultWriter struct {
+	f       *os.File
+	w       *bufio.Writer
+	columns []string
+}
+
+func newNDJSONResultWriter(dir, name string, columns []string) (ResultWriter, error) {
+	f, err := createResultFile(dir, name+".ndjson")
+	if err != nil {
+		return nil, err
+	}
+	return &ndjsonResultWriter{f: f, w: bufio.NewWriter(f), columns: columns}, nil
+}
+
+func (n *ndjsonResultWriter) Write(row []interface{}) error {
+	b, err := json.Marshal(record{columns: n.columns, values: row})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(n.w, "%s\n", b)
+	return err
+}
+
+func (n *ndjsonResultWriter) Close() error {
+	err := n.w.Flush()
+	if cerr := n.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// markdownResultWriter writes results as a markdown table.
+type markdownResultWriter struct {
+	f       *os.File
+	columns []string
+	rows    [][]string
+}
+
+func newMarkdownResultWriter(dir, name string, columns []string) (ResultWriter, error) {
+	f, err := createResultFile(dir, name+".md")
+	if err != nil {
+		return nil, err
+	}
+	return &markdownResultWriter{f: f, columns: columns}, nil
+}
+
+func (m *markdownResultWriter) Write(row []interface{}) error {
+	fields := make([]string, len(m.columns))
+	for i := range fields {
+		if i < len(row) {
+			fields[i] = formatValue(row[i])
+		}
+	}
+	m.rows = append(m.rows, fields)
+	return nil
+}
+
+func markdownEscape(s string) string {
+	s = strings.Replace(s, `|`, `\|`, -1)
+	return strings.Replace(s, "\n", " ", -1)
+}
+
+func writeMarkdownRow(w *bufio.Writer, fields []string) {
+	w.WriteString("|")
+	for _, f := range fields {
+		fmt.Fprintf(w, " %s |", markdownEscape(f))
+	}
+	w.WriteString("\n")
+}
+
+func (m *markdownResultWriter) Close() error {
+	w := bufio.NewWriter(m.f)
+	writeMarkdownRow(w, m.columns)
+	sep := make([]string, len(m.columns))
+	for i := range sep {
+		sep[i] = "---"
+	}
+	writeMarkdownRow(w, sep)
+	for _, r := range m.rows {
+		writeMarkdownRow(w, r)
+	}
+	err := w.Flush()
+	if cerr := m.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sqliteResultWriter stores results as a table in the results.db SQLite
+// database.  The table is replaced every time results are written.
+// Requires sqlite3 command line shell, which checkSQLite verifies when the
+// format is requested.
+type sqliteResultWriter struct {
+	db      string
+	table   string
+	columns []string
+	rows    [][]interface{}
+}
+
+func checkSQLite() error {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return fmt.Errorf("sqlite output format requires the sqlite3 command line shell on PATH; "+
+			"install it or select another --format: %v", err)
+	}
+	return nil
+}
+
+func newSQLiteResultWriter(dir, name string, columns []string) (ResultWriter, error) {
+	if err := checkSQLite(); err != nil {
+		return nil, err
+	}
+	return &sqliteResultWriter{
+		db:      filepath.Join(dir, "results.db"),
+		table:   name,
+		columns: columns,
+	}, nil
+}
+
+func (s *sqliteResultWriter) Write(row []interface{}) error {
+	s.rows = append(s.rows, row)
+	return nil
+}
+
+var sqlIdentRegex = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+func sqlIdent(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+func sqlTableName(s string) string {
+	return sqlIdent(sqlIdentRegex.ReplaceAllString(s, "_"))
+}
+
+func sqlType(v interface{}) string {
+	switch v.(type) {
+	case int, int64, bool:
+		return "INTEGER"
+	case float64, fixedPoint:
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+func sqlLiteral(v interface{}) string {
+	if f, ok := v.(fixedPoint); ok {
+		v = f.value
+	}
+	switch t := v.(type) {
+	case nil:
+		return "NULL"
+	case int, int64:
+		return fmt.Sprintf("%d", t)
+	case float64:
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return "NULL"
+		}
+		return fmt.Sprintf("%g", t)
+	case bool:
+		if t {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return "'" + formatTime(t) + "'"
+	default:
+		return "'" + strings.Replace(formatValue(t), "'", "''", -1) + "'"
+	}
+}
+
+func (s *sqliteResultWriter) Close() error {
+	var sql bytes.Buffer
+	table := sqlTableName(s.table)
+	fmt.Fprintf(&sql, "BEGIN;\nDROP TABLE IF EXISTS %s;\nCREATE TABLE %s (", table, table)
+	for i, c := range s.columns {
+		if i > 0 {
+			sql.WriteString(", ")
+		}
+		var typ interface{}
+		for _, r := range s.rows {
+			if i < len(r) && r[i] != nil {
+				typ = r[i]
+				break
+			}
+		}
+		fmt.Fprintf(&sql, "%s %s", sqlIdent(c), sqlType(typ))
+	}
+	sql.WriteString(");\n")
+
+	for _, r := range s.rows {
+		fmt.Fprintf(&sql, "INSERT INTO %s VALUES (", table)
+		for i := range s.columns {
+			if i > 0 {
+				sql.WriteString(", ")
+			}
+			var v interface{}
+			if i < len(r) {
+				v = r[i]
+			}
+			sql.WriteString(sqlLiteral(v))
+		}
+		sql.WriteString(");\n")
+	}
+	sql.WriteString("COMMIT;\n")
+
+	cmd := exec.Command("sqlite3", "-bail", s.db)
+	cmd.Stdin = &sql
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to write %s table to %s: %v: %s", s.table, s.db, err, out)
+	}
+	return nil
+}
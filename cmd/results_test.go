@@ -0,0 +1,212 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	resultsTestColumns = []string{"Name", "Count", "Rate", "Depth", "Pass", "Date", "Missing", "NaN"}
+	resultsTestRows    = [][]interface{}{
+		{`a "quoted", name`, int64(3), 2.5, fixedPoint{1, 2}, true,
+			time.Date(2022, 1, 10, 7, 33, 17, 0, time.FixedZone("EST", -5*3600)), nil, math.NaN()},
+		{"a|b", int64(-1), 1e-7, fixedPoint{37136.0235, 3}, false,
+			time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), nil, 1.0},
+	}
+)
+
+// writeResultsTest writes the test rows in the format, and returns the
+// results directory.
+func writeResultsTest(t *testing.T, format string) (dir string, cleanup func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "results-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedFormats := outputFormats
+	cleanup = func() {
+		outputFormats = savedFormats
+		os.RemoveAll(dir)
+	}
+	outputFormats = []string{format}
+	w, err := newResultWriterInDir(dir, "test", resultsTestColumns)
+	if err == nil {
+		for _, r := range resultsTestRows {
+			if err = w.Write(r); err != nil {
+				break
+			}
+		}
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return dir, cleanup
+}
+
+// textResultsTestRows are the test rows in textual formats.
+var textResultsTestRows = [][]string{
+	{`a "quoted", name`, "3", "2.500000", "1.00", "true", "2022-01-10T12:33:17Z", "", "NaN"},
+	{"a|b", "-1", "0.000000", "37136.024", "false", "2022-01-01T00:00:00Z", "", "1.000000"},
+}
+
+// jsonResultsTestRows are the test rows in JSON formats.
+var jsonResultsTestRows = []map[string]interface{}{
+	{
+		"Name": `a "quoted", name`, "Count": 3.0, "Rate": 2.5, "Depth": 1.0, "Pass": true,
+		"Date": "2022-01-10T12:33:17Z", "Missing": nil, "NaN": nil,
+	},
+	{
+		"Name": "a|b", "Count": -1.0, "Rate": 1e-7, "Depth": 37136.0235, "Pass": false,
+		"Date": "2022-01-01T00:00:00Z", "Missing": nil, "NaN": 1.0,
+	},
+}
+
+func TestResultFormats(t *testing.T) {
+	t.Run("csv", func(t *testing.T) {
+		dir, cleanup := writeResultsTest(t, "csv")
+		defer cleanup()
+		f, err := os.Open(filepath.Join(dir, "test.csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		records, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := append([][]string{resultsTestColumns}, textResultsTestRows...); !reflect.DeepEqual(records, want) {
+			t.Errorf("expected %q, got %q", want, records)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		dir, cleanup := writeResultsTest(t, "json")
+		defer cleanup()
+		data, err := ioutil.ReadFile(filepath.Join(dir, "test.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(data, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rows, jsonResultsTestRows) {
+			t.Errorf("expected %v, got %v", jsonResultsTestRows, rows)
+		}
+		// Objects preserve the order of columns.
+		if i, j := bytes.Index(data, []byte(`"Name"`)), bytes.Index(data, []byte(`"Count"`)); i < 0 || j < i {
+			t.Errorf("expected Name before Count, got:\n%s", data)
+		}
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		dir, cleanup := writeResultsTest(t, "ndjson")
+		defer cleanup()
+		f, err := os.Open(filepath.Join(dir, "test.ndjson"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var rows []map[string]interface{}
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			var row map[string]interface{}
+			if err := json.Unmarshal(s.Bytes(), &row); err != nil {
+				t.Fatal(err)
+			}
+			rows = append(rows, row)
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rows, jsonResultsTestRows) {
+			t.Errorf("expected %v, got %v", jsonResultsTestRows, rows)
+		}
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		dir, cleanup := writeResultsTest(t, "markdown")
+		defer cleanup()
+		data, err := ioutil.ReadFile(filepath.Join(dir, "test.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows [][]string
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			line = strings.TrimSuffix(strings.TrimPrefix(line, "| "), " |")
+			var fields []string
+			// Split on unescaped separators.
+			for _, f := range strings.Split(strings.Replace(line, `\|`, "\x00", -1), " | ") {
+				fields = append(fields, strings.TrimSpace(strings.Replace(f, "\x00", "|", -1)))
+			}
+			rows = append(rows, fields)
+		}
+		sep := []string{"---", "---", "---", "---", "---", "---", "---", "---"}
+		want := append([][]string{resultsTestColumns, sep}, textResultsTestRows...)
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("expected %q, got %q", want, rows)
+		}
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		if _, err := exec.LookPath("sqlite3"); err != nil {
+			t.Skip("sqlite3 command line shell not found")
+		}
+		dir, cleanup := writeResultsTest(t, "sqlite")
+		defer cleanup()
+		out, err := exec.Command("sqlite3", "-csv", filepath.Join(dir, "results.db"),
+			`SELECT Name, Count, typeof(Count), Rate, typeof(Rate), Depth, typeof(Depth), Pass, Date, `+
+				`typeof(Missing), typeof(NaN) FROM test`).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := [][]string{
+			{`a "quoted", name`, "3", "integer", "2.5", "real", "1.0", "real", "1", "2022-01-10T12:33:17Z", "null", "null"},
+			{"a|b", "-1", "integer", "1.0e-07", "real", "37136.0235", "real", "0", "2022-01-01T00:00:00Z", "null", "real"},
+		}
+		if !reflect.DeepEqual(records, want) {
+			t.Errorf("expected %q, got %q", want, records)
+		}
+	})
+}
+
+func TestCheckSQLite(t *testing.T) {
+	savedPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", savedPath)
+	os.Setenv("PATH", "")
+	savedFormats := outputFormats
+	defer func() { outputFormats = savedFormats }()
+	outputFormats = []string{"csv", "sqlite"}
+	err := checkOutputFormats()
+	if err == nil || !strings.Contains(err.Error(), "sqlite output format requires the sqlite3 command line shell") {
+		t.Errorf("expected missing sqlite3 error, got %v", err)
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -76,23 +78,79 @@ func (cv *cloudsValue) Set(s string) error {
 		return err
 	}
 	defer f.Close()
-	b, _ := ioutil.ReadAll(f)
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
 
 	var clouds []CloudDetails
 	err = json.Unmarshal(b, &clouds)
+	if err == nil {
+		err = checkCloudDetailsKeys(b)
+	}
 	if err != nil {
-		return err
+		// The validate command reads the file as raw JSON, and thus can
+		// explain every problem.
+		return fmt.Errorf("%s: %v (run \"cloud-report validate %s\" for details)", s, err, s)
 	}
 	*cv.c = append(*cv.c, clouds...)
+	cloudDetailsFiles = append(cloudDetailsFiles, s)
+	return nil
+}
+
+// checkCloudDetailsKeys returns an error naming the valid keys if cloud
+// details or machine type configurations have unknown keys, which
+// json.Unmarshal ignores.
+func checkCloudDetailsKeys(b []byte) error {
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return err
+	}
+	unknown := func(obj map[string]interface{}, known []string, what string) error {
+		for _, k := range sortedKeys(obj) {
+			if !containsString(known, k) {
+				return fmt.Errorf("unknown key %q of %s; expected one of %s", k, what, strings.Join(known, ", "))
+			}
+		}
+		return nil
+	}
+	for _, e := range entries {
+		if err := unknown(e, cloudDetailsFields, "cloud details"); err != nil {
+			return err
+		}
+		machineTypes, _ := e["machineTypes"].(map[string]interface{})
+		for _, m := range sortedKeys(machineTypes) {
+			config, _ := machineTypes[m].(map[string]interface{})
+			if err := unknown(config, machineConfigFields, "machine type "+m); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
 var clouds []CloudDetails
 
+// cloudDetailsFiles is the list of files clouds were read from.
+var cloudDetailsFiles []string
+
 func newCloudsValue(c *[]CloudDetails) *cloudsValue {
 	return &cloudsValue{c}
 }
 
+// cloudDetailsNames returns sorted names of the clouds specified via
+// cloud details files.
+func cloudDetailsNames() []string {
+	var names []string
+	for _, details := range clouds {
+		if !containsString(names, details.Cloud) {
+			names = append(names, details.Cloud)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func makeAllDirs(dirs ...string) error {
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
@@ -113,7 +171,7 @@ var rootCmd = &cobra.Command{
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
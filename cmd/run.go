@@ -0,0 +1,963 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	runCloud           string
+	runGroup           string
+	runMachineTypes    []string
+	runWorkloads       []string
+	runNameExtra       string
+	runNodes           int
+	runCockroachBinary string
+	runTPCCExtraArgs   string
+	runResume          bool
+	runKeepCluster     bool
+	runStepTimeouts    map[string]string
+	roachprodBin       string
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Runs benchmarks against configured machine types",
+	Long: `Runs the benchmark lifecycle (the same steps as the generated driver scripts)
+for each of the selected machine types: creates the cluster, uploads scripts,
+stages cockroach, sets up the cluster, runs the benchmarks, fetches their results
+and destroys the cluster.
+
+Progress is persisted in a state file under the machine log directory; --resume
+continues from the first step that did not complete.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targets, err := runTargets()
+		if err != nil {
+			return err
+		}
+		timeouts, err := parseStepTimeouts(runStepTimeouts)
+		if err != nil {
+			return err
+		}
+		for _, t := range targets {
+			r, err := newRunner(t.cloud, t.machineType, timeouts)
+			if err != nil {
+				return err
+			}
+			if err := r.run(); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().StringVar(&runCloud, "cloud", "", "only run machine types of this cloud")
+	runCmd.Flags().StringVar(&runGroup, "group", "", "only run machine types of this group")
+	runCmd.Flags().StringSliceVarP(&runMachineTypes, "machine-type", "m", nil,
+		"machine types to run; all configured machine types if not specified")
+	runCmd.Flags().StringSliceVarP(&runWorkloads, "workload", "w", []string{"all"},
+		"benchmarks to execute: cpu, io, ia_net, cr_net, tpcc, all")
+	runCmd.Flags().StringVar(&runNameExtra, "name-extra", envOrDefault("NAME_EXTRA", "ori"),
+		"suffix added to the cluster name and to the results directories")
+	runCmd.Flags().IntVarP(&runNodes, "nodes", "n", 4, "number of nodes in a cluster")
+	runCmd.Flags().StringVarP(&runCockroachBinary, "cockroach-binary", "c", "",
+		"cockroach binary to stage (local path to binary or release version)")
+	runCmd.Flags().StringVar(&runTPCCExtraArgs, "tpcc-extra-args", os.Getenv("TPCC_EXTRA_ARGS"),
+		"additional TPCC benchmark arguments")
+	runCmd.Flags().BoolVar(&runResume, "resume", false,
+		"resume from the first incomplete step recorded in the state file")
+	runCmd.Flags().BoolVar(&runKeepCluster, "keep-cluster", false,
+		"do not destroy the cluster once benchmarks complete")
+	runCmd.Flags().StringToStringVar(&runStepTimeouts, "step-timeout", nil,
+		"override step timeouts; e.g. fetch_bench_tpcc_results=6h")
+	runCmd.Flags().StringVar(&roachprodBin, "roachprod", "roachprod", "roachprod binary")
+	runCmd.Flags().StringVarP(&scriptsDir, "scripts-dir", "", "./scripts",
+		"directory containing scripts uploaded to cloud VMs that execute benchmarks.")
+	runCmd.Flags().StringVarP(&lifetime, "lifetime", "l", "6h", "cluster lifetime")
+	runCmd.Flags().StringVarP(&usage, "usage", "u", "cloud-report-2022", "usage label")
+}
+
+func envOrDefault(env, def string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return def
+}
+
+type runTarget struct {
+	cloud       CloudDetails
+	machineType string
+}
+
+// runTargets returns configured machine types selected by the run command flags.
+func runTargets() ([]runTarget, error) {
+	return selectTargets(runCloud, runGroup, runMachineTypes)
+}
+
+// selectTargets returns configured machine types of the cloud and group,
+// limited to the specified machine types.  Empty filters match all.
+func selectTargets(cloudName, group string, machineTypes []string) ([]runTarget, error) {
+	var targets []runTarget
+	for _, cloud := range clouds {
+		if (cloudName != "" && cloud.Cloud != cloudName) || (group != "" && cloud.Group != group) {
+			continue
+		}
+		for _, machineType := range sortedMachineTypes(cloud) {
+			if len(machineTypes) > 0 && !containsString(machineTypes, machineType) {
+				continue
+			}
+			targets = append(targets, runTarget{cloud: cloud, machineType: machineType})
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no configured machine types match --cloud=%q --group=%q --machine-type=%s",
+			cloudName, group, strings.Join(machineTypes, ","))
+	}
+	return targets, nil
+}
+
+func sortedMachineTypes(cloud CloudDetails) []string {
+	machineTypes := make([]string, 0, len(cloud.MachineTypes))
+	for machineType := range cloud.MachineTypes {
+		machineTypes = append(machineTypes, machineType)
+	}
+	sort.Strings(machineTypes)
+	return machineTypes
+}
+
+// Step timeouts used unless overridden via --step-timeout flag.
+const (
+	defaultSetupStepTimeout = 30 * time.Minute
+	defaultBenchStepTimeout = time.Hour
+	defaultFetchStepTimeout = 8 * time.Hour
+)
+
+func parseStepTimeouts(timeouts map[string]string) (map[string]time.Duration, error) {
+	res := make(map[string]time.Duration)
+	for step, v := range timeouts {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for step %s: %v", step, err)
+		}
+		res[step] = d
+	}
+	return res, nil
+}
+
+// runStep is a single step of the benchmark lifecycle.
+type runStep struct {
+	name    string
+	timeout time.Duration
+	fn      func(ctx context.Context) error
+}
+
+const (
+	stepPending = "pending"
+	stepRunning = "running"
+	stepDone    = "done"
+	stepFailed  = "failed"
+)
+
+type stepState struct {
+	Name     string     `json:"name"`
+	Status   string     `json:"status"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// runState is persisted after every step so that the run may be resumed.
+type runState struct {
+	Cloud              string      `json:"cloud"`
+	Group              string      `json:"group"`
+	MachineType        string      `json:"machineType"`
+	Cluster            string      `json:"cluster"`
+	NameExtra          string      `json:"nameExtra"`
+	WestClusterCreated bool        `json:"westClusterCreated"`
+	Steps              []stepState `json:"steps"`
+}
+
+// step returns state of the step, adding a pending step if not found.
+func (s *runState) step(name string) *stepState {
+	if st := s.lookupStep(name); st != nil {
+		return st
+	}
+	s.Steps = append(s.Steps, stepState{Name: name, Status: stepPending})
+	return &s.Steps[len(s.Steps)-1]
+}
+
+// lookupStep returns state of the step, nil if not found.
+func (s *runState) lookupStep(name string) *stepState {
+	for i := range s.Steps {
+		if s.Steps[i].Name == name {
+			return &s.Steps[i]
+		}
+	}
+	return nil
+}
+
+// runner executes benchmark lifecycle for a single machine type.
+type runner struct {
+	provider    Provider
+	cloud       CloudDetails
+	machineType string
+	data        scriptData
+	cluster     string
+	westCluster string
+	// nameExtra labels results of the run; see resultsDir.
+	nameExtra string
+	logDir    string
+	statePath string
+	state     *runState
+	timeouts  map[string]time.Duration
+	log       io.Writer
+}
+
+func newRunner(cloud CloudDetails, machineType string, timeouts map[string]time.Duration) (*runner, error) {
+	provider, err := getProvider(cloud.Cloud)
+	if err != nil {
+		return nil, err
+	}
+	data, err := newScriptData(provider, cloud, machineType, cloud.MachineTypes[machineType])
+	if err != nil {
+		return nil, err
+	}
+	cluster := fmt.Sprintf("%s-%s-%s", envOrDefault("CRL_USERNAME", os.Getenv("USER")), data.Cluster, runNameExtra)
+	logDir := path.Join(cloud.LogDir(), FormatMachineType(machineType))
+	return &runner{
+		provider:    provider,
+		cloud:       cloud,
+		machineType: machineType,
+		data:        data,
+		cluster:     cluster,
+		westCluster: cluster + "-west",
+		nameExtra:   runNameExtra,
+		logDir:      logDir,
+		statePath:   path.Join(logDir, fmt.Sprintf("run-state-%s.json", runNameExtra)),
+		timeouts:    timeouts,
+	}, nil
+}
+
+func (r *runner) loadState() error {
+	r.state = &runState{
+		Cloud:       r.cloud.Cloud,
+		Group:       r.cloud.Group,
+		MachineType: r.machineType,
+		Cluster:     r.cluster,
+		NameExtra:   runNameExtra,
+	}
+	if !runResume {
+		return nil
+	}
+	b, err := ioutil.ReadFile(r.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var prev runState
+	if err := json.Unmarshal(b, &prev); err != nil {
+		return fmt.Errorf("cannot resume from %s: %v", r.statePath, err)
+	}
+	if prev.Cluster != r.cluster {
+		return fmt.Errorf("cannot resume from %s: state is for cluster %s, expected %s",
+			r.statePath, prev.Cluster, r.cluster)
+	}
+	r.state = &prev
+	return nil
+}
+
+func (r *runner) saveState() error {
+	b, err := json.MarshalIndent(r.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.statePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.statePath)
+}
+
+// steps returns lifecycle steps for the requested workloads.
+func (r *runner) steps() ([]runStep, error) {
+	var workloads []*Benchmark
+	for _, w := range runWorkloads {
+		if w == "all" {
+			for _, b := range benchmarks {
+				if b.InAll {
+					workloads = append(workloads, b)
+				}
+			}
+			continue
+		}
+		b := getBenchmark(w)
+		if b == nil {
+			return nil, fmt.Errorf("invalid workload %q; expected one of all, %s",
+				w, strings.Join(benchmarkNames(), ", "))
+		}
+		workloads = append(workloads, b)
+	}
+
+	steps := []runStep{
+		{name: "create_cluster", fn: r.createCluster},
+		{name: "upload_scripts", fn: func(ctx context.Context) error { return r.uploadScripts(ctx, r.cluster) }},
+		{name: "load_cockroach", fn: r.loadCockroach},
+		{name: "setup_cluster", fn: func(ctx context.Context) error { return r.setupCluster(ctx, r.cluster) }},
+	}
+	// The capacity search runs and fetches TPC-C runs in a single step.
+	search := runTPCCSearch.enabled()
+	for _, b := range workloads {
+		b := b
+		if search && b.Name == "tpcc" {
+			steps = append(steps, runStep{
+				name:    "search_" + b.Function,
+				timeout: defaultSearchStepTimeout,
+				fn:      func(ctx context.Context) error { return r.searchTPCC(ctx, b) },
+			})
+			continue
+		}
+		steps = append(steps, runStep{
+			name:    "bench_" + b.Function,
+			timeout: defaultBenchStepTimeout,
+			fn:      func(ctx context.Context) error { return b.bench(r, ctx, b) },
+		})
+	}
+	for _, b := range workloads {
+		b := b
+		if search && b.Name == "tpcc" {
+			continue
+		}
+		steps = append(steps, runStep{
+			name:    fmt.Sprintf("fetch_bench_%s_results", b.Function),
+			timeout: defaultFetchStepTimeout,
+			fn:      func(ctx context.Context) error { return b.fetch(r, ctx, b) },
+		})
+	}
+	if !runKeepCluster {
+		steps = append(steps, runStep{name: "destroy_cluster", fn: r.destroyCluster})
+	}
+
+	for i := range steps {
+		if d, ok := r.timeouts[steps[i].name]; ok {
+			steps[i].timeout = d
+		} else if steps[i].timeout == 0 {
+			steps[i].timeout = defaultSetupStepTimeout
+		}
+	}
+	return steps, nil
+}
+
+func (r *runner) run() error {
+	if err := makeAllDirs(r.logDir); err != nil {
+		return err
+	}
+	steps, err := r.steps()
+	if err != nil {
+		return err
+	}
+	if err := r.loadState(); err != nil {
+		return err
+	}
+
+	logFile, err := os.OpenFile(path.Join(r.logDir, fmt.Sprintf("driver-%s.log", runNameExtra)),
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	r.log = logFile
+
+	for _, step := range steps {
+		s := r.state.step(step.name)
+		if s.Status == stepDone {
+			log.Printf("%s: skipping %s (completed at %s)", r.cluster, step.name, s.Finished)
+			continue
+		}
+
+		log.Printf("%s: %s", r.cluster, step.name)
+		fmt.Fprintf(r.log, "### %s %s\n", time.Now().UTC().Format(time.RFC3339), step.name)
+		started := stepTime()
+		s.Status, s.Started, s.Finished, s.Error = stepRunning, &started, nil, ""
+		if err := r.saveState(); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), step.timeout)
+		err := step.fn(ctx)
+		if err == nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		cancel()
+
+		finished := stepTime()
+		s.Finished = &finished
+		if err != nil {
+			if err == context.DeadlineExceeded {
+				err = fmt.Errorf("timed out after %s", step.timeout)
+			}
+			s.Status, s.Error = stepFailed, err.Error()
+			if serr := r.saveState(); serr != nil {
+				log.Printf("failed to save run state: %v", serr)
+			}
+			return fmt.Errorf("%s: step %s failed: %v (state saved in %s; rerun with --resume)",
+				r.cluster, step.name, err, r.statePath)
+		}
+		s.Status = stepDone
+		if err := r.saveState(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func stepTime() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// roachprod executes roachprod command and returns its stdout.
+func (r *runner) roachprod(ctx context.Context, args ...string) (string, error) {
+	fmt.Fprintf(r.log, "+ %s %s\n", roachprodBin, strings.Join(args, " "))
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, roachprodBin, args...)
+	cmd.Stdout = io.MultiWriter(&stdout, r.log)
+	cmd.Stderr = io.MultiWriter(&stderr, r.log)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return stdout.String(), ctx.Err()
+		}
+		return stdout.String(), fmt.Errorf("roachprod %s: %v: %s",
+			strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// roachprodToFile executes roachprod command and writes (or appends) its stdout to the file.
+func (r *runner) roachprodToFile(ctx context.Context, file string, appendOut bool, args ...string) error {
+	out, err := r.roachprod(ctx, args...)
+	if err != nil {
+		return err
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendOut {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(file, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, out); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+const tmuxSession = "cloud-report"
+
+// clusterExists returns true if roachprod lists the cluster.  Clusters are
+// listed one per line, e.g. "user-cluster: [gce] 4 (5h59m)".
+func (r *runner) clusterExists(ctx context.Context, cluster string) (bool, error) {
+	out, err := r.roachprod(ctx, "list", "--pattern", "^"+regexp.QuoteMeta(cluster)+"$")
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && strings.TrimSuffix(fields[0], ":") == cluster {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// createOrReuse creates the cluster with roachprod create arguments, unless
+// it already exists, e.g. because a resumed step created it before failing.
+func (r *runner) createOrReuse(ctx context.Context, cluster string, args []string) error {
+	exists, err := r.clusterExists(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Printf("%s: cluster already exists, skipping creation", cluster)
+		return nil
+	}
+	_, err = r.roachprod(ctx, append([]string{"create", cluster}, args...)...)
+	return err
+}
+
+// startTmux starts the tmux session benchmarks run under, unless it is
+// already running.
+func (r *runner) startTmux(ctx context.Context, cluster string) error {
+	_, err := r.roachprod(ctx, "run", cluster, "--", fmt.Sprintf(
+		"tmux has-session -t %[1]s 2>/dev/null || tmux new -s %[1]s -d", tmuxSession))
+	return err
+}
+
+func (r *runner) createCluster(ctx context.Context) error {
+	args := []string{"-n", fmt.Sprint(runNodes),
+		"--lifetime", r.data.Lifetime, "--clouds", r.cloud.Cloud,
+		"--" + r.provider.MachineTypeArg(), r.machineType}
+	args = append(args, argFlags(r.data.args.nodeLocation, r.data.args.extra, r.data.args.image)...)
+	args = append(args, "--label", r.data.Usage)
+	if err := r.createOrReuse(ctx, r.cluster, args); err != nil {
+		return err
+	}
+	if err := r.startTmux(ctx, r.cluster); err != nil {
+		return err
+	}
+	if _, err := r.roachprod(ctx, "run", r.cluster, "--", "tmux", "set-option", "remain-on-exit", "on"); err != nil {
+		return err
+	}
+	return r.roachprodToFile(ctx, path.Join(r.logDir, r.cluster+"_ram_info.txt"), false,
+		"run", r.cluster+":1", "--", "sudo", "lshw", "-c", "memory")
+}
+
+func (r *runner) createWestCluster(ctx context.Context) error {
+	args := []string{"-u", os.Getenv("USER"), "-n", "1",
+		"--lifetime", r.data.Lifetime, "--clouds", r.cloud.Cloud,
+		"--" + r.provider.MachineTypeArg(), r.machineType}
+	args = append(args, argFlags(
+		r.data.args.alterNodeLocations["west"], r.data.args.extra, r.data.args.alterImages["west"])...)
+	args = append(args, "--label", r.data.Usage)
+	if err := r.createOrReuse(ctx, r.westCluster, args); err != nil {
+		return err
+	}
+	r.state.WestClusterCreated = true
+	if err := r.saveState(); err != nil {
+		return err
+	}
+	return r.startTmux(ctx, r.westCluster)
+}
+
+func (r *runner) uploadScripts(ctx context.Context, cluster string) error {
+	machineTypeFile := path.Join(r.logDir, "machinetype.txt")
+	if err := ioutil.WriteFile(machineTypeFile, []byte(r.machineType+"\n"), 0644); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"run", cluster, "rm", "--", "-rf", "./scripts"},
+		{"put", cluster, r.data.ScriptsDir, "scripts"},
+		{"put", cluster, machineTypeFile, "machinetype.txt"},
+		{"run", cluster, "chmod", "--", "-R", "+x", "./scripts"},
+		{"put", cluster, "./netperf", "./netperf"},
+		{"run", cluster, "chmod", "--", "-R", "+x", "./netperf"},
+	} {
+		if _, err := r.roachprod(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var releaseVersionRegex = regexp.MustCompile(`^v[0-9]+\.[0-9]+\.[0-9]+$`)
+
+func (r *runner) loadCockroach(ctx context.Context) error {
+	if _, err := r.roachprod(ctx, "run", r.cluster, "rm -f ./cockroach"); err != nil {
+		return err
+	}
+	var err error
+	switch {
+	case runCockroachBinary == "":
+		log.Printf("WARN: staging cockroach binary from master")
+		_, err = r.roachprod(ctx, "stage", r.cluster, "cockroach")
+	case releaseVersionRegex.MatchString(runCockroachBinary):
+		log.Printf("INFO: staging release version %s of cockroach binary", runCockroachBinary)
+		_, err = r.roachprod(ctx, "stage", r.cluster, "release", runCockroachBinary)
+	default:
+		log.Printf("WARN: staging unknown version of cockroach binary from local path: %s", runCockroachBinary)
+		_, err = r.roachprod(ctx, "put", r.cluster, runCockroachBinary, "cockroach")
+	}
+	return err
+}
+
+// cpufetchSummary returns the value following the last '@' of each line
+// of cpufetch output with the spaces removed.
+func cpufetchSummary(out string) string {
+	var buf strings.Builder
+	for _, line := range strings.Split(out, "\n") {
+		if i := strings.LastIndex(line, "@"); i >= 0 {
+			line = line[i+1:]
+		}
+		line = strings.Replace(line, " ", "", -1)
+		if strings.TrimSpace(line) != "" {
+			fmt.Fprintln(&buf, line)
+		}
+	}
+	return buf.String()
+}
+
+func (r *runner) setupCluster(ctx context.Context, cluster string) error {
+	if _, err := r.roachprod(ctx, "run", cluster, "sudo", "./scripts/gen/setup.sh", r.cloud.Cloud); err != nil {
+		return err
+	}
+	out, err := r.roachprod(ctx, "run", cluster+":1", "--", "cpufetch", "-s", "legacy")
+	if err != nil {
+		return err
+	}
+	cpuInfo := path.Join(r.logDir, cluster+"_cpu_info.txt")
+	if err := ioutil.WriteFile(cpuInfo, []byte(cpufetchSummary(out)), 0644); err != nil {
+		return err
+	}
+	return r.roachprodToFile(ctx, cpuInfo, true, "run", cluster+":1", "--", "lscpu")
+}
+
+// runUnderTmux executes command on a host using roachprod, under tmux session.
+func (r *runner) runUnderTmux(ctx context.Context, name, host, cmd string) error {
+	_, err := r.roachprod(ctx, "run", host, "--", "tmux", "neww", "-t", tmuxSession, "-n", name, "-d", "--", cmd)
+	return err
+}
+
+// resultsDir returns date suffixed directory under the log directory.
+func (r *runner) resultsDir(name string) string {
+	return path.Join(r.logDir, fmt.Sprintf("%s.%s-%s", name, time.Now().Format("20060102.15:04:05"), r.nameExtra))
+}
+
+func emptyLogFiles(dir string) ([]string, error) {
+	var empty []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && info.Size() == 0 && strings.HasSuffix(p, ".log") {
+			empty = append(empty, p)
+		}
+		return nil
+	})
+	return empty, err
+}
+
+// copyResultWithRetry copies results from the node, retrying if any of the
+// result files came back empty (see copy_result_with_retry in the driver script).
+func (r *runner) copyResultWithRetry(
+	ctx context.Context, node, fetchDir string, collectCPUInfo bool,
+) (string, error) {
+	targetDir := r.resultsDir(fetchDir)
+	var empty []string
+	for i := 1; i <= 3; i++ {
+		if _, err := r.roachprod(ctx, "get", node, "./"+fetchDir, targetDir); err != nil {
+			return targetDir, err
+		}
+		var err error
+		if empty, err = emptyLogFiles(targetDir); err != nil {
+			return targetDir, err
+		}
+		if len(empty) == 0 {
+			break
+		}
+		log.Printf("copy round %d failed, found empty result file(s): %s", i, strings.Join(empty, " "))
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			return targetDir, ctx.Err()
+		}
+	}
+	if len(empty) > 0 {
+		return targetDir, fmt.Errorf("copy failed with empty result file(s) in %s", targetDir)
+	}
+
+	if collectCPUInfo {
+		cpuInfo := path.Join(targetDir, "cpu_info.txt")
+		if err := r.roachprodToFile(ctx, cpuInfo, false, "run", r.cluster, "--", "cpufetch", "-s", "legacy"); err != nil {
+			return targetDir, err
+		}
+		if err := r.roachprodToFile(ctx, cpuInfo, true, "run", r.cluster, "--", "lscpu"); err != nil {
+			return targetDir, err
+		}
+	}
+	return targetDir, nil
+}
+
+func (r *runner) requireNodes(n int) error {
+	if runNodes < n {
+		return fmt.Errorf("--nodes must be at least %d for this test", n)
+	}
+	return nil
+}
+
+// benchArgs returns additional benchmark arguments from the cloud details.
+func (r *runner) benchArgs(b *Benchmark) string {
+	return r.data.BenchArgs[b.BenchArgsKey]
+}
+
+// writeRunManifest records metadata of the benchmark run in the results
+// directory.
+func (r *runner) writeRunManifest(ctx context.Context, dir string, b *Benchmark) error {
+	args := r.benchArgs(b)
+	if b.Name == "tpcc" && runTPCCExtraArgs != "" {
+		args = strings.TrimSpace(args + " " + runTPCCExtraArgs)
+	}
+	// The start time is unknown if the state does not record the benchmark
+	// step; the lookup must not add it.
+	var start *time.Time
+	if s := r.state.lookupStep("bench_" + b.Function); s != nil {
+		start = s.Started
+	}
+	m, err := r.newRunManifest(ctx, b, args, start)
+	if err != nil {
+		return err
+	}
+	return writeRunManifest(dir, m)
+}
+
+// newRunManifest returns the manifest of the benchmark run started at the
+// specified time with the arguments, which ends now.
+func (r *runner) newRunManifest(
+	ctx context.Context, b *Benchmark, args string, start *time.Time,
+) (*runManifest, error) {
+	end := stepTime()
+	m := &runManifest{
+		Cloud:       r.cloud.Cloud,
+		Group:       r.cloud.Group,
+		MachineType: r.machineType,
+		Benchmark:   b.Name,
+		Cluster:     r.cluster,
+		NameExtra:   r.nameExtra,
+		Nodes:       runNodes,
+		BenchArgs:   args,
+		Start:       start,
+		End:         &end,
+	}
+	if out, err := r.roachprod(ctx, "run", r.cluster+":1", "--", "./cockroach", "version"); err == nil {
+		m.CockroachVersion, m.CockroachSHA = parseCockroachVersion(out)
+	} else {
+		log.Printf("cannot determine cockroach version: %v", err)
+	}
+	checksums, err := scriptChecksums(r.data.ScriptsDir)
+	if err != nil {
+		return nil, err
+	}
+	m.ScriptChecksums = checksums
+	return m, nil
+}
+
+// waitAndCopyResults waits for the benchmark running on the node to
+// complete and copies its results into the log directory.
+func (r *runner) waitAndCopyResults(ctx context.Context, node string, b *Benchmark) error {
+	if _, err := r.roachprod(ctx, "run", node, b.Script, "--", "-w"); err != nil {
+		return err
+	}
+	dir, err := r.copyResultWithRetry(ctx, node, b.ResultsDir, false)
+	if err != nil {
+		return err
+	}
+	return r.writeRunManifest(ctx, dir, b)
+}
+
+func (r *runner) benchCPU(ctx context.Context, b *Benchmark) error {
+	return r.runUnderTmux(ctx, b.Name, r.cluster+":1", b.Script+" "+r.benchArgs(b))
+}
+
+func (r *runner) fetchCPUResults(ctx context.Context, b *Benchmark) error {
+	return r.waitAndCopyResults(ctx, r.cluster+":1", b)
+}
+
+func (r *runner) benchIO(ctx context.Context, b *Benchmark) error {
+	return r.runUnderTmux(ctx, b.Name, r.cluster+":1", b.Script+" "+r.benchArgs(b))
+}
+
+func (r *runner) fetchIOResults(ctx context.Context, b *Benchmark) error {
+	return r.waitAndCopyResults(ctx, r.cluster+":1", b)
+}
+
+// startCockroach starts cockroach on nodes [1-NODES-1].
+func (r *runner) startCockroach(ctx context.Context) error {
+	// Build --store flags based on the number of disks.
+	// Roachprod adds /mnt/data1/cockroach by itself, so, we'll pick up the other disks
+	out, err := r.roachprod(ctx, "run", r.cluster+":1", "ls -1d /mnt/data[2-9]* 2>/dev/null || echo")
+	if err != nil {
+		return err
+	}
+	var stores []string
+	for _, s := range strings.Fields(out) {
+		stores = append(stores, "--store "+s+"/cockroach")
+	}
+	if len(stores) == 0 {
+		stores = []string{"--store=/mnt/data1/cockroach"}
+	}
+	_, err = r.roachprod(ctx, "start", r.crdbNodes(),
+		"--args="+strings.Join(stores, " ")+" --cache=0.25 --max-sql-memory=0.4")
+	return err
+}
+
+// crdbNodes returns nodes running cockroach; the last node runs the workload.
+func (r *runner) crdbNodes() string {
+	if runNodes == 2 {
+		return r.cluster + ":1"
+	}
+	return fmt.Sprintf("%s:1-%d", r.cluster, runNodes-1)
+}
+
+func (r *runner) benchTPCC(ctx context.Context, b *Benchmark) error {
+	if err := r.requireNodes(2); err != nil {
+		return err
+	}
+	if err := r.startCockroach(ctx); err != nil {
+		return err
+	}
+	out, err := r.roachprod(ctx, "pgurl", r.crdbNodes())
+	if err != nil {
+		return err
+	}
+	pgurls := strings.Join(strings.Fields(out), " ")
+	return r.runUnderTmux(ctx, b.Name, fmt.Sprintf("%s:%d", r.cluster, runNodes),
+		fmt.Sprintf("%s %s %s %s", b.Script, r.benchArgs(b), runTPCCExtraArgs, pgurls))
+}
+
+func (r *runner) fetchTPCCResults(ctx context.Context, b *Benchmark) error {
+	if err := r.requireNodes(2); err != nil {
+		return err
+	}
+	node := fmt.Sprintf("%s:%d", r.cluster, runNodes)
+	// Fetch whatever results are available even if the benchmark failed.
+	_, waitErr := r.roachprod(ctx, "run", node, b.Script, "--", "-w")
+	dir, err := r.copyResultWithRetry(ctx, node, b.ResultsDir, true)
+	if err != nil {
+		return err
+	}
+	if err := r.writeRunManifest(ctx, dir, b); err != nil {
+		return err
+	}
+	return waitErr
+}
+
+// Different ports are used by the netserver for the cross-region
+// and intra-az network tests.
+const (
+	crossRegionPort = "12865"
+	intraAzPort     = "1337"
+)
+
+// runNetperf runs netperf latency and throughput tests between the server
+// and the client node.  See run_netperf_between_server_client in the driver script.
+func (r *runner) runNetperf(
+	ctx context.Context, b *Benchmark, client, server, port, testMode string,
+) error {
+	out, err := r.roachprod(ctx, "ip", server)
+	if err != nil {
+		return err
+	}
+	serverIP := strings.TrimSpace(out)
+	if serverIP == "" {
+		return fmt.Errorf("cannot get ip for server node %s in network test", server)
+	}
+
+	for _, node := range []string{client, server} {
+		if _, err := r.roachprod(ctx, "run", node, "sudo", "./scripts/gen/network-setup.sh"); err != nil {
+			return err
+		}
+	}
+
+	// Start netserver on the server node.  An error means that the netserver
+	// is already running on the given port, so we proceed when that happens.
+	if _, err := r.roachprod(ctx, "run", server, b.Script, "--",
+		"-S", "-p", port, "-m", server); err != nil {
+		log.Printf("ignoring netserver start error: %v", err)
+	}
+
+	// Mount a file containing server's ip to the client node.
+	remoteHosts := path.Join(r.logDir,
+		fmt.Sprintf("%s_%s_remote_hosts", strings.Replace(server, ":", "-", -1), testMode))
+	if err := ioutil.WriteFile(remoteHosts, []byte(fmt.Sprintf(
+		"REMOTE_HOSTS[0]=%s\nREMOTE_HOSTS[1]=%s\nNUM_REMOTE_HOSTS=2\n", serverIP, serverIP)), 0777); err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"run", client, "--", "sudo", "chmod", "777", "-R", "netperf"},
+		{"put", client, remoteHosts, fmt.Sprintf("netperf/doc/examples/%s_remote_hosts", testMode)},
+		{"run", client, "--", fmt.Sprintf(
+			"cd netperf/doc/examples && SEARCH_BEST_NUM_STREAMS=1 TEST_MODE=%s ./runemomniaggdemo.sh", testMode)},
+	} {
+		if _, err := r.roachprod(ctx, args...); err != nil {
+			return err
+		}
+	}
+
+	return r.runUnderTmux(ctx, testMode+"-net", client, fmt.Sprintf(
+		"%s -s %s -p %s -m %s -z %s-%s %s",
+		b.Script, serverIP, port, testMode, r.cloud.Cloud, r.machineType, r.benchArgs(b)))
+}
+
+func (r *runner) benchIntraAzNet(ctx context.Context, b *Benchmark) error {
+	if err := r.requireNodes(2); err != nil {
+		return err
+	}
+	return r.runNetperf(ctx, b, r.cluster+":1", r.cluster+":2", intraAzPort, "intra-az")
+}
+
+func (r *runner) fetchNetResults(ctx context.Context, b *Benchmark, testMode string) error {
+	node := r.cluster + ":1"
+	if _, err := r.roachprod(ctx, "run", node, b.Script, "--", "-w", "-m", testMode); err != nil {
+		return err
+	}
+	dir := r.resultsDir(b.ResultsDir)
+	if _, err := r.roachprod(ctx, "get", node, "./"+b.ResultsDir, dir); err != nil {
+		return err
+	}
+	return r.writeRunManifest(ctx, dir, b)
+}
+
+func (r *runner) fetchIntraAzNetResults(ctx context.Context, b *Benchmark) error {
+	if err := r.requireNodes(2); err != nil {
+		return err
+	}
+	return r.fetchNetResults(ctx, b, "intra-az")
+}
+
+func (r *runner) benchCrossRegionNet(ctx context.Context, b *Benchmark) error {
+	if err := r.createWestCluster(ctx); err != nil {
+		return err
+	}
+	if err := r.uploadScripts(ctx, r.westCluster); err != nil {
+		return err
+	}
+	if err := r.setupCluster(ctx, r.westCluster); err != nil {
+		return err
+	}
+	return r.runNetperf(ctx, b, r.cluster+":1", r.westCluster+":1", crossRegionPort, "cross-region")
+}
+
+func (r *runner) fetchCrossRegionNetResults(ctx context.Context, b *Benchmark) error {
+	return r.fetchNetResults(ctx, b, "cross-region")
+}
+
+func (r *runner) destroyCluster(ctx context.Context) error {
+	if _, err := r.roachprod(ctx, "destroy", r.cluster); err != nil {
+		return err
+	}
+	if r.state.WestClusterCreated {
+		if _, err := r.roachprod(ctx, "destroy", r.westCluster); err != nil {
+			return err
+		}
+		r.state.WestClusterCreated = false
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRoachprod records its arguments, one invocation per line, and keeps
+// the list of created clusters.  Invocations whose arguments contain
+// $FAKE_ROACHPROD_FAIL fail.
+const fakeRoachprod = `#!/bin/sh
+echo "$*" >> "$FAKE_ROACHPROD_DIR/argv"
+if [ -n "$FAKE_ROACHPROD_FAIL" ]; then
+	case "$*" in
+	*"$FAKE_ROACHPROD_FAIL"*) echo "injected failure" >&2; exit 1;;
+	esac
+fi
+clusters="$FAKE_ROACHPROD_DIR/clusters"
+touch "$clusters"
+case "$1" in
+list) cat "$clusters";;
+create)
+	if grep -q "^$2:" "$clusters"; then
+		echo "cluster $2 already exists" >&2
+		exit 1
+	fi
+	echo "$2: [gce] 4 (6h0m0s)" >> "$clusters";;
+destroy)
+	grep -v "^$2:" "$clusters" > "$clusters.tmp"
+	mv "$clusters.tmp" "$clusters";;
+get)
+	mkdir -p "$4"
+	echo "result" > "$4/run.log";;
+run)
+	case "$*" in
+	*"cockroach version"*) printf 'Build Tag:        v22.1.0\nBuild Commit ID:  0123456789\n';;
+	esac;;
+esac
+`
+
+// runTest is the environment of the run command executing against
+// fakeRoachprod.
+type runTest struct {
+	dir string
+	r   *runner
+}
+
+func newRunTest(t *testing.T) (*runTest, func()) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake roachprod is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "run-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "roachprod")
+	if err := ioutil.WriteFile(bin, []byte(fakeRoachprod), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	savedBin, savedOutputDir, savedVersion := roachprodBin, baseOutputDir, reportVersion
+	savedScripts, savedWorkloads, savedNameExtra := scriptsDir, runWorkloads, runNameExtra
+	savedNodes, savedResume, savedKeep := runNodes, runResume, runKeepCluster
+	savedLifetime, savedUsage := lifetime, usage
+	roachprodBin, baseOutputDir, reportVersion = bin, filepath.Join(dir, "report-data"), "20220101"
+	scriptsDir, runWorkloads, runNameExtra = filepath.Join("..", "scripts"), []string{"cpu"}, "test"
+	runNodes, runResume, runKeepCluster = 4, false, false
+	lifetime, usage = "6h", "cloud-report-test"
+	for env, val := range map[string]string{
+		"FAKE_ROACHPROD_DIR": dir, "FAKE_ROACHPROD_FAIL": "", "CRL_USERNAME": "tester",
+	} {
+		if err := os.Setenv(env, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cleanup := func() {
+		roachprodBin, baseOutputDir, reportVersion = savedBin, savedOutputDir, savedVersion
+		scriptsDir, runWorkloads, runNameExtra = savedScripts, savedWorkloads, savedNameExtra
+		runNodes, runResume, runKeepCluster = savedNodes, savedResume, savedKeep
+		lifetime, usage = savedLifetime, savedUsage
+		os.Unsetenv("FAKE_ROACHPROD_DIR")
+		os.Unsetenv("FAKE_ROACHPROD_FAIL")
+		os.Unsetenv("CRL_USERNAME")
+		os.RemoveAll(dir)
+	}
+
+	cloud := CloudDetails{
+		Cloud:         "gce",
+		Group:         "pd-ssd",
+		RoachprodArgs: map[string]string{"gce-zones": "us-east4-c", "gce-pd-volume-size": "2500"},
+		MachineTypes:  map[string]machineConfig{"n2-standard-8": {}},
+	}
+	rt := &runTest{dir: dir}
+	if rt.r, err = newRunner(cloud, "n2-standard-8", nil); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return rt, cleanup
+}
+
+// run executes the lifecycle, failing invocations of roachprod containing
+// failOn unless empty, and returns roachprod invocations.
+func (rt *runTest) run(t *testing.T, failOn string) ([]string, error) {
+	t.Helper()
+	if err := os.Setenv("FAKE_ROACHPROD_FAIL", failOn); err != nil {
+		t.Fatal(err)
+	}
+	argvFile := filepath.Join(rt.dir, "argv")
+	_ = os.Remove(argvFile)
+	err := rt.r.run()
+	b, rerr := ioutil.ReadFile(argvFile)
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n"), err
+}
+
+// lifecycle returns prefixes of the roachprod invocations of each step of
+// the cpu workload.
+func (rt *runTest) lifecycle() map[string][]string {
+	c := rt.r.cluster
+	return map[string][]string{
+		"create_cluster": {
+			"list --pattern ^" + c + "$",
+			"create " + c + " -n 4 --lifetime 6h --clouds gce --gce-machine-type n2-standard-8" +
+				" --gce-zones=us-east4-c --gce-pd-volume-size=2500 --label usage=cloud-report-test",
+			"run " + c + " -- tmux has-session",
+			"run " + c + " -- tmux set-option remain-on-exit on",
+			"run " + c + ":1 -- sudo lshw -c memory",
+		},
+		"upload_scripts": {
+			"run " + c + " rm -- -rf ./scripts",
+			"put " + c + " ../scripts scripts",
+			"put " + c + " " + filepath.Join(rt.r.logDir, "machinetype.txt") + " machinetype.txt",
+			"run " + c + " chmod -- -R +x ./scripts",
+			"put " + c + " ./netperf ./netperf",
+			"run " + c + " chmod -- -R +x ./netperf",
+		},
+		"load_cockroach": {
+			"run " + c + " rm -f ./cockroach",
+			"stage " + c + " cockroach",
+		},
+		"setup_cluster": {
+			"run " + c + " sudo ./scripts/gen/setup.sh gce",
+			"run " + c + ":1 -- cpufetch -s legacy",
+			"run " + c + ":1 -- lscpu",
+		},
+		"bench_cpu": {
+			"run " + c + ":1 -- tmux neww -t cloud-report -n cpu -d -- ./scripts/gen/cpu.sh",
+		},
+		"fetch_bench_cpu_results": {
+			"run " + c + ":1 ./scripts/gen/cpu.sh -- -w",
+			"get " + c + ":1 ./coremark-results " + filepath.Join(rt.r.logDir, "coremark-results."),
+			"run " + c + ":1 -- ./cockroach version",
+		},
+		"destroy_cluster": {
+			"destroy " + c,
+		},
+	}
+}
+
+var runTestSteps = []string{
+	"create_cluster", "upload_scripts", "load_cockroach", "setup_cluster",
+	"bench_cpu", "fetch_bench_cpu_results", "destroy_cluster",
+}
+
+// expectInvocations returns the prefixes of the roachprod invocations of
+// the steps.
+func (rt *runTest) expectInvocations(steps ...string) []string {
+	lifecycle := rt.lifecycle()
+	var res []string
+	for _, s := range steps {
+		res = append(res, lifecycle[s]...)
+	}
+	return res
+}
+
+func checkInvocations(t *testing.T, got, want []string) {
+	t.Helper()
+	for i := 0; i < len(got) || i < len(want); i++ {
+		switch {
+		case i >= len(got):
+			t.Errorf("invocation %d: expected %q, found none", i, want[i])
+		case i >= len(want):
+			t.Errorf("invocation %d: unexpected %q", i, got[i])
+		case !strings.HasPrefix(got[i], want[i]):
+			t.Errorf("invocation %d: expected %q, found %q", i, want[i], got[i])
+		}
+	}
+}
+
+// checkState verifies that the state file records the status of the steps.
+func (rt *runTest) checkState(t *testing.T, status map[string]string) {
+	t.Helper()
+	b, err := ioutil.ReadFile(rt.r.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state runState
+	if err := json.Unmarshal(b, &state); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range state.Steps {
+		if want := status[s.Name]; s.Status != want {
+			t.Errorf("step %s: expected status %q, found %q", s.Name, want, s.Status)
+		}
+	}
+}
+
+func TestRunLifecycle(t *testing.T) {
+	rt, cleanup := newRunTest(t)
+	defer cleanup()
+
+	argv, err := rt.run(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInvocations(t, argv, rt.expectInvocations(runTestSteps...))
+	status := make(map[string]string)
+	for _, s := range runTestSteps {
+		status[s] = stepDone
+	}
+	rt.checkState(t, status)
+
+	manifests, err := filepath.Glob(filepath.Join(rt.r.logDir, "coremark-results.*", runManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 1 {
+		t.Errorf("expected a run manifest of fetched results, found %v", manifests)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// failOn selects the failing roachprod invocation of the failed step.
+		failOn, failedStep string
+	}{
+		{
+			// The cluster exists when the step fails, and is reused.
+			name:       "create",
+			failOn:     "tmux set-option",
+			failedStep: "create_cluster",
+		},
+		{
+			name:       "setup",
+			failOn:     "cpufetch",
+			failedStep: "setup_cluster",
+		},
+		{
+			name:       "fetch",
+			failOn:     "./coremark-results",
+			failedStep: "fetch_bench_cpu_results",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rt, cleanup := newRunTest(t)
+			defer cleanup()
+
+			var failed int
+			for failed < len(runTestSteps) && runTestSteps[failed] != tc.failedStep {
+				failed++
+			}
+			argv, err := rt.run(t, tc.failOn)
+			if err == nil || !strings.Contains(err.Error(), "step "+tc.failedStep+" failed") {
+				t.Fatalf("expected step %s to fail, got %v", tc.failedStep, err)
+			}
+			// Invocations up to the failing one.
+			want := rt.expectInvocations(runTestSteps[:failed+1]...)
+			for i, w := range want {
+				if strings.Contains(w, tc.failOn) {
+					want = want[:i+1]
+					break
+				}
+			}
+			checkInvocations(t, argv, want)
+			status := make(map[string]string)
+			for i, s := range runTestSteps[:failed+1] {
+				status[s] = stepDone
+				if i == failed {
+					status[s] = stepFailed
+				}
+			}
+			rt.checkState(t, status)
+
+			runResume = true
+			argv, err = rt.run(t, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = rt.expectInvocations(runTestSteps[failed:]...)
+			if tc.failedStep == "create_cluster" {
+				// roachprod create is skipped, as the cluster exists.
+				want = append(want[:1], want[2:]...)
+			}
+			checkInvocations(t, argv, want)
+			for _, s := range runTestSteps {
+				status[s] = stepDone
+			}
+			rt.checkState(t, status)
+		})
+	}
+}
+
+// TestWriteRunManifestState verifies that the manifest records the start of
+// the benchmark step, and that writing it does not add steps to the state.
+func TestWriteRunManifestState(t *testing.T) {
+	rt, cleanup := newRunTest(t)
+	defer cleanup()
+	if err := rt.r.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	rt.r.log = ioutil.Discard
+	dir := filepath.Join(rt.dir, "results")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	b := getBenchmark("cpu")
+
+	if err := rt.r.writeRunManifest(context.Background(), dir, b); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.r.state.Steps) != 0 {
+		t.Errorf("expected no steps, found %+v", rt.r.state.Steps)
+	}
+	m, err := readRunManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Start != nil {
+		t.Errorf("expected unknown start, got %s", m.Start)
+	}
+
+	started := time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC)
+	rt.r.state.step("bench_cpu").Started = &started
+	if err := rt.r.writeRunManifest(context.Background(), dir, b); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = readRunManifest(dir); err != nil {
+		t.Fatal(err)
+	}
+	if m.Start == nil || !m.Start.Equal(started) {
+		t.Errorf("expected start %s, got %v", started, m.Start)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RunID identifies a single run of the benchmark.
+type RunID struct {
+	Cloud       string
+	Group       string
+	MachineType string
+	Benchmark   string
+	// Label is the NAME_EXTRA of the run, if any.
+	Label string
+	// Timestamp is the start time of the run, as recorded in the run
+	// manifest or in the name of the results directory.
+	Timestamp time.Time
+}
+
+// runDirTimeLayout is the layout of the timestamp in the results directory
+// name, as produced by the driver "date +%Y%m%d.%T".
+const runDirTimeLayout = "20060102.15:04:05"
+
+func (id RunID) String() string {
+	s := strings.Join([]string{id.Cloud, id.Group, id.MachineType, id.Benchmark}, "/")
+	if id.Label != "" {
+		s += "/" + id.Label
+	}
+	return s + "@" + id.Timestamp.UTC().Format(runDirTimeLayout)
+}
+
+// newRunID returns the RunID of the benchmark run which produced the
+// results file.  The identity is read from the run manifest of the results
+// directory.  Results of older drivers, which do not have the manifest, are
+// stored in the <ResultsDir>.<date>-<NAME_EXTRA> directory; the modification
+// time of the file is used if the directory name does not contain the date.
+func newRunID(b *Benchmark, cloud CloudDetails, machineType, file string) (RunID, error) {
+	return runIDOfDir(b, cloud, machineType, filepath.Dir(file), file)
+}
+
+// runIDOfDir returns the RunID of the benchmark run with results in the
+// directory.  The modification time of modFile is used if the time of the
+// run is not known otherwise.
+func runIDOfDir(b *Benchmark, cloud CloudDetails, machineType, dir, modFile string) (RunID, error) {
+	id := RunID{
+		Cloud:       cloud.Cloud,
+		Group:       cloud.Group,
+		MachineType: machineType,
+		Benchmark:   b.Name,
+	}
+	m, err := readRunManifest(dir)
+	if err != nil {
+		return RunID{}, err
+	}
+	if m != nil {
+		if m.Cloud != cloud.Cloud || m.Group != cloud.Group || m.MachineType != machineType {
+			return RunID{}, fmt.Errorf("%s: manifest describes %s/%s/%s run, expected %s/%s/%s",
+				dir, m.Cloud, m.Group, m.MachineType, cloud.Cloud, cloud.Group, machineType)
+		}
+		id.Label = m.NameExtra
+		switch {
+		case m.Start != nil:
+			id.Timestamp = m.Start.UTC()
+		case m.End != nil:
+			id.Timestamp = m.End.UTC()
+		}
+		if !id.Timestamp.IsZero() {
+			return id, nil
+		}
+	}
+
+	base := filepath.Base(dir)
+	if !strings.HasPrefix(base, b.ResultsDir+".") {
+		return RunID{}, fmt.Errorf("%s: expected %s results directory", dir, b.ResultsDir)
+	}
+	suffix := strings.TrimPrefix(base, b.ResultsDir+".")
+	if len(suffix) >= len(runDirTimeLayout) {
+		if ts, err := time.Parse(runDirTimeLayout, suffix[:len(runDirTimeLayout)]); err == nil {
+			id.Timestamp = ts
+			if m == nil {
+				id.Label = strings.TrimPrefix(suffix[len(runDirTimeLayout):], "-")
+			}
+			return id, nil
+		}
+	}
+	info, err := os.Stat(modFile)
+	if err != nil {
+		return RunID{}, err
+	}
+	id.Timestamp = info.ModTime().UTC()
+	if m == nil {
+		id.Label = suffix
+	}
+	return id, nil
+}
+
+// Policies selecting which runs of the same configuration are analyzed.
+const (
+	// runsLatest analyzes the latest run of every configuration and label.
+	runsLatest = "latest"
+	// runsAll analyzes every run.
+	runsAll = "all"
+	// runsAggregate combines all runs of every configuration, regardless
+	// of their labels.
+	runsAggregate = "aggregate"
+)
+
+var runPolicies = []string{runsLatest, runsAll, runsAggregate}
+
+var analyzeRuns = runsLatest
+
+// runRef refers to the result of a benchmark run.  Variant distinguishes
+// results of different configurations produced by the same run.
+type runRef struct {
+	id      RunID
+	variant string
+}
+
+// groupRuns groups runs according to the policy.  Results of runs in each
+// group are to be combined into a single result.  Groups are ordered by
+// run identity, runs within a group by time.
+func groupRuns(refs []runRef, policy string) [][]runRef {
+	type seriesKey struct {
+		cloud, group, machineType, benchmark, label, variant string
+	}
+	keyOf := func(r runRef) seriesKey {
+		k := seriesKey{
+			cloud:       r.id.Cloud,
+			group:       r.id.Group,
+			machineType: r.id.MachineType,
+			benchmark:   r.id.Benchmark,
+			label:       r.id.Label,
+			variant:     r.variant,
+		}
+		if policy == runsAggregate {
+			k.label = ""
+		}
+		return k
+	}
+
+	sorted := append([]runRef(nil), refs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if ka, kb := keyOf(a), keyOf(b); ka != kb {
+			return fmt.Sprint(ka) < fmt.Sprint(kb)
+		}
+		if !a.id.Timestamp.Equal(b.id.Timestamp) {
+			return a.id.Timestamp.Before(b.id.Timestamp)
+		}
+		return a.id.Label < b.id.Label
+	})
+
+	var groups [][]runRef
+	for i, r := range sorted {
+		if policy == runsAll || i == 0 || keyOf(sorted[i-1]) != keyOf(r) {
+			groups = append(groups, nil)
+		}
+		g := &groups[len(groups)-1]
+		if policy == runsLatest {
+			// Newer runs replace older ones.
+			*g = []runRef{r}
+		} else {
+			*g = append(*g, r)
+		}
+	}
+	return groups
+}
+
+// runLabel describes runs of the group.
+func runLabel(group []runRef) string {
+	var labels []string
+	for _, r := range group {
+		l := r.id.Label
+		if l == "" {
+			l = r.id.Timestamp.UTC().Format(runDirTimeLayout)
+		}
+		if !containsString(labels, l) {
+			labels = append(labels, l)
+		}
+	}
+	return strings.Join(labels, "+")
+}
+
+func checkRunPolicy() error {
+	if !containsString(runPolicies, analyzeRuns) {
+		return fmt.Errorf("unknown --runs policy %q; expected one of %s",
+			analyzeRuns, strings.Join(runPolicies, ", "))
+	}
+	return nil
+}
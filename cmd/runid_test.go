@@ -0,0 +1,180 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunIDOfDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runid-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	b := getBenchmark("cpu")
+	cloud := CloudDetails{Cloud: "gce", Group: "pd-ssd"}
+	const machineType = "n2-standard-8"
+	mtime := time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2022, 2, 1, 9, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		dir      string
+		manifest *runManifest
+		label    string
+		ts       time.Time
+		err      string
+	}{
+		{
+			name: "legacy",
+			dir:  "coremark-results.20220101.10:00:00",
+			ts:   time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "labelled",
+			dir:   "coremark-results.20220101.10:00:00-ori-2",
+			label: "ori-2",
+			ts:    time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			// The label of directories without the date is taken whole,
+			// and the modification time of the file is used.
+			name:  "label without date",
+			dir:   "coremark-results.ori",
+			label: "ori",
+			ts:    mtime,
+		},
+		{
+			name:  "malformed date",
+			dir:   "coremark-results.2022-01-01T10:00:00",
+			label: "2022-01-01T10:00:00",
+			ts:    mtime,
+		},
+		{
+			name: "other benchmark",
+			dir:  "fio-results.20220101.10:00:00",
+			err:  "expected coremark-results results directory",
+		},
+		{
+			name: "no suffix",
+			dir:  "coremark-results",
+			err:  "expected coremark-results results directory",
+		},
+		{
+			// The manifest takes precedence over the directory name.
+			name: "manifest",
+			dir:  "coremark-results.20220101.10:00:00-ori",
+			manifest: &runManifest{
+				Cloud: "gce", Group: "pd-ssd", MachineType: machineType, NameExtra: "rerun", Start: &start,
+			},
+			label: "rerun",
+			ts:    start,
+		},
+		{
+			// The name provides the time if the manifest does not.
+			name: "manifest without time",
+			dir:  "coremark-results.20220101.10:00:00-ori",
+			manifest: &runManifest{
+				Cloud: "gce", Group: "pd-ssd", MachineType: machineType, NameExtra: "rerun",
+			},
+			label: "rerun",
+			ts:    time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "manifest of other machine type",
+			dir:  "coremark-results.20220101.10:00:00-other",
+			manifest: &runManifest{
+				Cloud: "gce", Group: "pd-ssd", MachineType: "n2-standard-16", Start: &start,
+			},
+			err: "manifest describes gce/pd-ssd/n2-standard-16 run, expected gce/pd-ssd/n2-standard-8",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := filepath.Join(dir, tc.name, tc.dir)
+			if err := os.MkdirAll(d, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if tc.manifest != nil {
+				if err := writeRunManifest(d, tc.manifest); err != nil {
+					t.Fatal(err)
+				}
+			}
+			file := filepath.Join(d, "success")
+			if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(file, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+
+			id, err := newRunID(b, cloud, machineType, file)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v (%s)", tc.err, err, id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := RunID{
+				Cloud: "gce", Group: "pd-ssd", MachineType: machineType, Benchmark: "cpu",
+				Label: tc.label, Timestamp: tc.ts,
+			}
+			if !reflect.DeepEqual(id, want) {
+				t.Errorf("expected %s, got %s", want, id)
+			}
+		})
+	}
+}
+
+func TestGroupRuns(t *testing.T) {
+	ref := func(machineType, label string, hour int) runRef {
+		return runRef{id: RunID{
+			Cloud: "gce", Group: "pd-ssd", MachineType: machineType, Benchmark: "cpu", Label: label,
+			Timestamp: time.Date(2022, 1, 1, hour, 0, 0, 0, time.UTC),
+		}}
+	}
+	refs := []runRef{
+		ref("n2-standard-8", "ori", 12),
+		ref("n2-standard-8", "", 9),
+		ref("n2-standard-8", "ori", 10),
+		ref("n2-standard-8", "", 11),
+		ref("n2-standard-16", "ori", 8),
+	}
+	for _, tc := range []struct {
+		policy string
+		// groups are the runs of every group, described by runLabel.
+		groups []string
+	}{
+		{policy: runsLatest, groups: []string{"ori", "20220101.11:00:00", "ori"}},
+		{policy: runsAll, groups: []string{
+			"ori", "20220101.09:00:00", "20220101.11:00:00", "ori", "ori",
+		}},
+		{policy: runsAggregate, groups: []string{"ori", "20220101.09:00:00+ori+20220101.11:00:00"}},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			var groups []string
+			for _, g := range groupRuns(refs, tc.policy) {
+				groups = append(groups, runLabel(g))
+			}
+			if !reflect.DeepEqual(groups, tc.groups) {
+				t.Errorf("expected groups %q, got %q", tc.groups, groups)
+			}
+		})
+	}
+}
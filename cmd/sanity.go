@@ -0,0 +1,468 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Flags of the analyze command configuring sanity rules.
+var sanityRulesFile string
+var sanityRuleFlags []string
+
+func init() {
+	analyzeCmd.Flags().StringVar(&sanityRulesFile, "sanity-rules", "",
+		"path to JSON file configuring sanity rules (see ./sanity/example.json)")
+	analyzeCmd.Flags().StringArrayVar(&sanityRuleFlags, "sanity", nil,
+		fmt.Sprintf(`sanity rule configuration as <rule>=<threshold> or <rule>=off, e.g. "tpcc-efc-max=101"; `+
+			`may be repeated; rules: %s`, strings.Join(sanityRuleNames(), ", ")))
+}
+
+// sanityRule flags analyzed results which are implausible, typically
+// because of a bad run.  Flagged results are still reported: the Sanity
+// column of the results lists the rules they violate, and the sanity table
+// lists every violation.
+type sanityRule struct {
+	name        string
+	description string
+	// threshold parameterizes the rule; rules without a threshold have
+	// hasThreshold unset.
+	threshold    float64
+	hasThreshold bool
+	disabled     bool
+}
+
+// sanityRuleSet is a configuration of every sanity rule.
+type sanityRuleSet []*sanityRule
+
+// defaultSanityRules are the rules with their default configuration.
+var defaultSanityRules = sanityRuleSet{
+	{name: "tpcc-tpmc-max", hasThreshold: true, threshold: 12.86,
+		description: "tpmC exceeds <threshold> × active warehouses (the TPC-C maximum is ~12.86)"},
+	{name: "tpcc-efc-max", hasThreshold: true, threshold: 100,
+		description: "efficiency exceeds <threshold>%"},
+	{name: "tpcc-percentiles",
+		description: "latency percentiles of the run or a transaction are not monotonic"},
+	{name: "fio-zero-ios",
+		description: "fio job performed no IOs, or has zero runtime"},
+	{name: "fio-percentiles",
+		description: "completion latency percentiles of fio job are not monotonic"},
+	{name: "coremark-scaling", hasThreshold: true, threshold: 1,
+		description: "multi to single core ratio exceeds <threshold> × the number of cores"},
+	{name: "net-throughput-cap", hasThreshold: true, threshold: 1,
+		description: "mean throughput exceeds <threshold> × the advertised network bandwidth cap"},
+	{name: "net-percentiles",
+		description: "netperf latencies (min, p90, p99, max) are not monotonic"},
+}
+
+// sanityRules are the rules checked by analyze, as configured by
+// configureSanityRules.
+var sanityRules = defaultSanityRules.clone()
+
+func (s sanityRuleSet) clone() sanityRuleSet {
+	rules := make(sanityRuleSet, len(s))
+	for i, r := range s {
+		c := *r
+		rules[i] = &c
+	}
+	return rules
+}
+
+func (s sanityRuleSet) named(name string) *sanityRule {
+	for _, r := range s {
+		if r.name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+func sanityRuleNames() []string {
+	names := make([]string, len(defaultSanityRules))
+	for i, r := range defaultSanityRules {
+		names[i] = r.name
+	}
+	return names
+}
+
+func sanityRuleNamed(name string) *sanityRule {
+	return sanityRules.named(name)
+}
+
+// configure applies the threshold, or disables the rule if value is "off".
+func (r *sanityRule) configure(value string) error {
+	if value == "off" {
+		r.disabled = true
+		return nil
+	}
+	if !r.hasThreshold {
+		return fmt.Errorf("sanity rule %s does not take a threshold", r.name)
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || v <= 0 {
+		return fmt.Errorf("sanity rule %s: invalid threshold %q", r.name, value)
+	}
+	r.threshold, r.disabled = v, false
+	return nil
+}
+
+// configureSanityRules applies --sanity-rules and --sanity configuration.
+func configureSanityRules() error {
+	rules, err := loadSanityRules(sanityRulesFile, sanityRuleFlags)
+	if err != nil {
+		return err
+	}
+	sanityRules = rules
+	return nil
+}
+
+// loadSanityRules returns the default rules configured by the rules file,
+// if any, and then by the <rule>=<threshold> or <rule>=off flags.
+func loadSanityRules(rulesFile string, flags []string) (sanityRuleSet, error) {
+	rules := defaultSanityRules.clone()
+	if rulesFile != "" {
+		data, err := ioutil.ReadFile(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		var file struct {
+			Rules []struct {
+				Name      string   `json:"name"`
+				Disabled  bool     `json:"disabled"`
+				Threshold *float64 `json:"threshold"`
+			} `json:"rules"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %v", rulesFile, err)
+		}
+		for _, c := range file.Rules {
+			r := rules.named(c.Name)
+			if r == nil {
+				return nil, fmt.Errorf("%s: unknown sanity rule %q", rulesFile, c.Name)
+			}
+			if c.Threshold != nil {
+				if err := r.configure(strconv.FormatFloat(*c.Threshold, 'f', -1, 64)); err != nil {
+					return nil, fmt.Errorf("%s: %v", rulesFile, err)
+				}
+			}
+			r.disabled = c.Disabled
+		}
+	}
+	for _, f := range flags {
+		eq := strings.Index(f, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("--sanity %q: expected <rule>=<threshold> or <rule>=off", f)
+		}
+		r := rules.named(strings.TrimSpace(f[:eq]))
+		if r == nil {
+			return nil, fmt.Errorf("--sanity %q: unknown rule; expected one of %s",
+				f, strings.Join(sanityRuleNames(), ", "))
+		}
+		if err := r.configure(strings.TrimSpace(f[eq+1:])); err != nil {
+			return nil, fmt.Errorf("--sanity %q: %v", f, err)
+		}
+	}
+	return rules, nil
+}
+
+// sanityFlag is a violation of the sanity rule.
+type sanityFlag struct {
+	rule    string
+	message string
+}
+
+// sanityFlags accumulates violations of enabled rules.
+type sanityFlags []sanityFlag
+
+// check records the violation of the named rule if the rule is enabled and
+// violated returns true.  The threshold of the rule is passed to violated.
+func (f *sanityFlags) check(
+	name string, violated func(threshold float64) bool, format string, args ...interface{},
+) {
+	r := sanityRuleNamed(name)
+	if r == nil || r.disabled || !violated(r.threshold) {
+		return
+	}
+	*f = append(*f, sanityFlag{rule: name, message: fmt.Sprintf(format, args...)})
+}
+
+// column returns the value of the Sanity column: names of the violated rules.
+func (f sanityFlags) column() string {
+	var names []string
+	for _, flag := range f {
+		if !containsString(names, flag.rule) {
+			names = append(names, flag.rule)
+		}
+	}
+	return strings.Join(names, ";")
+}
+
+// monotonic returns the first pair of named values which decreases.
+func monotonic(names []string, values []float64) (ok bool, violation string) {
+	for i := 1; i < len(values); i++ {
+		if values[i] < values[i-1] {
+			return false, fmt.Sprintf("%s %g < %s %g", names[i], values[i], names[i-1], values[i-1])
+		}
+	}
+	return true, ""
+}
+
+func tpccSanity(res *tpccResult, run *tpccRun) sanityFlags {
+	var flags sanityFlags
+	active := float64(atoiOrZero(res.warehouses))
+	flags.check("tpcc-tpmc-max", func(threshold float64) bool {
+		return active > 0 && run.tpmC > threshold*active
+	}, "tpmC %.1f exceeds %.1f for %s active warehouses", run.tpmC,
+		sanityRuleNamed("tpcc-tpmc-max").threshold*active, res.warehouses)
+	flags.check("tpcc-efc-max", func(threshold float64) bool {
+		return run.efc > threshold
+	}, "efficiency %.1f%% exceeds %g%%", run.efc, sanityRuleNamed("tpcc-efc-max").threshold)
+
+	ok, violation := monotonic([]string{"p50", "p90", "p95", "p99", "pMax"},
+		[]float64{run.p50, run.p90, run.p95, run.p99, run.pMax})
+	if ok {
+		var txns []string
+		for name := range run.txns {
+			txns = append(txns, name)
+		}
+		sort.Strings(txns)
+		for _, name := range txns {
+			t := run.txns[name]
+			if ok, violation = monotonic([]string{"p50", "p95", "p99", "pMax"},
+				[]float64{t.p50, t.p95, t.p99, t.pMax}); !ok {
+				violation = name + " " + violation
+				break
+			}
+		}
+	}
+	flags.check("tpcc-percentiles", func(float64) bool { return !ok }, "%s", violation)
+	return flags
+}
+
+func fioJobSanity(j *fioJob) sanityFlags {
+	var flags sanityFlags
+	rd, wr := &j.ReadStats, &j.WriteStats
+	flags.check("fio-zero-ios", func(float64) bool {
+		return rd.TotalIOS+wr.TotalIOS == 0 ||
+			(rd.TotalIOS > 0 && rd.RuntimeMS == 0) || (wr.TotalIOS > 0 && wr.RuntimeMS == 0)
+	}, "read %d IOs in %d ms, write %d IOs in %d ms", rd.TotalIOS, rd.RuntimeMS, wr.TotalIOS, wr.RuntimeMS)
+
+	violation := ""
+	for _, s := range []struct {
+		dir   string
+		stats *ioStats
+	}{{"read", rd}, {"write", wr}} {
+		// Percentiles are keyed by their value, e.g. "99.900000".
+		type pct struct {
+			p float64
+			v int64
+		}
+		var pcts []pct
+		for k, v := range s.stats.Clat.Percentiles {
+			p, err := strconv.ParseFloat(k, 64)
+			if err == nil {
+				pcts = append(pcts, pct{p: p, v: v})
+			}
+		}
+		sort.Slice(pcts, func(i, j int) bool { return pcts[i].p < pcts[j].p })
+		names := make([]string, len(pcts))
+		values := make([]float64, len(pcts))
+		for i, p := range pcts {
+			names[i], values[i] = fmt.Sprintf("p%g", p.p), float64(p.v)
+		}
+		if ok, v := monotonic(names, values); !ok {
+			violation = s.dir + " " + v
+			break
+		}
+	}
+	flags.check("fio-percentiles", func(float64) bool { return violation != "" }, "%s", violation)
+	return flags
+}
+
+func coremarkSanity(res *coremarkResult) sanityFlags {
+	var flags sanityFlags
+	ratio := res.multi / res.single
+	flags.check("coremark-scaling", func(threshold float64) bool {
+		return res.single > 0 && ratio > threshold*float64(res.cores)
+	}, "multi/single ratio %.2f exceeds %d cores", ratio, res.cores)
+	return flags
+}
+
+func networkSanity(res *networkResult) sanityFlags {
+	var flags sanityFlags
+	parse := func(s string) float64 {
+		v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return v
+	}
+	mean, expected := parse(res.meanThroughput), parse(res.expectedThroughput)
+	flags.check("net-throughput-cap", func(threshold float64) bool {
+		return mean > threshold*expected
+	}, "mean throughput %g %s exceeds cap %g", mean, res.throughputUnit, expected)
+
+	ok, violation := monotonic([]string{"min", "p90", "p99", "max"}, []float64{
+		parse(res.minLatencyMicros), parse(res.latencyMicros_90),
+		parse(res.latencyMicros_99), parse(res.maxLatencyMicros),
+	})
+	flags.check("net-percentiles", func(float64) bool { return !ok }, "%s", violation)
+	return flags
+}
+
+// sanityFinding is a sanity rule violation of an analyzed result.
+type sanityFinding struct {
+	group, machineType, benchmark, run string
+	// detail identifies the result among results of the run, e.g. the fio
+	// job.
+	detail string
+	flag   sanityFlag
+}
+
+// sanityChecker is implemented by analyzers checking sanity of their results.
+type sanityChecker interface {
+	sanityFindings() []sanityFinding
+}
+
+func findingsOf(group, machineType, benchmark, run, detail string, flags sanityFlags) []sanityFinding {
+	findings := make([]sanityFinding, len(flags))
+	for i, f := range flags {
+		findings[i] = sanityFinding{
+			group:       group,
+			machineType: machineType,
+			benchmark:   benchmark,
+			run:         run,
+			detail:      detail,
+			flag:        f,
+		}
+	}
+	return findings
+}
+
+func (c *coremarkAnalyzer) sanityFindings() []sanityFinding {
+	var findings []sanityFinding
+	for _, res := range c.results() {
+		findings = append(findings,
+			findingsOf(res.group, res.machineType, c.bench.Name, res.run, "", coremarkSanity(res))...)
+	}
+	return findings
+}
+
+func (f *fioAnalyzer) sanityFindings() []sanityFinding {
+	var findings []sanityFinding
+	for _, res := range f.results() {
+		for i := range res.Jobs {
+			j := &res.Jobs[i]
+			findings = append(findings,
+				findingsOf(res.disktype, res.machinetype, f.bench.Name, res.run, j.Name, fioJobSanity(j))...)
+		}
+	}
+	return findings
+}
+
+func (n *netAnalyzer) sanityFindings() []sanityFinding {
+	var findings []sanityFinding
+	for _, res := range n.results() {
+		findings = append(findings,
+			findingsOf(res.diskType, res.machineType, n.bench.Name, res.run, n.testMode, networkSanity(res))...)
+	}
+	return findings
+}
+
+func (t *tpccAnalyzer) sanityFindings() []sanityFinding {
+	var findings []sanityFinding
+	for _, res := range t.results() {
+		for _, run := range res.runs {
+			detail := res.warehousePerVCPU + "-" + res.warehouses
+			findings = append(findings,
+				findingsOf(res.disktype, res.machine, t.bench.Name, res.run, detail, tpccSanity(res, run))...)
+		}
+	}
+	return findings
+}
+
+var _ sanityChecker = &coremarkAnalyzer{}
+var _ sanityChecker = &fioAnalyzer{}
+var _ sanityChecker = &netAnalyzer{}
+var _ sanityChecker = &tpccAnalyzer{}
+
+const sanityCSVHeader = "Cloud,Group,MachineType,Benchmark,Run,Detail,Rule,Message"
+
+// writeSanity emits violations of sanity rules by results of every analyzed
+// cloud, and logs the number of violations of each rule.
+func writeSanity(analyzers []resultsAnalyzer) error {
+	findings := make(map[string][]sanityFinding)
+	forEachCloudAnalyzer(analyzers, func(cloud string, a resultsAnalyzer) {
+		if sc, ok := a.(sanityChecker); ok {
+			findings[cloud] = append(findings[cloud], sc.sanityFindings()...)
+		}
+	})
+	var cloudNames []string
+	for cloud := range findings {
+		cloudNames = append(cloudNames, cloud)
+	}
+	sort.Strings(cloudNames)
+	for _, cloud := range cloudNames {
+		if err := writeCloudSanity(cloud, findings[cloud]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCloudSanity(cloud string, findings []sanityFinding) (err error) {
+	wr, err := newResultWriter("sanity", strings.Split(sanityCSVHeader, ","), cloud)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		ka := []string{a.group, a.machineType, a.benchmark, a.run, a.detail, a.flag.rule}
+		kb := []string{b.group, b.machineType, b.benchmark, b.run, b.detail, b.flag.rule}
+		for k := range ka {
+			if ka[k] != kb[k] {
+				return ka[k] < kb[k]
+			}
+		}
+		return false
+	})
+	counts := make(map[string]int)
+	for _, f := range findings {
+		counts[f.flag.rule]++
+		if err := wr.Write([]interface{}{
+			cloud, f.group, f.machineType, f.benchmark, f.run, f.detail, f.flag.rule, f.flag.message,
+		}); err != nil {
+			return err
+		}
+	}
+	var summary []string
+	for _, name := range sanityRuleNames() {
+		if counts[name] > 0 {
+			summary = append(summary, fmt.Sprintf("%s: %d", name, counts[name]))
+		}
+	}
+	if len(summary) > 0 {
+		log.Printf("%s: %d sanity rule violations (%s)", cloud, len(findings), strings.Join(summary, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadSanityRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sanity-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeRules := func(rules string) string {
+		p := filepath.Join(dir, "rules.json")
+		if err := ioutil.WriteFile(p, []byte(rules), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	defaults := defaultSanityRules.clone()
+
+	for _, tc := range []struct {
+		name  string
+		file  string
+		flags []string
+		// thresholds and disabled describe the configured rules.
+		thresholds map[string]float64
+		disabled   []string
+		err        string
+	}{
+		{
+			name:       "defaults",
+			thresholds: map[string]float64{"tpcc-efc-max": 100, "coremark-scaling": 1},
+		},
+		{
+			name: "example",
+			file: "../sanity/example.json",
+			thresholds: map[string]float64{
+				"tpcc-tpmc-max": 12.5, "coremark-scaling": 1.05, "net-throughput-cap": 1.1,
+			},
+			disabled: []string{"net-percentiles"},
+		},
+		{
+			// Flags override the file.
+			name:       "flags",
+			file:       `{"rules": [{"name": "tpcc-efc-max", "threshold": 99}, {"name": "fio-zero-ios", "disabled": true}]}`,
+			flags:      []string{"tpcc-efc-max=101", "fio-percentiles=off"},
+			thresholds: map[string]float64{"tpcc-efc-max": 101},
+			disabled:   []string{"fio-zero-ios", "fio-percentiles"},
+		},
+		{
+			name: "unknown file rule",
+			file: `{"rules": [{"name": "tpcc-efc-min"}]}`,
+			err:  `unknown sanity rule "tpcc-efc-min"`,
+		},
+		{
+			name:  "unknown flag rule",
+			flags: []string{"tpcc-efc-min=1"},
+			err:   `--sanity "tpcc-efc-min=1": unknown rule`,
+		},
+		{
+			name:  "no threshold",
+			flags: []string{"fio-zero-ios=1"},
+			err:   "sanity rule fio-zero-ios does not take a threshold",
+		},
+		{
+			name:  "invalid threshold",
+			flags: []string{"tpcc-efc-max=-1"},
+			err:   `sanity rule tpcc-efc-max: invalid threshold "-1"`,
+		},
+		{
+			name:  "no value",
+			flags: []string{"tpcc-efc-max"},
+			err:   "expected <rule>=<threshold> or <rule>=off",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			file := tc.file
+			if strings.HasPrefix(file, "{") {
+				file = writeRules(file)
+			}
+			rules, err := loadSanityRules(file, tc.flags)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, threshold := range tc.thresholds {
+				if r := rules.named(name); r.threshold != threshold {
+					t.Errorf("%s: expected threshold %g, got %g", name, threshold, r.threshold)
+				}
+			}
+			for _, r := range rules {
+				if disabled := containsString(tc.disabled, r.name); r.disabled != disabled {
+					t.Errorf("%s: expected disabled %t, got %t", r.name, disabled, r.disabled)
+				}
+			}
+		})
+	}
+	// Loading rules does not modify the defaults.
+	if !reflect.DeepEqual(defaultSanityRules, defaults) {
+		t.Errorf("default sanity rules were modified")
+	}
+}
+
+func TestSanityChecks(t *testing.T) {
+	saved := sanityRules
+	defer func() { sanityRules = saved }()
+
+	tpcc := &tpccResult{warehouses: "1000"}
+	for _, tc := range []struct {
+		name  string
+		flags []string
+		check func() sanityFlags
+		rules string
+	}{
+		{
+			name: "tpcc ok",
+			check: func() sanityFlags {
+				return tpccSanity(tpcc, &tpccRun{tpmC: 12000, efc: 93, p50: 1, p90: 2, p95: 3, p99: 4, pMax: 5})
+			},
+		},
+		{
+			name: "tpcc",
+			check: func() sanityFlags {
+				return tpccSanity(tpcc, &tpccRun{tpmC: 13000, efc: 101, p50: 1, p90: 2, p95: 3, p99: 4, pMax: 5,
+					txns: map[string]*tpccTxnStats{"newOrder": {p50: 2, p95: 1, p99: 3, pMax: 4}}})
+			},
+			rules: "tpcc-tpmc-max;tpcc-efc-max;tpcc-percentiles",
+		},
+		{
+			name:  "tpcc thresholds",
+			flags: []string{"tpcc-tpmc-max=13.5", "tpcc-efc-max=102", "tpcc-percentiles=off"},
+			check: func() sanityFlags {
+				return tpccSanity(tpcc, &tpccRun{tpmC: 13000, efc: 101, p50: 2, p90: 1})
+			},
+		},
+		{
+			name: "fio",
+			check: func() sanityFlags {
+				return fioJobSanity(&fioJob{ReadStats: ioStats{TotalIOS: 10, Clat: clat{
+					Percentiles: map[string]int64{"90.000000": 5, "99.000000": 4},
+				}}})
+			},
+			rules: "fio-zero-ios;fio-percentiles",
+		},
+		{
+			name: "coremark",
+			check: func() sanityFlags {
+				return coremarkSanity(&coremarkResult{cores: 4, single: 100, multi: 450})
+			},
+			rules: "coremark-scaling",
+		},
+		{
+			name:  "coremark threshold",
+			flags: []string{"coremark-scaling=1.2"},
+			check: func() sanityFlags {
+				return coremarkSanity(&coremarkResult{cores: 4, single: 100, multi: 450})
+			},
+		},
+		{
+			name: "net",
+			check: func() sanityFlags {
+				return networkSanity(&networkResult{
+					meanThroughput: "11", expectedThroughput: "10",
+					minLatencyMicros: "5", latencyMicros_90: "9", latencyMicros_99: "8", maxLatencyMicros: "20",
+				})
+			},
+			rules: "net-throughput-cap;net-percentiles",
+		},
+		{
+			// Throughput of machine types without a known cap is not
+			// checked.
+			name: "net unknown cap",
+			check: func() sanityFlags {
+				return networkSanity(&networkResult{
+					meanThroughput: "11", expectedThroughput: "unknown",
+					minLatencyMicros: "5", latencyMicros_90: "8", latencyMicros_99: "9", maxLatencyMicros: "20",
+				})
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := loadSanityRules("", tc.flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sanityRules = rules
+			if got := tc.check().column(); got != tc.rules {
+				t.Errorf("expected violated rules %q, got %q", tc.rules, got)
+			}
+		})
+	}
+}
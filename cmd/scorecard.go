@@ -0,0 +1,245 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The scorecard joins key results of all benchmarks, one row per cloud,
+// group and machine type.  Columns of benchmarks which were not analyzed
+// are left empty.
+const scorecardCSVHeader = "Cloud,Group,MachineType," +
+	"Cores,CoremarkSingle,CoremarkMulti,CoremarkMultiPerVCPU," +
+	"RdIOPS,WrIOPS,RdBW(MiB/s),WrBW(MiB/s),RdIOPSP99(ms),WrIOPSP99(ms)," +
+	"IntraAzThrpt(Gbit/s),IntraAzMeanLat(us),IntraAzP99Lat(us)," +
+	"CrossRegionThrpt(Gbit/s),CrossRegionMeanLat(us),CrossRegionP99Lat(us)," +
+	"MaxPassingWarehouses,MaxPassingWarehousePerVCPU,MaxPassingTpmC"
+
+type scorecardKey struct {
+	group, machineType string
+}
+
+// scorecard holds scorecard rows of a cloud.  Row values are keyed by
+// column name.
+type scorecard struct {
+	cloud string
+	keys  []scorecardKey
+	rows  map[scorecardKey]map[string]interface{}
+}
+
+// newScorecard returns a scorecard with a row for every machine type of the
+// cloud specified in cloud details.
+func newScorecard(cloud string) *scorecard {
+	s := &scorecard{cloud: cloud, rows: make(map[scorecardKey]map[string]interface{})}
+	for _, details := range clouds {
+		if details.Cloud != cloud {
+			continue
+		}
+		for machineType := range details.MachineTypes {
+			k := scorecardKey{group: details.Group, machineType: machineType}
+			if _, ok := s.rows[k]; !ok {
+				s.keys = append(s.keys, k)
+				s.rows[k] = make(map[string]interface{})
+			}
+		}
+	}
+	sort.Slice(s.keys, func(i, j int) bool {
+		if s.keys[i].group != s.keys[j].group {
+			return s.keys[i].group < s.keys[j].group
+		}
+		return s.keys[i].machineType < s.keys[j].machineType
+	})
+	return s
+}
+
+// set sets the column value of the machine type row.  Results of machine
+// types without a row are recorded as errors.
+func (s *scorecard) set(group, machineType, col string, val interface{}) {
+	row, ok := s.rows[scorecardKey{group: group, machineType: machineType}]
+	if !ok {
+		analyzeDiagnostics.add(diagnostic{
+			severity:    severityError,
+			cloud:       s.cloud,
+			group:       group,
+			machineType: machineType,
+			benchmark:   "scorecard",
+			message:     "machine type is not in cloud details; results not reported",
+		})
+		return
+	}
+	row[col] = val
+}
+
+// scorecardGroups returns the runs selected by the --runs policy, grouped
+// by configuration: the scorecard has a single row per machine type, so the
+// results of all selected runs are averaged.  Averaging of runs the policy
+// reports separately is recorded as a warning.
+func scorecardGroups(refs []runRef) [][]runRef {
+	var selected []runRef
+	for _, g := range groupRuns(refs, analyzeRuns) {
+		selected = append(selected, g...)
+	}
+	groups := groupRuns(selected, runsAggregate)
+	if analyzeRuns != runsAggregate {
+		for _, g := range groups {
+			if len(g) < 2 {
+				continue
+			}
+			id := g[0].id
+			analyzeDiagnostics.add(diagnostic{
+				severity:    severityWarning,
+				cloud:       id.Cloud,
+				group:       id.Group,
+				machineType: id.MachineType,
+				benchmark:   id.Benchmark,
+				run:         runLabel(g),
+				message:     fmt.Sprintf("scorecard reports the mean of %d runs selected by --runs %s", len(g), analyzeRuns),
+			})
+		}
+	}
+	return groups
+}
+
+// scorecardContributor is implemented by analyzers contributing their
+// results to the scorecard.
+type scorecardContributor interface {
+	addToScorecard(s *scorecard)
+}
+
+func (c *coremarkAnalyzer) addToScorecard(s *scorecard) {
+	for _, res := range c.resultsOf(scorecardGroups(c.refs())) {
+		s.set(res.group, res.machineType, "Cores", res.cores)
+		s.set(res.group, res.machineType, "CoremarkSingle", res.single)
+		s.set(res.group, res.machineType, "CoremarkMulti", res.multi)
+		s.set(res.group, res.machineType, "CoremarkMultiPerVCPU", res.multiPerVCPU())
+	}
+}
+
+func (f *fioAnalyzer) addToScorecard(s *scorecard) {
+	p99 := func(st *ioStats) float64 {
+		return float64(st.Clat.Percentiles["99.000000"]) / 1e6
+	}
+	bwMiB := func(st *ioStats) float64 {
+		if st.RuntimeMS > 0 {
+			return float64(st.IOBytes) / (float64(st.RuntimeMS) / 1000) / (1 << 20)
+		}
+		return 0
+	}
+	for _, res := range f.resultsOf(scorecardGroups(f.refs())) {
+		for _, j := range res.Jobs {
+			set := func(col string, val interface{}) {
+				s.set(res.disktype, res.machinetype, col, val)
+			}
+			switch j.Name {
+			case "rd-iops":
+				set("RdIOPS", ioRate(&j.ReadStats))
+				set("RdIOPSP99(ms)", p99(&j.ReadStats))
+			case "wr-iops":
+				set("WrIOPS", ioRate(&j.WriteStats))
+				set("WrIOPSP99(ms)", p99(&j.WriteStats))
+			case "rd-bw":
+				set("RdBW(MiB/s)", bwMiB(&j.ReadStats))
+			case "wr-bw":
+				set("WrBW(MiB/s)", bwMiB(&j.WriteStats))
+			}
+		}
+	}
+}
+
+func (n *netAnalyzer) addToScorecard(s *scorecard) {
+	prefix := "IntraAz"
+	if n.testMode == "cross-region" {
+		prefix = "CrossRegion"
+	}
+	for _, res := range n.resultsOf(scorecardGroups(n.refs())) {
+		machineType := res.machineType
+		if gbps, ok := n.throughputGbps(res); ok {
+			s.set(res.diskType, machineType, prefix+"Thrpt(Gbit/s)", gbps)
+		}
+		for col, val := range map[string]string{
+			prefix + "MeanLat(us)": res.meanLatencyMicros,
+			prefix + "P99Lat(us)":  res.latencyMicros_99,
+		} {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				s.set(res.diskType, machineType, col, v)
+			}
+		}
+	}
+}
+
+// addToScorecard reports TPC-C capacities, which combine the runs of every
+// machine type.
+func (t *tpccAnalyzer) addToScorecard(s *scorecard) {
+	for _, c := range t.capacities() {
+		if c.maxPassing == nil {
+			continue
+		}
+		s.set(c.group, c.machine, "MaxPassingWarehouses", c.maxPassing.warehouses)
+		s.set(c.group, c.machine, "MaxPassingWarehousePerVCPU", c.maxPassing.warehousePerVCPU)
+		s.set(c.group, c.machine, "MaxPassingTpmC", c.tpmC)
+	}
+}
+
+var _ scorecardContributor = &coremarkAnalyzer{}
+var _ scorecardContributor = &fioAnalyzer{}
+var _ scorecardContributor = &netAnalyzer{}
+var _ scorecardContributor = &tpccAnalyzer{}
+
+func (s *scorecard) write() (err error) {
+	columns := strings.Split(scorecardCSVHeader, ",")
+	wr, err := newResultWriter("scorecard", columns, s.cloud)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	for _, k := range s.keys {
+		row := s.rows[k]
+		fields := []interface{}{s.cloud, k.group, k.machineType}
+		for _, c := range columns[len(fields):] {
+			fields = append(fields, row[c])
+		}
+		if err := wr.Write(fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeScorecard emits the scorecard of every analyzed cloud.
+func writeScorecard(analyzers []resultsAnalyzer) error {
+	scorecards := make(map[string]*scorecard)
+	forEachCloudAnalyzer(analyzers, func(cloud string, a resultsAnalyzer) {
+		sc, ok := a.(scorecardContributor)
+		if !ok {
+			return
+		}
+		if scorecards[cloud] == nil {
+			scorecards[cloud] = newScorecard(cloud)
+		}
+		sc.addToScorecard(scorecards[cloud])
+	})
+	for _, cloud := range cloudDetailsNames() {
+		if s, ok := scorecards[cloud]; ok {
+			if err := s.write(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newScorecardTest sets up cloud details of the machine types, and returns
+// their scorecard.
+func newScorecardTest(t *testing.T, machineTypes ...string) (s *scorecard, cleanup func()) {
+	t.Helper()
+	savedClouds, savedDiagnostics, savedRuns := clouds, analyzeDiagnostics, analyzeRuns
+	cleanup = func() {
+		clouds, analyzeDiagnostics, analyzeRuns = savedClouds, savedDiagnostics, savedRuns
+	}
+	cloud := CloudDetails{Cloud: "gce", Group: "pd-ssd", MachineTypes: make(map[string]machineConfig)}
+	for _, m := range machineTypes {
+		cloud.MachineTypes[m] = machineConfig{}
+	}
+	clouds, analyzeDiagnostics = []CloudDetails{cloud}, &diagnosticsCollector{}
+	return newScorecard("gce"), cleanup
+}
+
+// coremarkRef returns the reference to a coremark run of the machine type.
+func coremarkRef(machineType string, hour int) runRef {
+	return runRef{id: RunID{
+		Cloud: "gce", Group: "pd-ssd", MachineType: machineType, Benchmark: "cpu",
+		Timestamp: time.Date(2022, 1, 1, hour, 0, 0, 0, time.UTC),
+	}}
+}
+
+func TestScorecardCoremark(t *testing.T) {
+	s, cleanup := newScorecardTest(t, "n2-standard-8", "n2-standard-16")
+	defer cleanup()
+	c := &coremarkAnalyzer{cloud: "gce", runs: map[runRef]*coremarkResult{
+		// The catalog vCPUs normalize the multi-core score, as in the cpu
+		// table.
+		coremarkRef("n2-standard-8", 10): {
+			group: "pd-ssd", machineType: "n2-standard-8", cores: 4, multi: 80000, vcpus: 8,
+		},
+		// The cores used by coremark do, if the catalog vCPUs are unknown.
+		coremarkRef("n2-standard-16", 10): {
+			group: "pd-ssd", machineType: "n2-standard-16", cores: 16, multi: 160000,
+		},
+	}}
+	c.addToScorecard(s)
+	for machineType, want := range map[string]float64{"n2-standard-8": 10000, "n2-standard-16": 10000} {
+		got := s.rows[scorecardKey{group: "pd-ssd", machineType: machineType}]["CoremarkMultiPerVCPU"]
+		if got != want {
+			t.Errorf("%s: expected CoremarkMultiPerVCPU %v, got %v", machineType, want, got)
+		}
+	}
+}
+
+// TestScorecardRuns verifies that the scorecard averages the runs of a
+// machine type which the --runs policy reports separately.
+func TestScorecardRuns(t *testing.T) {
+	for _, tc := range []struct {
+		policy string
+		want   float64
+		// warning is the run of the averaging warning, if any.
+		warning string
+	}{
+		{policy: runsLatest, want: 12000},
+		{policy: runsAll, want: 11000, warning: "20220101.10:00:00+20220101.11:00:00"},
+		{policy: runsAggregate, want: 11000},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			s, cleanup := newScorecardTest(t, "n2-standard-8")
+			defer cleanup()
+			analyzeRuns = tc.policy
+			c := &coremarkAnalyzer{cloud: "gce", runs: map[runRef]*coremarkResult{
+				coremarkRef("n2-standard-8", 10): {
+					group: "pd-ssd", machineType: "n2-standard-8", cores: 8, multi: 80000, vcpus: 8,
+				},
+				coremarkRef("n2-standard-8", 11): {
+					group: "pd-ssd", machineType: "n2-standard-8", cores: 8, multi: 96000, vcpus: 8,
+				},
+			}}
+			c.addToScorecard(s)
+			got := s.rows[scorecardKey{group: "pd-ssd", machineType: "n2-standard-8"}]["CoremarkMultiPerVCPU"]
+			if got != tc.want {
+				t.Errorf("expected CoremarkMultiPerVCPU %v, got %v", tc.want, got)
+			}
+			var warnings []string
+			for _, d := range analyzeDiagnostics.diagnostics {
+				if d.severity == severityWarning {
+					warnings = append(warnings, d.run)
+				}
+			}
+			var want []string
+			if tc.warning != "" {
+				want = []string{tc.warning}
+			}
+			if !reflect.DeepEqual(warnings, want) {
+				t.Errorf("expected warnings of runs %q, got %q", want, warnings)
+			}
+		})
+	}
+}
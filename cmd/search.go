@@ -0,0 +1,462 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Flags of the run command configuring the TPC-C capacity search.
+var runTPCCSearch tpccSearch
+
+func init() {
+	runCmd.Flags().IntVar(&runTPCCSearch.Start, "tpcc-search-start", 0,
+		"search TPC-C capacity starting with this number of active warehouses; disabled if 0")
+	runCmd.Flags().IntVar(&runTPCCSearch.Tolerance, "tpcc-search-tolerance", 50,
+		"stop the TPC-C capacity search once the largest passing and the smallest failing "+
+			"number of active warehouses are this close")
+	runCmd.Flags().IntVar(&runTPCCSearch.Repeats, "tpcc-search-repeats", 1,
+		"number of TPC-C runs of every probed number of active warehouses")
+	runCmd.Flags().IntVar(&runTPCCSearch.MinPassing, "tpcc-search-min-passing", 0,
+		"number of passing runs required for a probed number of active warehouses to pass; "+
+			"defaults to a majority of --tpcc-search-repeats")
+	runCmd.Flags().IntVar(&runTPCCSearch.Max, "tpcc-search-max", 0,
+		"largest number of active warehouses probed; defaults to the loaded warehouses")
+}
+
+// defaultSearchStepTimeout bounds the whole capacity search, which executes
+// many TPC-C runs.
+const defaultSearchStepTimeout = 24 * time.Hour
+
+// defaultTPCCWarehouses is the number of warehouses loaded by tpcc.sh unless
+// specified with -W.
+const defaultTPCCWarehouses = 10000
+
+// tpccSearch configures the search of the largest passing number of active
+// TPC-C warehouses.  The search starts at Start and doubles the load until a
+// failing load is found (or halves it until a passing one is), then bisects
+// the interval between the largest passing and the smallest failing load
+// until they are at most Tolerance apart.  Every load is run Repeats times,
+// and passes if at least MinPassing (by default, a majority) of its runs
+// pass.
+type tpccSearch struct {
+	Start      int `json:"start"`
+	Tolerance  int `json:"tolerance"`
+	Repeats    int `json:"repeats"`
+	MinPassing int `json:"minPassing,omitempty"`
+	Max        int `json:"max"`
+}
+
+// minPassing returns the number of passing runs required for a load to
+// pass.
+func (s tpccSearch) minPassing() int {
+	if s.MinPassing > 0 {
+		return s.MinPassing
+	}
+	return s.Repeats/2 + 1
+}
+
+func (s tpccSearch) enabled() bool {
+	return s.Start > 0
+}
+
+func (s tpccSearch) validate() error {
+	switch {
+	case s.Start < 0:
+		return fmt.Errorf("--tpcc-search-start must not be negative")
+	case s.Tolerance < 1:
+		return fmt.Errorf("--tpcc-search-tolerance must be positive")
+	case s.Repeats < 1:
+		return fmt.Errorf("--tpcc-search-repeats must be positive")
+	case s.MinPassing < 0 || s.MinPassing > s.Repeats:
+		return fmt.Errorf("--tpcc-search-min-passing %d must be between 0 (a majority) and --tpcc-search-repeats %d",
+			s.MinPassing, s.Repeats)
+	case s.Max < s.Start:
+		return fmt.Errorf("--tpcc-search-max %d is below --tpcc-search-start %d", s.Max, s.Start)
+	}
+	return nil
+}
+
+// tpccSearchProbe identifies a TPC-C run of the search.
+type tpccSearchProbe struct {
+	// Search is the NAME_EXTRA of the run command executing the search.
+	Search string `json:"search"`
+	// Probe numbers runs of the search, starting with 1.
+	Probe  int `json:"probe"`
+	Active int `json:"active"`
+	Repeat int `json:"repeat"`
+}
+
+// tpccProbeResult is the outcome of a TPC-C run of the search.
+type tpccProbeResult struct {
+	tpccSearchProbe
+	// Dir is the results directory of the run.
+	Dir  string  `json:"dir"`
+	TpmC float64 `json:"tpmC"`
+	Efc  float64 `json:"efc"`
+	P95  float64 `json:"p95"`
+	Pass bool    `json:"pass"`
+	// Error describes why results of the run could not be parsed; such
+	// runs fail.
+	Error string `json:"error,omitempty"`
+}
+
+// tpccSearchLog records the search so that it can be resumed and analyzed.
+type tpccSearchLog struct {
+	Cloud       string            `json:"cloud"`
+	Group       string            `json:"group"`
+	MachineType string            `json:"machineType"`
+	NameExtra   string            `json:"nameExtra"`
+	Config      tpccSearch        `json:"config"`
+	Probes      []tpccProbeResult `json:"probes"`
+	// Low and High bracket the capacity once the search is Done: Low is the
+	// largest passing load (0 if none) and High the smallest failing load
+	// above it (0 if none up to Max).
+	Done bool `json:"done"`
+	Low  int  `json:"low"`
+	High int  `json:"high"`
+}
+
+const tpccSearchLogPrefix = "tpcc-search-"
+
+func tpccSearchLogPath(logDir, nameExtra string) string {
+	return path.Join(logDir, tpccSearchLogPrefix+nameExtra+".json")
+}
+
+// tpccSearchLabelRegex matches NAME_EXTRA labels of TPC-C runs of the search.
+var tpccSearchLabelRegex = regexp.MustCompile(`^(.+)-search-(\d+)$`)
+
+func tpccSearchLabel(search string, probe int) string {
+	return fmt.Sprintf("%s-search-%d", search, probe)
+}
+
+// tpccLoadRuns counts runs and passing runs of a load.
+type tpccLoadRuns struct {
+	runs, passed int
+}
+
+func loadRuns(probes []tpccProbeResult) map[int]*tpccLoadRuns {
+	loads := make(map[int]*tpccLoadRuns)
+	for _, p := range probes {
+		l, ok := loads[p.Active]
+		if !ok {
+			l = &tpccLoadRuns{}
+			loads[p.Active] = l
+		}
+		l.runs++
+		if p.Pass {
+			l.passed++
+		}
+	}
+	return loads
+}
+
+// bracket returns the largest passing load of the probes (0 if none) and the
+// smallest failing load above it (0 if none).  Loads which were not run
+// Repeats times yet are ignored.
+func (s tpccSearch) bracket(probes []tpccProbeResult) (low, high int) {
+	loads := loadRuns(probes)
+	var tested []int
+	for active, l := range loads {
+		if l.runs >= s.Repeats {
+			tested = append(tested, active)
+		}
+	}
+	sort.Ints(tested)
+	for _, active := range tested {
+		if loads[active].passed >= s.minPassing() {
+			low = active
+		}
+	}
+	for _, active := range tested {
+		if active > low && loads[active].passed < s.minPassing() {
+			return low, active
+		}
+	}
+	return low, 0
+}
+
+// next returns the load and the repeat of the next probe, or done if the
+// capacity is bracketed within the tolerance.
+func (s tpccSearch) next(probes []tpccProbeResult) (active, repeat int, done bool) {
+	if len(probes) == 0 {
+		return s.Start, 1, false
+	}
+	last := probes[len(probes)-1].Active
+	if n := loadRuns(probes)[last].runs; n < s.Repeats {
+		return last, n + 1, false
+	}
+
+	low, high := s.bracket(probes)
+	switch {
+	case high == 0:
+		// No failing load found yet.
+		if low >= s.Max {
+			return 0, 0, true
+		}
+		active = 2 * low
+		if active > s.Max {
+			active = s.Max
+		}
+	case low == 0:
+		// No passing load found yet.
+		if high <= s.Tolerance || high == 1 {
+			return 0, 0, true
+		}
+		active = high / 2
+	default:
+		if high-low <= s.Tolerance {
+			return 0, 0, true
+		}
+		active = low + (high-low)/2
+	}
+	return active, 1, false
+}
+
+func readTPCCSearchLog(p string) (*tpccSearchLog, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var l tpccSearchLog
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	return &l, nil
+}
+
+func writeTPCCSearchLog(p string, l *tpccSearchLog) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// tpccWarehouses returns the number of warehouses loaded by tpcc.sh invoked
+// with the arguments.
+func tpccWarehouses(args string) int {
+	fields := strings.Fields(args)
+	for i, f := range fields {
+		if f == "-W" && i+1 < len(fields) {
+			if n, err := strconv.Atoi(fields[i+1]); err == nil {
+				return n
+			}
+		}
+	}
+	return defaultTPCCWarehouses
+}
+
+// searchTPCC searches the TPC-C capacity of the cluster, running tpcc.sh
+// with varying number of active warehouses.  Every run is fetched, parsed
+// and recorded in the search log, which is replayed on --resume.
+func (r *runner) searchTPCC(ctx context.Context, b *Benchmark) error {
+	if err := r.requireNodes(2); err != nil {
+		return err
+	}
+	args := strings.TrimSpace(r.benchArgs(b) + " " + runTPCCExtraArgs)
+	search := runTPCCSearch
+	if search.Max == 0 {
+		search.Max = tpccWarehouses(args)
+	}
+	if err := search.validate(); err != nil {
+		return err
+	}
+
+	logPath := tpccSearchLogPath(r.logDir, r.nameExtra)
+	sl := &tpccSearchLog{
+		Cloud:       r.cloud.Cloud,
+		Group:       r.cloud.Group,
+		MachineType: r.machineType,
+		NameExtra:   r.nameExtra,
+		Config:      search,
+	}
+	if runResume {
+		prev, err := readTPCCSearchLog(logPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if prev != nil {
+			if prev.Config != search {
+				return fmt.Errorf("cannot resume search from %s: configured with %+v, expected %+v",
+					logPath, prev.Config, search)
+			}
+			sl = prev
+		}
+	}
+
+	if err := r.startCockroach(ctx); err != nil {
+		return err
+	}
+	out, err := r.roachprod(ctx, "pgurl", r.crdbNodes())
+	if err != nil {
+		return err
+	}
+	pgurls := strings.Join(strings.Fields(out), " ")
+	node := fmt.Sprintf("%s:%d", r.cluster, runNodes)
+
+	for {
+		active, repeat, done := search.next(sl.Probes)
+		if done {
+			break
+		}
+		p := tpccSearchProbe{Search: r.nameExtra, Probe: len(sl.Probes) + 1, Active: active, Repeat: repeat}
+		res, err := r.probeTPCC(ctx, b, node, args, pgurls, p, len(sl.Probes) > 0)
+		if err != nil {
+			return err
+		}
+		sl.Probes = append(sl.Probes, *res)
+		sl.Low, sl.High = search.bracket(sl.Probes)
+		log.Printf("%s: probe %d with %d active warehouses (run %d) pass=%t; capacity bracketed by [%d, %d]",
+			r.cluster, p.Probe, active, repeat, res.Pass, sl.Low, sl.High)
+		if err := writeTPCCSearchLog(logPath, sl); err != nil {
+			return err
+		}
+	}
+	sl.Done = true
+	return writeTPCCSearchLog(logPath, sl)
+}
+
+// probeTPCC runs TPC-C with the number of active warehouses of the probe
+// and returns its parsed results.  The fixture is only loaded by the first
+// probe.
+func (r *runner) probeTPCC(
+	ctx context.Context, b *Benchmark, node, args, pgurls string, p tpccSearchProbe, loaded bool,
+) (*tpccProbeResult, error) {
+	// Remove results of the previous probe so that waiting for this one
+	// does not find them.
+	if _, err := r.roachprod(ctx, "run", node, "--", "rm", "-rf", "./"+b.ResultsDir); err != nil {
+		return nil, err
+	}
+	probeArgs := fmt.Sprintf("%s -A %d", args, p.Active)
+	if loaded {
+		probeArgs += " -s"
+	}
+	started := stepTime()
+	if err := r.runUnderTmux(ctx, fmt.Sprintf("%s-%d", b.Name, p.Probe), node,
+		fmt.Sprintf("%s %s %s", b.Script, probeArgs, pgurls)); err != nil {
+		return nil, err
+	}
+	_, waitErr := r.roachprod(ctx, "run", node, b.Script, "--", "-w")
+
+	// Results of the probe are labelled with the probe.
+	pr := *r
+	pr.nameExtra = tpccSearchLabel(p.Search, p.Probe)
+	dir, err := pr.copyResultWithRetry(ctx, node, b.ResultsDir, true)
+	if err != nil {
+		return nil, err
+	}
+	m, err := pr.newRunManifest(ctx, b, strings.TrimSpace(probeArgs), &started)
+	if err != nil {
+		return nil, err
+	}
+	m.SearchProbe = &p
+	if err := writeRunManifest(dir, m); err != nil {
+		return nil, err
+	}
+	if waitErr != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	res := &tpccProbeResult{tpccSearchProbe: p, Dir: dir}
+	run, err := parseTPCCRun(path.Join(dir, fmt.Sprintf("tpcc-results-%d.txt", p.Active)))
+	switch {
+	case waitErr != nil:
+		res.Error = waitErr.Error()
+	case err != nil:
+		res.Error = err.Error()
+	default:
+		res.TpmC, res.Efc, res.P95, res.Pass = run.tpmC, run.efc, run.p95, run.pass()
+	}
+	return res, nil
+}
+
+// tpccSearches returns search logs of the machine type.
+func tpccSearches(cloud CloudDetails, machineType string) ([]*tpccSearchLog, error) {
+	logs, err := filepath.Glob(path.Join(cloud.LogDir(), FormatMachineType(machineType),
+		tpccSearchLogPrefix+"*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var searches []*tpccSearchLog
+	for _, p := range logs {
+		l, err := readTPCCSearchLog(p)
+		if err != nil {
+			return nil, err
+		}
+		if l.Cloud != cloud.Cloud || l.Group != cloud.Group || l.MachineType != machineType {
+			return nil, fmt.Errorf("%s: search of %s/%s/%s, expected %s/%s/%s",
+				p, l.Cloud, l.Group, l.MachineType, cloud.Cloud, cloud.Group, machineType)
+		}
+		searches = append(searches, l)
+	}
+	return searches, nil
+}
+
+const tpccSearchCSVHeader = "Cloud,Group,MachineType,Search,Done,Probe,ActiveWarehouses,Repeat," +
+	"Run,Pass,TpmC,Efc,P95,Error,Low,High"
+
+// writeSearches emits every probe of the TPC-C capacity searches, along
+// with the bracket of the capacity after the probe.
+func (t *tpccAnalyzer) writeSearches() (err error) {
+	if len(t.searches) == 0 {
+		return nil
+	}
+	wr, err := newResultWriter("tpcc-search", strings.Split(tpccSearchCSVHeader, ","), t.cloud)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := wr.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	sort.SliceStable(t.searches, func(i, j int) bool {
+		si, sj := t.searches[i], t.searches[j]
+		if si.Group != sj.Group {
+			return si.Group < sj.Group
+		}
+		if si.MachineType != sj.MachineType {
+			return si.MachineType < sj.MachineType
+		}
+		return si.NameExtra < sj.NameExtra
+	})
+	for _, s := range t.searches {
+		for i, p := range s.Probes {
+			low, high := s.Config.bracket(s.Probes[:i+1])
+			fields := []interface{}{
+				t.cloud, s.Group, s.MachineType, s.NameExtra, s.Done,
+				p.Probe, p.Active, p.Repeat, filepath.Base(p.Dir), p.Pass,
+				p.TpmC, p.Efc, p.P95, p.Error, low, high,
+			}
+			if err := wr.Write(fields); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
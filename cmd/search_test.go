@@ -0,0 +1,154 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func searchProbe(active, repeat int, pass bool) tpccProbeResult {
+	return tpccProbeResult{
+		tpccSearchProbe: tpccSearchProbe{Active: active, Repeat: repeat},
+		Pass:            pass,
+	}
+}
+
+// TestTPCCSearch runs searches against simulated runs, and verifies the
+// probed loads and the resulting bracket.
+func TestTPCCSearch(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		search tpccSearch
+		// pass returns whether the repeat of a load passes.
+		pass      func(active, repeat int) bool
+		loads     []int
+		low, high int
+	}{
+		{
+			name:   "all pass",
+			search: tpccSearch{Start: 100, Tolerance: 25, Repeats: 1, Max: 800},
+			pass:   func(int, int) bool { return true },
+			loads:  []int{100, 200, 400, 800},
+			low:    800,
+		},
+		{
+			name:   "all fail",
+			search: tpccSearch{Start: 100, Tolerance: 25, Repeats: 1, Max: 800},
+			pass:   func(int, int) bool { return false },
+			loads:  []int{100, 50, 25},
+			high:   25,
+		},
+		{
+			name:   "narrowing",
+			search: tpccSearch{Start: 100, Tolerance: 25, Repeats: 1, Max: 800},
+			pass:   func(active, _ int) bool { return active <= 300 },
+			loads:  []int{100, 200, 400, 300, 350, 325},
+			low:    300,
+			high:   325,
+		},
+		{
+			// Loads up to 100 pass two of three runs, and higher loads only
+			// the first run; a majority is required.
+			name:   "majority",
+			search: tpccSearch{Start: 100, Tolerance: 25, Repeats: 3, Max: 200},
+			pass:   func(active, repeat int) bool { return repeat == 1 || active <= 100 && repeat == 2 },
+			loads:  []int{100, 100, 100, 200, 200, 200, 150, 150, 150, 125, 125, 125},
+			low:    100,
+			high:   125,
+		},
+		{
+			name:   "min passing",
+			search: tpccSearch{Start: 100, Tolerance: 25, Repeats: 3, MinPassing: 1, Max: 200},
+			pass:   func(active, repeat int) bool { return repeat == 1 || active <= 100 && repeat == 2 },
+			loads:  []int{100, 100, 100, 200, 200, 200},
+			low:    200,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.search.validate(); err != nil {
+				t.Fatal(err)
+			}
+			var probes []tpccProbeResult
+			var loads []int
+			for {
+				active, repeat, done := tc.search.next(probes)
+				if done {
+					break
+				}
+				if len(loads) > 2*len(tc.loads) {
+					t.Fatalf("search does not terminate: probed %v", loads)
+				}
+				if n := loadRuns(probes)[active]; n != nil && repeat != n.runs+1 {
+					t.Errorf("load %d: expected repeat %d, got %d", active, n.runs+1, repeat)
+				}
+				probes = append(probes, searchProbe(active, repeat, tc.pass(active, repeat)))
+				loads = append(loads, active)
+			}
+			if !reflect.DeepEqual(loads, tc.loads) {
+				t.Errorf("expected probes %v, got %v", tc.loads, loads)
+			}
+			if low, high := tc.search.bracket(probes); low != tc.low || high != tc.high {
+				t.Errorf("expected bracket [%d, %d], got [%d, %d]", tc.low, tc.high, low, high)
+			}
+		})
+	}
+}
+
+func TestTPCCSearchBracket(t *testing.T) {
+	s := tpccSearch{Start: 100, Tolerance: 25, Repeats: 3, Max: 800}
+	for _, tc := range []struct {
+		name      string
+		probes    []tpccProbeResult
+		low, high int
+	}{
+		{name: "none"},
+		{
+			name: "incomplete load",
+			probes: []tpccProbeResult{
+				searchProbe(100, 1, true), searchProbe(100, 2, true), searchProbe(100, 3, true),
+				searchProbe(200, 1, false), searchProbe(200, 2, false),
+			},
+			low: 100,
+		},
+		{
+			name: "one of three",
+			probes: []tpccProbeResult{
+				searchProbe(100, 1, true), searchProbe(100, 2, false), searchProbe(100, 3, false),
+			},
+			high: 100,
+		},
+		{
+			name: "two of three",
+			probes: []tpccProbeResult{
+				searchProbe(100, 1, false), searchProbe(100, 2, true), searchProbe(100, 3, true),
+			},
+			low: 100,
+		},
+		{
+			// A failing load below a passing load does not bracket the
+			// capacity.
+			name: "failing below passing",
+			probes: []tpccProbeResult{
+				searchProbe(100, 1, false), searchProbe(100, 2, false), searchProbe(100, 3, false),
+				searchProbe(200, 1, true), searchProbe(200, 2, true), searchProbe(200, 3, true),
+				searchProbe(400, 1, false), searchProbe(400, 2, false), searchProbe(400, 3, true),
+			},
+			low:  200,
+			high: 400,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if low, high := s.bracket(tc.probes); low != tc.low || high != tc.high {
+				t.Errorf("expected bracket [%d, %d], got [%d, %d]", tc.low, tc.high, low, high)
+			}
+		})
+	}
+}
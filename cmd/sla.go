@@ -0,0 +1,260 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Flags of the analyze command configuring SLA policies.
+var slaPoliciesFile string
+var slaPolicyFlags []string
+
+func init() {
+	analyzeCmd.Flags().StringVar(&slaPoliciesFile, "sla-policies", "",
+		"path to JSON file with TPC-C SLA policies (see ./sla/example.json)")
+	analyzeCmd.Flags().StringArrayVar(&slaPolicyFlags, "sla", nil,
+		`TPC-C SLA policy as <name>=<rule>[,<rule>...], e.g. "strict=efc>90,p99<5000"; may be repeated`)
+}
+
+// slaPolicy is a named set of rules TPC-C runs must satisfy to pass.  Rules
+// have the form [<transaction>.]<metric> <op> <value>, where op is one of
+// <, <=, >, >=.  Run metrics are tpmC, efc, avg, p50, p90, p95, p99 and pMax;
+// per transaction metrics (e.g. newOrder.p95) are avg, p50, p95, p99 and
+// pMax of newOrder, payment, orderStatus, delivery and stockLevel.
+// Latencies are in milliseconds, unless suffixed with ms or s (e.g.
+// p95 < 5s); efficiency may be suffixed with %.  Runs without the per
+// transaction statistics a rule refers to do not pass.
+type slaPolicy struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Rules       []string `json:"rules"`
+	rules       []slaRule
+}
+
+type slaRule struct {
+	txn, metric, op string
+	value           float64
+}
+
+// tpccTxnNames are the names of TPC-C transactions reported by workload.
+var tpccTxnNames = []string{"newOrder", "payment", "orderStatus", "delivery", "stockLevel"}
+
+var slaRuleRegex = regexp.MustCompile(`^\s*(?:(\w+)\.)?(\w+)\s*(<=|>=|<|>)\s*([0-9]*\.?[0-9]+)\s*(%|ms|s)?\s*$`)
+
+func parseSLARule(rule string) (slaRule, error) {
+	m := slaRuleRegex.FindStringSubmatch(rule)
+	if m == nil {
+		return slaRule{}, fmt.Errorf("invalid rule %q; expected [<transaction>.]<metric> <op> <value>[%%|ms|s]", rule)
+	}
+	r := slaRule{txn: m[1], metric: m[2], op: m[3]}
+	if r.txn != "" && !containsString(tpccTxnNames, r.txn) {
+		return slaRule{}, fmt.Errorf("invalid rule %q: unknown transaction %q; expected one of %s",
+			rule, r.txn, strings.Join(tpccTxnNames, ", "))
+	}
+	var err error
+	if r.value, err = strconv.ParseFloat(m[4], 64); err != nil {
+		return slaRule{}, fmt.Errorf("invalid rule %q: %v", rule, err)
+	}
+	if _, ok := r.get(&tpccRun{txns: map[string]*tpccTxnStats{r.txn: {}}}); !ok {
+		return slaRule{}, fmt.Errorf("invalid rule %q: unknown metric %q", rule, m[2])
+	}
+	latency := r.txn != "" || r.metric != "tpmC" && r.metric != "efc"
+	switch unit := m[5]; {
+	case unit == "":
+	case unit == "%" && r.metric == "efc":
+	case (unit == "ms" || unit == "s") && latency:
+		if unit == "s" {
+			r.value *= 1000
+		}
+	default:
+		return slaRule{}, fmt.Errorf("invalid rule %q: unexpected unit %q of %s", rule, unit, m[2])
+	}
+	return r, nil
+}
+
+// get returns the metric of the run the rule applies to, false if the run
+// does not have it.
+func (r slaRule) get(run *tpccRun) (float64, bool) {
+	if r.txn != "" {
+		t, ok := run.txns[r.txn]
+		if !ok {
+			return 0, false
+		}
+		switch r.metric {
+		case "avg":
+			return t.avg, true
+		case "p50":
+			return t.p50, true
+		case "p95":
+			return t.p95, true
+		case "p99":
+			return t.p99, true
+		case "pMax":
+			return t.pMax, true
+		}
+		return 0, false
+	}
+	switch r.metric {
+	case "tpmC":
+		return run.tpmC, true
+	case "efc":
+		return run.efc, true
+	case "avg":
+		return run.avg, true
+	case "p50":
+		return run.p50, true
+	case "p90":
+		return run.p90, true
+	case "p95":
+		return run.p95, true
+	case "p99":
+		return run.p99, true
+	case "pMax":
+		return run.pMax, true
+	}
+	return 0, false
+}
+
+func (r slaRule) holds(run *tpccRun) bool {
+	v, ok := r.get(run)
+	if !ok {
+		return false
+	}
+	switch r.op {
+	case "<":
+		return v < r.value
+	case "<=":
+		return v <= r.value
+	case ">":
+		return v > r.value
+	default:
+		return v >= r.value
+	}
+}
+
+func (p *slaPolicy) parse() error {
+	if p.Name == "" {
+		return fmt.Errorf("SLA policy name is not specified")
+	}
+	if len(p.Rules) == 0 {
+		return fmt.Errorf("SLA policy %s: no rules specified", p.Name)
+	}
+	p.rules = nil
+	for _, rule := range p.Rules {
+		r, err := parseSLARule(rule)
+		if err != nil {
+			return fmt.Errorf("SLA policy %s: %v", p.Name, err)
+		}
+		p.rules = append(p.rules, r)
+	}
+	return nil
+}
+
+func mustParseSLAPolicy(p *slaPolicy) *slaPolicy {
+	if err := p.parse(); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// pass returns true if the run satisfies all rules of the policy.
+func (p *slaPolicy) pass(run *tpccRun) bool {
+	for _, r := range p.rules {
+		if !r.holds(run) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *slaPolicy) countPassing(runs []*tpccRun) int {
+	passed := 0
+	for _, r := range runs {
+		if p.pass(r) {
+			passed++
+		}
+	}
+	return passed
+}
+
+// defaultSLAPolicy determines the Pass column of TPC-C results, and the
+// capacity searched by sweep and run.
+var defaultSLAPolicy = mustParseSLAPolicy(&slaPolicy{
+	Name:        "default",
+	Description: "efficiency exceeds 85% and p95 < 10s",
+	Rules:       []string{"efc > 85", "p95 < 10000"},
+})
+
+// tpccSpecSLAPolicy approximates response time constraints of the TPC-C
+// specification (clause 5.2.5.4).  The specification limits the 90th
+// percentile of every transaction, which workload does not report; the
+// 95th percentile is used instead.
+var tpccSpecSLAPolicy = mustParseSLAPolicy(&slaPolicy{
+	Name:        "tpcc-spec",
+	Description: "efficiency exceeds 85% and transaction p95 within TPC-C response time limits",
+	Rules: []string{
+		"efc > 85",
+		"newOrder.p95 <= 5000",
+		"payment.p95 <= 5000",
+		"orderStatus.p95 <= 5000",
+		"delivery.p95 <= 5000",
+		"stockLevel.p95 <= 20000",
+	},
+})
+
+// slaPolicies returns the built-in policies followed by those configured
+// with --sla-policies and --sla.
+func slaPolicies() ([]*slaPolicy, error) {
+	policies := []*slaPolicy{defaultSLAPolicy, tpccSpecSLAPolicy}
+	if slaPoliciesFile != "" {
+		data, err := ioutil.ReadFile(slaPoliciesFile)
+		if err != nil {
+			return nil, err
+		}
+		var file struct {
+			Policies []*slaPolicy `json:"policies"`
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %v", slaPoliciesFile, err)
+		}
+		for _, p := range file.Policies {
+			if err := p.parse(); err != nil {
+				return nil, fmt.Errorf("%s: %v", slaPoliciesFile, err)
+			}
+		}
+		policies = append(policies, file.Policies...)
+	}
+	for _, f := range slaPolicyFlags {
+		eq := strings.Index(f, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("--sla %q: expected <name>=<rule>[,<rule>...]", f)
+		}
+		p := &slaPolicy{Name: strings.TrimSpace(f[:eq]), Rules: strings.Split(f[eq+1:], ",")}
+		if err := p.parse(); err != nil {
+			return nil, fmt.Errorf("--sla %q: %v", f, err)
+		}
+		policies = append(policies, p)
+	}
+
+	for i, p := range policies {
+		for _, prev := range policies[:i] {
+			if prev.Name == p.Name {
+				return nil, fmt.Errorf("SLA policy %s is defined more than once", p.Name)
+			}
+		}
+	}
+	return policies, nil
+}
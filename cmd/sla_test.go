@@ -0,0 +1,55 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSLARule(t *testing.T) {
+	for _, tc := range []struct {
+		rule string
+		want slaRule
+		err  string
+	}{
+		{rule: "efc > 85", want: slaRule{metric: "efc", op: ">", value: 85}},
+		{rule: "p99<=5000", want: slaRule{metric: "p99", op: "<=", value: 5000}},
+		{rule: "newOrder.p95 < 1000", want: slaRule{txn: "newOrder", metric: "p95", op: "<", value: 1000}},
+		{rule: "stockLevel.pMax < 20000", want: slaRule{txn: "stockLevel", metric: "pMax", op: "<", value: 20000}},
+		{rule: "efc > 85%", want: slaRule{metric: "efc", op: ">", value: 85}},
+		{rule: "p95 < 5s", want: slaRule{metric: "p95", op: "<", value: 5000}},
+		{rule: "p99 <= 2.5 s", want: slaRule{metric: "p99", op: "<=", value: 2500}},
+		{rule: "newOrder.pMax < 800ms", want: slaRule{txn: "newOrder", metric: "pMax", op: "<", value: 800}},
+		{rule: "p95", err: "expected [<transaction>.]<metric> <op> <value>"},
+		{rule: "p95 < 5m", err: "expected [<transaction>.]<metric> <op> <value>[%|ms|s]"},
+		{rule: "p95 < 5%", err: `unexpected unit "%" of p95`},
+		{rule: "newOrder.p95 < 5%", err: `unexpected unit "%" of p95`},
+		{rule: "efc > 85s", err: `unexpected unit "s" of efc`},
+		{rule: "tpmC > 1000ms", err: `unexpected unit "ms" of tpmC`},
+		{rule: "p42 < 10", err: `unknown metric "p42"`},
+		{rule: "newOrder.p90 < 10", err: `unknown metric "p90"`},
+		{rule: "neworder.p95 < 1000", err: `unknown transaction "neworder"`},
+		{rule: "all.p95 < 1000", err: `unknown transaction "all"`},
+	} {
+		r, err := parseSLARule(tc.rule)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.rule, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.rule, err)
+		} else if r != tc.want {
+			t.Errorf("%q: expected %+v, got %+v", tc.rule, tc.want, r)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Bootstrap confidence intervals are computed from a fixed number of
+// resamples using a fixed seed so that every analyst gets the same numbers.
+const (
+	bootstrapIterations = 10000
+	bootstrapSeed       = 20220101
+	bootstrapConfidence = 0.95
+)
+
+// summaryStats describes a sample of benchmark measurements.
+type summaryStats struct {
+	n             int
+	mean, median  float64
+	stddev, cv    float64
+	ciLow, ciHigh float64
+}
+
+// newSummaryStats computes statistics of the sample.  stddev is the sample
+// standard deviation, cv is the coefficient of variation (stddev/mean), and
+// [ciLow, ciHigh] is the bootstrap confidence interval of the mean.
+// Values which cannot be computed (e.g. stddev of a single value) are NaN.
+func newSummaryStats(values []float64) summaryStats {
+	s := summaryStats{
+		n:      len(values),
+		mean:   mean(values),
+		median: median(values),
+		stddev: stddev(values),
+	}
+	s.cv = math.NaN()
+	if s.mean != 0 {
+		s.cv = s.stddev / s.mean
+	}
+	s.ciLow, s.ciHigh = bootstrapMeanCI(values, bootstrapConfidence,
+		rand.New(rand.NewSource(bootstrapSeed)))
+	return s
+}
+
+// values returns statistics in the order of statsColumns.
+func (s summaryStats) values() []interface{} {
+	return []interface{}{s.mean, s.median, s.stddev, s.cv, s.ciLow, s.ciHigh}
+}
+
+// statsColumns returns column names for the statistics of the metric.
+func statsColumns(metric string) []string {
+	var cols []string
+	for _, stat := range []string{"Mean", "Median", "StdDev", "CV", "CILow", "CIHigh"} {
+		cols = append(cols, metric+stat)
+	}
+	return cols
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+func stddev(values []float64) float64 {
+	if len(values) < 2 {
+		return math.NaN()
+	}
+	m := mean(values)
+	var ss float64
+	for _, v := range values {
+		ss += (v - m) * (v - m)
+	}
+	return math.Sqrt(ss / float64(len(values)-1))
+}
+
+// bootstrapMeanCI returns the percentile bootstrap confidence interval of
+// the sample mean.
+func bootstrapMeanCI(values []float64, confidence float64, rng *rand.Rand) (lo, hi float64) {
+	if len(values) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	means := make([]float64, bootstrapIterations)
+	resample := make([]float64, len(values))
+	for i := range means {
+		for j := range resample {
+			resample[j] = values[rng.Intn(len(values))]
+		}
+		means[i] = mean(resample)
+	}
+	sort.Float64s(means)
+	alpha := (1 - confidence) / 2
+	return percentile(means, alpha), percentile(means, 1-alpha)
+}
+
+// percentile returns the p-th (0 <= p <= 1) percentile of sorted values
+// using linear interpolation between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	rank := p * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// equalOrNaN returns whether the values are equal, or both NaN.
+func equalOrNaN(a, b float64) bool {
+	return a == b || math.IsNaN(a) && math.IsNaN(b)
+}
+
+func TestSummaryStats(t *testing.T) {
+	nan := math.NaN()
+	for _, tc := range []struct {
+		name   string
+		values []float64
+		want   summaryStats
+	}{
+		{
+			name: "empty",
+			want: summaryStats{mean: nan, median: nan, stddev: nan, cv: nan, ciLow: nan, ciHigh: nan},
+		},
+		{
+			// The spread of a single value is unknown, but every resample
+			// has the same mean.
+			name:   "single",
+			values: []float64{42},
+			want:   summaryStats{n: 1, mean: 42, median: 42, stddev: nan, cv: nan, ciLow: 42, ciHigh: 42},
+		},
+		{
+			name:   "identical",
+			values: []float64{7, 7, 7, 7},
+			want:   summaryStats{n: 4, mean: 7, median: 7, stddev: 0, cv: 0, ciLow: 7, ciHigh: 7},
+		},
+		{
+			name:   "zero mean",
+			values: []float64{-1, 1},
+			want: summaryStats{n: 2, mean: 0, median: 0, stddev: math.Sqrt2, cv: nan,
+				ciLow: -1, ciHigh: 1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := newSummaryStats(tc.values)
+			want := tc.want
+			if got.n != want.n || !equalOrNaN(got.mean, want.mean) || !equalOrNaN(got.median, want.median) ||
+				!equalOrNaN(got.stddev, want.stddev) || !equalOrNaN(got.cv, want.cv) ||
+				!equalOrNaN(got.ciLow, want.ciLow) || !equalOrNaN(got.ciHigh, want.ciHigh) {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+func TestBootstrapMeanCI(t *testing.T) {
+	values := []float64{9.5, 10.1, 9.8, 10.4, 10.0, 9.7, 10.3, 9.9}
+	lo, hi := bootstrapMeanCI(values, bootstrapConfidence, rand.New(rand.NewSource(bootstrapSeed)))
+	m, s := mean(values), stddev(values)
+	// The interval contains the mean, and is close to the normal
+	// approximation of mean ± 1.96 standard errors.
+	se := s / math.Sqrt(float64(len(values)))
+	if !(lo < m && m < hi) {
+		t.Errorf("expected interval [%f, %f] to contain the mean %f", lo, hi, m)
+	}
+	if w := hi - lo; w < 2*1.5*se || w > 2*2.5*se {
+		t.Errorf("expected interval [%f, %f] width near %f, got %f", lo, hi, 2*1.96*se, w)
+	}
+	if lo < 9.5 || hi > 10.4 {
+		t.Errorf("expected interval [%f, %f] within the range of values", lo, hi)
+	}
+
+	// The fixed seed makes the interval reproducible.
+	lo2, hi2 := bootstrapMeanCI(values, bootstrapConfidence, rand.New(rand.NewSource(bootstrapSeed)))
+	if lo != lo2 || hi != hi2 {
+		t.Errorf("expected the same interval [%f, %f], got [%f, %f]", lo, hi, lo2, hi2)
+	}
+	if s := newSummaryStats(values); s.ciLow != lo || s.ciHigh != hi {
+		t.Errorf("expected summary interval [%f, %f], got [%f, %f]", lo, hi, s.ciLow, s.ciHigh)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4}
+	for _, tc := range []struct {
+		p, want float64
+	}{
+		{0, 1}, {1, 4}, {0.5, 2.5}, {1.0 / 3, 2},
+	} {
+		if got := percentile(sorted, tc.p); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("percentile %f: expected %f, got %f", tc.p, tc.want, got)
+		}
+	}
+	if got := percentile(nil, 0.5); !math.IsNaN(got) {
+		t.Errorf("expected NaN percentile of no values, got %f", got)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var statusBenchmarks []string
+var statusJSONFile string
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Reports which benchmarks completed for each machine type",
+	Long: `Walks the log directories of all configured machine types and reports, for
+every benchmark, the number of runs, whether they succeeded, whether any of their
+log files are empty and the age of the newest run.  Exits with an error if any of
+the required benchmarks did not complete.`,
+	// Incomplete results are reported as an error; usage does not help.
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		required, err := benchmarksOrInAll(statusBenchmarks)
+		if err != nil {
+			return err
+		}
+		cells, err := collectStatus(required, time.Now())
+		if err != nil {
+			return err
+		}
+		// Keep stdout parsable if JSON is written to it.
+		out := os.Stdout
+		if statusJSONFile == "-" {
+			out = os.Stderr
+		}
+		printStatusMatrix(out, cells, required)
+		if err := writeStatusJSON(cells); err != nil {
+			return err
+		}
+		incomplete := 0
+		for _, c := range cells {
+			if c.Required && c.Status != statusOK {
+				incomplete++
+			}
+		}
+		if incomplete > 0 {
+			return fmt.Errorf("%d required benchmark results are missing or incomplete", incomplete)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().StringSliceVar(&statusBenchmarks, "bench", nil,
+		fmt.Sprintf("comma separated list of required benchmarks: %s; benchmarks executed by \"-w all\" if not specified",
+			strings.Join(benchmarkNames(), ", ")))
+	statusCmd.Flags().StringVar(&statusJSONFile, "json", "",
+		`path to the JSON status; defaults to status.json in the results directory, "-" for stdout`)
+}
+
+// Status of the benchmark results of the machine type.
+const (
+	statusOK = "ok"
+	// statusMissing means that the benchmark never ran.
+	statusMissing = "missing"
+	// statusFailed means that none of the runs produced the success marker.
+	statusFailed = "failed"
+	// statusEmptyLogs means that all successful runs have empty log files,
+	// i.e. their results were not copied correctly.
+	statusEmptyLogs = "empty-logs"
+)
+
+// statusCell describes results of the benchmark for the machine type.
+type statusCell struct {
+	Cloud       string `json:"cloud"`
+	Group       string `json:"group"`
+	MachineType string `json:"machineType"`
+	Benchmark   string `json:"benchmark"`
+	Required    bool   `json:"required"`
+	Status      string `json:"status"`
+	Runs        int    `json:"runs"`
+	Succeeded   int    `json:"succeeded"`
+	// EmptyLogs lists empty log files of all runs.
+	EmptyLogs []string `json:"emptyLogs,omitempty"`
+	// RunsPerWarehousePerVCPU counts TPC-C runs of each load.
+	RunsPerWarehousePerVCPU map[string]int `json:"runsPerWarehousePerVCPU,omitempty"`
+	Newest                  *time.Time     `json:"newest,omitempty"`
+	AgeHours                float64        `json:"ageHours,omitempty"`
+}
+
+// collectStatus returns status of every registered benchmark for every
+// configured machine type.
+func collectStatus(required []*Benchmark, now time.Time) ([]statusCell, error) {
+	var cells []statusCell
+	for _, cloud := range clouds {
+		for _, machineType := range sortedMachineTypes(cloud) {
+			for _, b := range benchmarks {
+				c, err := benchmarkStatus(b, cloud, machineType, now)
+				if err != nil {
+					return nil, err
+				}
+				c.Required = containsBenchmark(required, b)
+				cells = append(cells, c)
+			}
+		}
+	}
+	return cells, nil
+}
+
+func benchmarkStatus(b *Benchmark, cloud CloudDetails, machineType string, now time.Time) (statusCell, error) {
+	c := statusCell{
+		Cloud:       cloud.Cloud,
+		Group:       cloud.Group,
+		MachineType: machineType,
+		Benchmark:   b.Name,
+		Status:      statusMissing,
+	}
+	dirs, err := filepath.Glob(path.Join(cloud.LogDir(), FormatMachineType(machineType), b.ResultsDir+".*"))
+	if err != nil {
+		return c, err
+	}
+
+	var newest time.Time
+	complete := false
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		c.Runs++
+		id, err := runIDOfDir(b, cloud, machineType, dir, dir)
+		if err != nil {
+			return c, err
+		}
+		if id.Timestamp.After(newest) {
+			newest = id.Timestamp
+		}
+		if b.Name == "tpcc" {
+			if l := tpccLabelRegex.FindStringSubmatch(id.Label); l != nil {
+				if c.RunsPerWarehousePerVCPU == nil {
+					c.RunsPerWarehousePerVCPU = make(map[string]int)
+				}
+				c.RunsPerWarehousePerVCPU[l[1]]++
+			}
+		}
+
+		markers, err := filepath.Glob(path.Join(dir, b.SuccessMarker))
+		if err != nil {
+			return c, err
+		}
+		empty, err := emptyLogFiles(dir)
+		if err != nil {
+			return c, err
+		}
+		c.EmptyLogs = append(c.EmptyLogs, empty...)
+		if len(markers) > 0 {
+			c.Succeeded++
+			complete = complete || len(empty) == 0
+		}
+	}
+
+	switch {
+	case c.Runs == 0:
+		c.Status = statusMissing
+	case c.Succeeded == 0:
+		c.Status = statusFailed
+	case !complete:
+		c.Status = statusEmptyLogs
+	default:
+		c.Status = statusOK
+	}
+	if !newest.IsZero() {
+		c.Newest = &newest
+		c.AgeHours = now.Sub(newest).Hours()
+	}
+	return c, nil
+}
+
+// formatAge formats the age in days, hours or minutes.
+func formatAge(hours float64) string {
+	switch {
+	case hours >= 48:
+		return fmt.Sprintf("%dd", int(hours/24))
+	case hours >= 1:
+		return fmt.Sprintf("%dh", int(hours))
+	default:
+		return fmt.Sprintf("%dm", int(hours*60))
+	}
+}
+
+func (c *statusCell) String() string {
+	if c.Runs == 0 {
+		return c.Status
+	}
+	s := fmt.Sprintf("%s %d/%d %s", c.Status, c.Succeeded, c.Runs, formatAge(c.AgeHours))
+	if len(c.RunsPerWarehousePerVCPU) > 0 {
+		var loads []string
+		for l := range c.RunsPerWarehousePerVCPU {
+			loads = append(loads, l)
+		}
+		sort.Slice(loads, func(i, j int) bool { return atoiOrZero(loads[i]) < atoiOrZero(loads[j]) })
+		var counts []string
+		for _, l := range loads {
+			counts = append(counts, fmt.Sprintf("%s:%d", l, c.RunsPerWarehousePerVCPU[l]))
+		}
+		s += " [" + strings.Join(counts, " ") + "]"
+	}
+	return s
+}
+
+// printStatusMatrix prints status of the benchmarks (columns) of every
+// machine type (rows).  Cells are "<status> <succeeded>/<runs> <age>".
+func printStatusMatrix(out io.Writer, cells []statusCell, required []*Benchmark) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	header := []string{"CLOUD", "GROUP", "MACHINE"}
+	for _, b := range benchmarks {
+		name := strings.ToUpper(b.Name)
+		if !containsBenchmark(required, b) {
+			name += "*"
+		}
+		header = append(header, name)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for i := 0; i < len(cells); i += len(benchmarks) {
+		row := []string{cells[i].Cloud, cells[i].Group, cells[i].MachineType}
+		for _, c := range cells[i : i+len(benchmarks)] {
+			row = append(row, c.String())
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	_ = w.Flush()
+	fmt.Fprintln(out, "* not required")
+}
+
+func containsBenchmark(list []*Benchmark, b *Benchmark) bool {
+	for _, e := range list {
+		if e == b {
+			return true
+		}
+	}
+	return false
+}
+
+func writeStatusJSON(cells []statusCell) error {
+	data, err := json.MarshalIndent(cells, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if statusJSONFile == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	p := statusJSONFile
+	if p == "" {
+		p = ResultsFile("status.json")
+	}
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Status written to %s\n", p)
+	return nil
+}
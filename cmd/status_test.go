@@ -0,0 +1,138 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectStatus(t *testing.T) {
+	dir, cleanup := newCacheTest(t)
+	defer cleanup()
+	savedClouds := clouds
+	defer func() { clouds = savedClouds }()
+	clouds = []CloudDetails{{
+		Cloud: "gce", Group: "pd-ssd",
+		MachineTypes: map[string]machineConfig{"n2-standard-8": {}},
+	}}
+
+	// writeRun writes the files of the run with the given content.
+	logs := filepath.Join(dir, "gce", "pd-ssd", "logs", "n2-standard-8")
+	writeRun := func(run string, files map[string]string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Join(logs, run), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(logs, run, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// A succeeded and a failed run; the age is that of the newest run.
+	writeRun("coremark-results.20220101.10:00:00", map[string]string{"success": "", "coremark.log": "score"})
+	writeRun("coremark-results.20211231.10:00:00", map[string]string{"coremark.log": "score"})
+	// Files matching the results directory are not runs.
+	if err := ioutil.WriteFile(filepath.Join(logs, "coremark-results.tar.gz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeRun("fio-results.20220101.09:00:00", map[string]string{"fio.log": "error"})
+	writeRun("tpcc-results.20220101.08:00:00-1000-1", map[string]string{"tpcc-results-8000.txt": "tpmC"})
+	writeRun("tpcc-results.20220101.08:30:00-1000-2", map[string]string{"tpcc-results-8000.txt": "tpmC"})
+	writeRun("tpcc-results.20220101.09:00:00-2000-1", map[string]string{"tpcc-results-16000.txt": "tpmC"})
+	// The success marker of netperf runs is a log file.
+	writeRun("intra-az-netperf-results.20220101.07:00:00", map[string]string{
+		"intra-az-netperf-results.log": "", "netperf.log": "throughput",
+	})
+
+	now := time.Date(2022, 1, 3, 8, 0, 0, 0, time.UTC)
+	required := []*Benchmark{getBenchmark("cpu"), getBenchmark("io"), getBenchmark("tpcc")}
+	cells, err := collectStatus(required, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != len(benchmarks) {
+		t.Fatalf("expected %d cells, got %d", len(benchmarks), len(cells))
+	}
+
+	want := map[string]string{
+		"cpu":    "ok 1/2 46h",
+		"io":     "failed 0/1 47h",
+		"tpcc":   "ok 3/3 47h [1000:2 2000:1]",
+		"ia_net": "empty-logs 1/1 2d",
+		"cr_net": "missing",
+	}
+	got := make(map[string]string)
+	for i := range cells {
+		c := &cells[i]
+		got[c.Benchmark] = c.String()
+		if r := containsBenchmark(required, getBenchmark(c.Benchmark)); c.Required != r {
+			t.Errorf("%s: expected required %t, got %t", c.Benchmark, r, c.Required)
+		}
+		if c.Cloud != "gce" || c.Group != "pd-ssd" || c.MachineType != "n2-standard-8" {
+			t.Errorf("%s: unexpected configuration %s/%s/%s", c.Benchmark, c.Cloud, c.Group, c.MachineType)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	for _, c := range cells {
+		switch c.Benchmark {
+		case "ia_net":
+			if want := []string{filepath.Join(logs, "intra-az-netperf-results.20220101.07:00:00",
+				"intra-az-netperf-results.log")}; !reflect.DeepEqual(c.EmptyLogs, want) {
+				t.Errorf("expected empty logs %q, got %q", want, c.EmptyLogs)
+			}
+		case "cr_net":
+			if c.Newest != nil || c.AgeHours != 0 {
+				t.Errorf("expected no age of missing results, got %v, %f", c.Newest, c.AgeHours)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	printStatusMatrix(&out, cells, required)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header, one row and footer, got:\n%s", out.String())
+	}
+	if header := strings.Fields(lines[0]); !reflect.DeepEqual(header,
+		[]string{"CLOUD", "GROUP", "MACHINE", "CPU", "IO", "TPCC", "IA_NET*", "CR_NET*"}) {
+		t.Errorf("unexpected header %q", header)
+	}
+	if !strings.HasPrefix(lines[1], "gce") || !strings.Contains(lines[1], "ok 3/3 47h [1000:2 2000:1]") {
+		t.Errorf("unexpected row %q", lines[1])
+	}
+	if lines[2] != "* not required" {
+		t.Errorf("unexpected footer %q", lines[2])
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	for hours, want := range map[float64]string{
+		0:         "0m",
+		0.5:       "30m",
+		1:         "1h",
+		47.9:      "47h",
+		48:        "2d",
+		24*10 + 5: "10d",
+	} {
+		if got := formatAge(hours); got != want {
+			t.Errorf("%f hours: expected %s, got %s", hours, want, got)
+		}
+	}
+}
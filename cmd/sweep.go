@@ -0,0 +1,386 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var sweepCloud string
+var sweepGroup string
+var sweepMachineTypes []string
+var sweepSpec string
+var sweepAll bool
+
+// sweepCmd represents the sweep command
+var sweepCmd = &cobra.Command{
+	Use:   "sweep",
+	Short: "Plans TPC-C runs sweeping the load of every machine type",
+	Long: `Expands the TPC-C sweep plan of every machine type into driver invocations, one
+per load and run, labelled with <warehousePerVCPU>-<run> NAME_EXTRA.
+
+Sweep plans are specified by the "` + sweepBenchArgsKey + `" benchArgs of the group or
+machine type in cloud details (or --spec) as
+
+  [adaptive] <loads> [runs=<n>]
+
+where loads is a comma separated list of warehouse per vCPU values and
+<from>..<to>[/<step>] ranges; loads of 1000 and more are numbers of active
+warehouses.  Adaptive sweeps take a single range: they probe its bounds and middle,
+then bisect the interval between the highest passing and the lowest failing load
+found in previous results, until the boundary is bracketed within the step.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		targets, err := selectTargets(sweepCloud, sweepGroup, sweepMachineTypes)
+		if err != nil {
+			return err
+		}
+		plan, err := planSweeps(targets)
+		if err != nil {
+			return err
+		}
+		return writeDriverPlan(plan, "sweep runs")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sweepCmd)
+
+	sweepCmd.Flags().StringVar(&sweepCloud, "cloud", "", "only sweep machine types of this cloud")
+	sweepCmd.Flags().StringVar(&sweepGroup, "group", "", "only sweep machine types of this group")
+	sweepCmd.Flags().StringSliceVarP(&sweepMachineTypes, "machine-type", "m", nil,
+		"comma separated list of machine types to sweep; all configured if not specified")
+	sweepCmd.Flags().StringVar(&sweepSpec, "spec", "",
+		"sweep plan overriding the "+sweepBenchArgsKey+" benchArgs of all machine types")
+	sweepCmd.Flags().BoolVar(&sweepAll, "all", false, "include runs which already have results")
+	addDriverPlanFlags(sweepCmd)
+}
+
+// sweepBenchArgsKey is the benchArgs key with the TPC-C sweep plan.  The
+// plan is not passed to the driver.
+const sweepBenchArgsKey = "tpcc_sweep"
+
+// Defaults of the sweep plan, as used by run_tpcc_experiment.sh.
+const (
+	defaultSweepRuns = 4
+	defaultSweepStep = 25
+)
+
+// tpccSweep is a plan of TPC-C runs with varying load.
+type tpccSweep struct {
+	// loads of the sweep; adaptive sweeps have a single from, to range.
+	loads          []int
+	adaptive       bool
+	from, to, step int
+	// runs is the number of runs of every load.
+	runs int
+}
+
+func parseTPCCSweep(spec string) (*tpccSweep, error) {
+	s := &tpccSweep{runs: defaultSweepRuns}
+	fields := strings.Fields(spec)
+	if len(fields) > 0 && fields[0] == "adaptive" {
+		s.adaptive = true
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("sweep %q: loads are not specified", spec)
+	}
+	for _, f := range fields[1:] {
+		if !strings.HasPrefix(f, "runs=") {
+			return nil, fmt.Errorf("sweep %q: unexpected %q", spec, f)
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(f, "runs="))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("sweep %q: invalid number of runs %q", spec, f)
+		}
+		s.runs = n
+	}
+
+	for _, item := range strings.Split(fields[0], ",") {
+		from, to, step, err := parseSweepRange(item)
+		if err != nil {
+			return nil, fmt.Errorf("sweep %q: %v", spec, err)
+		}
+		if s.adaptive {
+			if s.step != 0 {
+				return nil, fmt.Errorf("sweep %q: adaptive sweep takes a single range", spec)
+			}
+			if from == to {
+				return nil, fmt.Errorf("sweep %q: adaptive sweep takes a range, found %q", spec, item)
+			}
+			s.from, s.to, s.step = from, to, step
+			s.loads = []int{from, to}
+			continue
+		}
+		for load := from; load <= to; load += step {
+			if !containsInt(s.loads, load) {
+				s.loads = append(s.loads, load)
+			}
+		}
+	}
+	sort.Ints(s.loads)
+	return s, nil
+}
+
+// parseSweepRange parses a load or a <from>..<to>[/<step>] range of loads.
+func parseSweepRange(item string) (from, to, step int, err error) {
+	step = defaultSweepStep
+	r := item
+	if i := strings.Index(r, "/"); i >= 0 {
+		if step, err = strconv.Atoi(r[i+1:]); err != nil || step < 1 {
+			return 0, 0, 0, fmt.Errorf("invalid step in %q", item)
+		}
+		r = r[:i]
+	}
+	bounds := strings.SplitN(r, "..", 2)
+	if from, err = strconv.Atoi(bounds[0]); err != nil || from < 1 {
+		return 0, 0, 0, fmt.Errorf("invalid load %q", item)
+	}
+	to = from
+	if len(bounds) == 2 {
+		if to, err = strconv.Atoi(bounds[1]); err != nil || to < from {
+			return 0, 0, 0, fmt.Errorf("invalid range %q", item)
+		}
+	}
+	return from, to, step, nil
+}
+
+func containsInt(list []int, v int) bool {
+	for _, e := range list {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// sweepOf returns the sweep plan of the machine type, nil if not specified.
+// Machine type benchArgs override those of the group.
+func sweepOf(cloud CloudDetails, machineType string) (*tpccSweep, error) {
+	spec := sweepSpec
+	if spec == "" {
+		spec = cloud.BenchArgs[sweepBenchArgsKey]
+		if s, ok := cloud.MachineTypes[machineType].BenchArgs[sweepBenchArgsKey]; ok {
+			spec = s
+		}
+	}
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	s, err := parseTPCCSweep(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s/%s: %v", cloud.Cloud, cloud.Group, machineType, err)
+	}
+	return s, nil
+}
+
+// labels returns NAME_EXTRA labels of runs of the loads.
+func (s *tpccSweep) labels(loads []int) []string {
+	var labels []string
+	for _, load := range loads {
+		for run := 1; run <= s.runs; run++ {
+			labels = append(labels, fmt.Sprintf("%d-%d", load, run))
+		}
+	}
+	return labels
+}
+
+// sweepLoad are the runs of a load of the sweep.
+type sweepLoad struct {
+	// runs are parsed results of the completed runs.
+	runs []*tpccRun
+	// failed is the number of completed runs without usable results, which
+	// count as failing runs.
+	failed int
+	// pending is the number of runs which did not complete yet.
+	pending int
+}
+
+// probeLoads returns loads the adaptive sweep probes next, given previous
+// runs keyed by load.  Loads with incomplete runs are pending; no loads are
+// probed until they complete.  The note describes the state of the search.
+func (s *tpccSweep) probeLoads(runs map[int]*sweepLoad) (loads []int, note string) {
+	var waiting, tested []int
+	for load, l := range runs {
+		if load < s.from || load > s.to {
+			continue
+		}
+		if l.pending > 0 {
+			waiting = append(waiting, load)
+		} else if len(l.runs) > 0 || l.failed > 0 {
+			tested = append(tested, load)
+		}
+	}
+	if len(waiting) > 0 {
+		sort.Ints(waiting)
+		return nil, fmt.Sprintf("waiting for results of loads %v", waiting)
+	}
+	sort.Ints(tested)
+	if len(tested) == 0 {
+		mid := s.from + (s.to-s.from)/2/s.step*s.step
+		loads = []int{s.from}
+		if mid > s.from && mid < s.to {
+			loads = append(loads, mid)
+		}
+		return append(loads, s.to), "initial probes"
+	}
+
+	passes := func(load int) bool {
+		return countPassingRuns(runs[load].runs) >= tpccMinPassingRuns
+	}
+	maxPassing := -1
+	for _, load := range tested {
+		if passes(load) {
+			maxPassing = load
+		}
+	}
+	if maxPassing < 0 {
+		if !containsInt(tested, s.from) {
+			return []int{s.from}, "no passing load found yet"
+		}
+		return nil, fmt.Sprintf("lowest load %d fails; lower the range", s.from)
+	}
+	minFailing := -1
+	for _, load := range tested {
+		if load > maxPassing && !passes(load) {
+			minFailing = load
+			break
+		}
+	}
+	if minFailing < 0 {
+		if !containsInt(tested, s.to) {
+			return []int{s.to}, fmt.Sprintf("no failing load above %d found yet", maxPassing)
+		}
+		return nil, fmt.Sprintf("highest load %d passes; raise the range", s.to)
+	}
+	if minFailing-maxPassing <= s.step {
+		return nil, fmt.Sprintf("capacity bracketed between %d and %d", maxPassing, minFailing)
+	}
+	mid := maxPassing + (minFailing-maxPassing)/2/s.step*s.step
+	if mid <= maxPassing {
+		mid = maxPassing + s.step
+	}
+	return []int{mid}, fmt.Sprintf("bisecting between passing %d and failing %d", maxPassing, minFailing)
+}
+
+// sweepResults returns TPC-C runs of the machine type keyed by load.  Runs
+// complete once their results are fetched: drivers record the end of the
+// run in the manifest after fetching results, successful or not.
+func sweepResults(cloud CloudDetails, machineType string) (map[int]*sweepLoad, error) {
+	b := getBenchmark("tpcc")
+	runs, err := labelledRuns(b, cloud, machineType)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[int]*sweepLoad)
+	for label, dirs := range runs {
+		l := tpccLabelRegex.FindStringSubmatch(label)
+		if l == nil {
+			continue
+		}
+		load := atoiOrZero(l[1])
+		if results[load] == nil {
+			results[load] = &sweepLoad{}
+		}
+		res := results[load]
+		for _, d := range dirs {
+			if !d.succeeded {
+				m, err := readRunManifest(d.dir)
+				if err != nil {
+					return nil, err
+				}
+				if m == nil || m.End == nil {
+					res.pending++
+					continue
+				}
+				log.Printf("tpcc run %s failed; counted as failing", d.dir)
+				res.failed++
+				continue
+			}
+			files, err := filepath.Glob(path.Join(d.dir, b.SuccessMarker))
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				run, err := parseTPCCRun(f)
+				if err != nil {
+					log.Printf("failed to parse tpcc run: %v; counted as failing", err)
+					res.failed++
+					continue
+				}
+				res.runs = append(res.runs, run)
+			}
+		}
+	}
+	return results, nil
+}
+
+// planSweeps returns driver invocations of TPC-C sweep runs of the machine
+// types.  Runs which already have results are skipped unless --all.
+func planSweeps(targets []runTarget) ([]*driverInvocation, error) {
+	var plan []*driverInvocation
+	for _, t := range targets {
+		s, err := sweepOf(t.cloud, t.machineType)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			log.Printf("%s/%s/%s: no %s benchArgs; skipping",
+				t.cloud.Cloud, t.cloud.Group, t.machineType, sweepBenchArgsKey)
+			continue
+		}
+
+		loads := s.loads
+		reason := "sweep"
+		var note string
+		if s.adaptive {
+			results, err := sweepResults(t.cloud, t.machineType)
+			if err != nil {
+				return nil, err
+			}
+			loads, note = s.probeLoads(results)
+			reason = "probe"
+			log.Printf("%s/%s/%s: %s", t.cloud.Cloud, t.cloud.Group, t.machineType, note)
+		}
+
+		runs, err := labelledRuns(getBenchmark("tpcc"), t.cloud, t.machineType)
+		if err != nil {
+			return nil, err
+		}
+		for _, label := range s.labels(loads) {
+			if !sweepAll {
+				completed := false
+				for _, d := range runs[label] {
+					completed = completed || d.succeeded
+				}
+				if completed {
+					continue
+				}
+			}
+			l := tpccLabelRegex.FindStringSubmatch(label)
+			detail := fmt.Sprintf("load %s, run %s of %d", l[1], l[2], s.runs)
+			if note != "" {
+				detail += "; " + note
+			}
+			inv := newDriverInvocation(t.cloud, t.machineType, label, tpccExtraArgs(label))
+			inv.add(planReason{Benchmark: "tpcc", Reason: reason, Detail: detail})
+			plan = append(plan, inv)
+		}
+	}
+	return plan, nil
+}
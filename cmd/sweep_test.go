@@ -0,0 +1,158 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProbeLoads(t *testing.T) {
+	passing := &tpccRun{efc: 95, p95: 100}
+	failing := &tpccRun{efc: 40, p95: 100}
+	s, err := parseTPCCSweep("adaptive 50..250/10 runs=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name  string
+		runs  map[int]*sweepLoad
+		loads []int
+		note  string
+	}{
+		{
+			name:  "initial",
+			loads: []int{50, 150, 250},
+			note:  "initial probes",
+		},
+		{
+			name: "pending",
+			runs: map[int]*sweepLoad{
+				50:  {runs: []*tpccRun{passing}},
+				150: {runs: []*tpccRun{passing}, pending: 1},
+			},
+			note: "waiting for results of loads [150]",
+		},
+		{
+			// Completed runs without usable results fail.
+			name: "failed runs",
+			runs: map[int]*sweepLoad{
+				50:  {runs: []*tpccRun{passing, failing}},
+				150: {failed: 2},
+				250: {runs: []*tpccRun{failing}, failed: 1},
+			},
+			loads: []int{100},
+			note:  "bisecting between passing 50 and failing 150",
+		},
+		{
+			name: "lowest load fails",
+			runs: map[int]*sweepLoad{
+				50:  {failed: 2},
+				150: {failed: 2},
+			},
+			note: "lowest load 50 fails; lower the range",
+		},
+		{
+			name: "bracketed",
+			runs: map[int]*sweepLoad{
+				50:  {runs: []*tpccRun{passing}},
+				100: {runs: []*tpccRun{passing}},
+				110: {failed: 1},
+				250: {runs: []*tpccRun{failing}},
+			},
+			note: "capacity bracketed between 100 and 110",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			loads, note := s.probeLoads(tc.runs)
+			if !reflect.DeepEqual(loads, tc.loads) || note != tc.note {
+				t.Errorf("expected %v (%s), got %v (%s)", tc.loads, tc.note, loads, note)
+			}
+		})
+	}
+}
+
+func TestSweepResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sweep-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedOutputDir, savedVersion := baseOutputDir, reportVersion
+	defer func() { baseOutputDir, reportVersion = savedOutputDir, savedVersion }()
+	baseOutputDir, reportVersion = dir, "20220101"
+
+	cloud := CloudDetails{Cloud: "gce", Group: "pd-ssd"}
+	const machineType = "n2-standard-8"
+	end := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	// runDir creates the results directory of the labelled run with the
+	// files copied from testdata, and the manifest if complete.
+	runDir := func(label string, complete bool, files map[string]string) {
+		d := filepath.Join(cloud.LogDir(), machineType, "tpcc-results.20220101.10:00:00-"+label)
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, src := range files {
+			b, err := ioutil.ReadFile(filepath.Join("testdata", src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(d, name), b, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if complete {
+			if err := writeRunManifest(d, &runManifest{
+				Cloud: cloud.Cloud, Group: cloud.Group, MachineType: machineType,
+				Benchmark: "tpcc", NameExtra: label, End: &end,
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	runDir("100-1", true, map[string]string{
+		"tpcc-results.txt": "tpcc/results.txt", "cpu_info.txt": "cpu_info/single-host.txt",
+	})
+	// A run which did not produce results.
+	runDir("150-1", true, map[string]string{"cpu_info.txt": "cpu_info/single-host.txt"})
+	// A run with unparsable results.
+	runDir("150-2", true, map[string]string{
+		"tpcc-results.txt": "tpcc/truncated.txt", "cpu_info.txt": "cpu_info/single-host.txt",
+	})
+	// A run whose results are being fetched.
+	runDir("200-1", false, nil)
+
+	results, err := sweepResults(cloud, machineType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for load, want := range map[int]struct{ runs, failed, pending int }{
+		100: {runs: 1},
+		150: {failed: 2},
+		200: {pending: 1},
+	} {
+		l := results[load]
+		if l == nil {
+			t.Errorf("load %d: no runs found", load)
+			continue
+		}
+		if len(l.runs) != want.runs || l.failed != want.failed || l.pending != want.pending {
+			t.Errorf("load %d: expected %d runs, %d failed, %d pending, got %d, %d, %d",
+				load, want.runs, want.failed, want.pending, len(l.runs), l.failed, l.pending)
+		}
+	}
+	if len(results) != 3 {
+		t.Errorf("expected runs of 3 loads, got %d", len(results))
+	}
+}
@@ -0,0 +1,446 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// cloudDetailsSchemaVersion is the version of the cloud details schema
+// (see cloudDetails/schema) enforced by the validate command.
+const cloudDetailsSchemaVersion = "v1"
+
+// validateFiles are the cloud details files specified via the
+// --cloud-details flag of the validate command.  The flag shadows the root
+// command flag, which unmarshals the files, so that files validate is
+// supposed to explain are read as raw JSON.
+var validateFiles []string
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [cloud details file...]",
+	Short: "Validates cloud details configuration files",
+	Long: `Validates cloud details files specified via --cloud-details or as arguments against
+the ` + cloudDetailsSchemaVersion + ` schema (cloudDetails/schema), and cross checks them for duplicate
+machine types, conflicting groups and arguments that have no effect.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files := append(append([]string(nil), validateFiles...), args...)
+		if len(files) == 0 {
+			return fmt.Errorf("no cloud details files specified")
+		}
+		v := newConfigValidator()
+		for _, f := range files {
+			if err := v.validateFile(f); err != nil {
+				return err
+			}
+		}
+		return v.report()
+	},
+}
+
+func init() {
+	validateCmd.Flags().StringArrayVarP(&validateFiles, "cloud-details", "d", nil,
+		"path(s) to JSON file containing cloud specific configuration.")
+	rootCmd.AddCommand(validateCmd)
+}
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// configProblem describes a problem found in the cloud details file.
+type configProblem struct {
+	file     string
+	pointer  string // JSON pointer (RFC 6901) to the offending value.
+	severity string
+	msg      string
+}
+
+func (p configProblem) String() string {
+	return fmt.Sprintf("%s#%s: %s: %s", p.file, p.pointer, p.severity, p.msg)
+}
+
+// jsonPointer returns JSON pointer to the value nested under the specified path.
+func jsonPointer(base string, tokens ...string) string {
+	for _, t := range tokens {
+		t = strings.Replace(t, "~", "~0", -1)
+		t = strings.Replace(t, "/", "~1", -1)
+		base += "/" + t
+	}
+	return base
+}
+
+// alternateRegions lists regions the driver script knows how to use for
+// the clusters created outside the default region.
+var alternateRegions = []string{"west"}
+
+var (
+	cloudDetailsFields  = []string{"cloud", "group", "roachprodArgs", "benchArgs", "machineTypes"}
+	machineConfigFields = []string{"roachprodArgs", "benchArgs"}
+)
+
+type configLocation struct {
+	file, pointer string
+}
+
+func (l configLocation) String() string {
+	return fmt.Sprintf("%s#%s", l.file, l.pointer)
+}
+
+type groupArgs struct {
+	loc                      configLocation
+	roachprodArgs, benchArgs interface{}
+}
+
+type configValidator struct {
+	problems []configProblem
+	machines map[string]configLocation
+	groups   map[string]groupArgs
+}
+
+func newConfigValidator() *configValidator {
+	return &configValidator{
+		machines: make(map[string]configLocation),
+		groups:   make(map[string]groupArgs),
+	}
+}
+
+func (v *configValidator) errorf(file, pointer, format string, args ...interface{}) {
+	v.problems = append(v.problems, configProblem{
+		file: file, pointer: pointer, severity: severityError, msg: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *configValidator) warnf(file, pointer, format string, args ...interface{}) {
+	v.problems = append(v.problems, configProblem{
+		file: file, pointer: pointer, severity: severityWarning, msg: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *configValidator) validateFile(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var root interface{}
+	if err := json.Unmarshal(b, &root); err != nil {
+		v.errorf(file, "", "invalid JSON: %v", err)
+		return nil
+	}
+	entries, ok := root.([]interface{})
+	if !ok {
+		v.errorf(file, "", "expected array of cloud details, found %s", jsonTypeName(root))
+		return nil
+	}
+	for i, e := range entries {
+		v.validateCloudDetails(file, jsonPointer("", fmt.Sprint(i)), e)
+	}
+	return nil
+}
+
+func (v *configValidator) validateCloudDetails(file, ptr string, val interface{}) {
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		v.errorf(file, ptr, "expected cloud details object, found %s", jsonTypeName(val))
+		return
+	}
+	v.checkFields(file, ptr, obj, cloudDetailsFields)
+
+	cloud, _ := v.requireString(file, ptr, obj, "cloud")
+	if cloud != "" {
+		if _, err := getProvider(cloud); err != nil {
+			v.errorf(file, jsonPointer(ptr, "cloud"), "%v", err)
+			cloud = ""
+		}
+	}
+	group, _ := v.requireString(file, ptr, obj, "group")
+
+	v.checkRoachprodArgs(file, jsonPointer(ptr, "roachprodArgs"), cloud, obj["roachprodArgs"])
+	v.checkBenchArgs(file, jsonPointer(ptr, "benchArgs"), obj["benchArgs"])
+
+	if cloud != "" && group != "" {
+		loc := configLocation{file: file, pointer: ptr}
+		key := cloud + "/" + group
+		if g, ok := v.groups[key]; !ok {
+			v.groups[key] = groupArgs{loc: loc, roachprodArgs: obj["roachprodArgs"], benchArgs: obj["benchArgs"]}
+		} else if !reflect.DeepEqual(g.roachprodArgs, obj["roachprodArgs"]) ||
+			!reflect.DeepEqual(g.benchArgs, obj["benchArgs"]) {
+			v.errorf(file, ptr, "group %q of %s cloud conflicts with the one defined at %s: "+
+				"common roachprodArgs/benchArgs differ", group, cloud, g.loc)
+		}
+	}
+
+	machinesPtr := jsonPointer(ptr, "machineTypes")
+	machines, ok := obj["machineTypes"].(map[string]interface{})
+	if !ok {
+		if _, found := obj["machineTypes"]; found {
+			v.errorf(file, machinesPtr, "expected object, found %s", jsonTypeName(obj["machineTypes"]))
+		} else {
+			v.errorf(file, ptr, "missing required field \"machineTypes\"")
+		}
+		return
+	}
+	if len(machines) == 0 {
+		v.warnf(file, machinesPtr, "no machine types specified")
+	}
+
+	for _, machineType := range sortedKeys(machines) {
+		mptr := jsonPointer(machinesPtr, machineType)
+		if cloud != "" && group != "" {
+			key := strings.Join([]string{cloud, group, machineType}, "/")
+			if prev, ok := v.machines[key]; ok {
+				v.errorf(file, mptr, "machine type %q in group %q of %s cloud already defined at %s",
+					machineType, group, cloud, prev)
+			} else {
+				v.machines[key] = configLocation{file: file, pointer: mptr}
+			}
+		}
+
+		switch cfg := machines[machineType].(type) {
+		case nil:
+			v.warnf(file, mptr, "null machine config; use {} to inherit group arguments")
+		case map[string]interface{}:
+			v.checkFields(file, mptr, cfg, machineConfigFields)
+			v.checkRoachprodArgs(file, jsonPointer(mptr, "roachprodArgs"), cloud, cfg["roachprodArgs"])
+			v.checkBenchArgs(file, jsonPointer(mptr, "benchArgs"), cfg["benchArgs"])
+		default:
+			v.errorf(file, mptr, "expected machine config object, found %s", jsonTypeName(cfg))
+		}
+	}
+}
+
+func (v *configValidator) requireString(
+	file, ptr string, obj map[string]interface{}, field string,
+) (string, bool) {
+	val, ok := obj[field]
+	if !ok {
+		v.errorf(file, ptr, "missing required field %q", field)
+		return "", false
+	}
+	s, ok := val.(string)
+	if !ok || s == "" {
+		v.errorf(file, jsonPointer(ptr, field), "expected non-empty string, found %s", jsonTypeName(val))
+		return "", false
+	}
+	return s, true
+}
+
+func (v *configValidator) checkFields(
+	file, ptr string, obj map[string]interface{}, known []string,
+) {
+	for _, f := range sortedKeys(obj) {
+		if containsString(known, f) {
+			continue
+		}
+		msg := fmt.Sprintf("unknown field %q", f)
+		if s := suggest(f, known); s != "" {
+			msg += fmt.Sprintf("; did you mean %q?", s)
+		}
+		v.errorf(file, jsonPointer(ptr, f), "%s", msg)
+	}
+}
+
+// checkArgs verifies that args (if specified) is a map of strings and returns it.
+func (v *configValidator) checkArgs(
+	file, ptr string, val interface{}, allowNull bool,
+) map[string]interface{} {
+	if val == nil {
+		return nil
+	}
+	args, ok := val.(map[string]interface{})
+	if !ok {
+		v.errorf(file, ptr, "expected object, found %s", jsonTypeName(val))
+		return nil
+	}
+	for _, k := range sortedKeys(args) {
+		switch args[k].(type) {
+		case string:
+		case nil:
+			if !allowNull {
+				v.errorf(file, jsonPointer(ptr, k), "expected string, found null")
+			}
+		default:
+			v.errorf(file, jsonPointer(ptr, k), "expected string, found %s", jsonTypeName(args[k]))
+		}
+	}
+	return args
+}
+
+func (v *configValidator) checkRoachprodArgs(file, ptr, cloud string, val interface{}) {
+	args := v.checkArgs(file, ptr, val, true /* allowNull */)
+	if cloud == "" {
+		return
+	}
+
+	for _, arg := range sortedKeys(args) {
+		aptr := jsonPointer(ptr, arg)
+		value, _ := args[arg].(string)
+
+		if argCloud, ok := cloudOfArg(arg); ok {
+			if argCloud != cloud {
+				v.errorf(file, aptr, "%s specific argument used in %s cloud config", argCloud, cloud)
+			} else if containsString(providers[cloud].ZoneArgs(), arg) && value == "" {
+				v.errorf(file, aptr, "zone config for %s is not specified", arg)
+			}
+			continue
+		}
+
+		// Arguments for an alternate region are specified as <region>-<zone or image arg>.
+		for _, name := range providerNames() {
+			p := providers[name]
+			region, a := analyzeAlterZone(p, arg)
+			isZone := a != ""
+			if !isZone {
+				region, a = analyzeAlterImage(p, arg)
+			}
+			if a == "" {
+				continue
+			}
+			if name != cloud {
+				v.errorf(file, aptr, "%s region argument %s does not match %s cloud", region, a, cloud)
+			} else if !containsString(alternateRegions, region) {
+				v.warnf(file, aptr, "argument for unused alternate region %q; supported regions: %s",
+					region, strings.Join(alternateRegions, ", "))
+			} else if isZone && value == "" {
+				v.errorf(file, aptr, "zone config for %s is not specified", arg)
+			}
+		}
+	}
+}
+
+func (v *configValidator) checkBenchArgs(file, ptr string, val interface{}) {
+	args := v.checkArgs(file, ptr, val, false /* allowNull */)
+	for _, arg := range sortedKeys(args) {
+		if spec, ok := args[arg].(string); ok && arg == sweepBenchArgsKey {
+			if _, err := parseTPCCSweep(spec); err != nil {
+				v.errorf(file, jsonPointer(ptr, arg), "%v", err)
+			}
+		}
+		if containsString(benchArgsKeys(), arg) {
+			continue
+		}
+		msg := fmt.Sprintf("benchArgs %q are not consumed by any benchmark", arg)
+		if s := suggest(arg, benchArgsKeys()); s != "" {
+			msg += fmt.Sprintf("; did you mean %q?", s)
+		}
+		v.errorf(file, jsonPointer(ptr, arg), "%s", msg)
+	}
+}
+
+// report prints all problems and returns an error if any of them is an error.
+func (v *configValidator) report() error {
+	numErrors := 0
+	for _, p := range v.problems {
+		fmt.Println(p)
+		if p.severity == severityError {
+			numErrors++
+		}
+	}
+	if numErrors > 0 {
+		return fmt.Errorf("cloud details validation failed: %d error(s), %d warning(s)",
+			numErrors, len(v.problems)-numErrors)
+	}
+	fmt.Printf("cloud details conform to %s schema (%d warning(s))\n",
+		cloudDetailsSchemaVersion, len(v.problems))
+	return nil
+}
+
+// cloudOfArg returns the cloud for the cloud specific argument.
+func cloudOfArg(arg string) (string, bool) {
+	for cloud := range providers {
+		if strings.HasPrefix(arg, cloud+"-") {
+			return cloud, true
+		}
+	}
+	return "", false
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns the candidate closest to s, if it is close enough to be
+// a likely misspelling.
+func suggest(s string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if d := editDistance(strings.ToLower(s), strings.ToLower(c)); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,271 @@
+// Copyright 2022 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// schemaValidator checks JSON values against the subset of JSON schema
+// (draft-07) keywords used by the cloud details schema.
+type schemaValidator struct {
+	root map[string]interface{}
+}
+
+func loadCloudDetailsSchema(t *testing.T) *schemaValidator {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("..", "cloudDetails", "schema",
+		"cloud-details."+cloudDetailsSchemaVersion+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(b, &root); err != nil {
+		t.Fatal(err)
+	}
+	return &schemaValidator{root: root}
+}
+
+// definition returns the schema referenced by "#/definitions/<name>".
+func (s *schemaValidator) definition(t *testing.T, ref string) map[string]interface{} {
+	t.Helper()
+	name := strings.TrimPrefix(ref, "#/definitions/")
+	def, ok := s.root["definitions"].(map[string]interface{})[name].(map[string]interface{})
+	if !ok {
+		t.Fatalf("unresolved schema reference %q", ref)
+	}
+	return def
+}
+
+// validate returns JSON pointers of the values violating the schema.
+func (s *schemaValidator) validate(
+	t *testing.T, ptr string, schema map[string]interface{}, val interface{},
+) []string {
+	t.Helper()
+	if ref, ok := schema["$ref"].(string); ok {
+		return s.validate(t, ptr, s.definition(t, ref), val)
+	}
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s: %s", ptr, fmt.Sprintf(format, args...)))
+	}
+
+	if typ, ok := schema["type"]; ok {
+		types, ok := typ.([]interface{})
+		if !ok {
+			types = []interface{}{typ}
+		}
+		found := false
+		for _, typ := range types {
+			found = found || typ == jsonTypeName(val)
+		}
+		if !found {
+			fail("expected %v, found %s", typ, jsonTypeName(val))
+			return problems
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			found = found || reflect.DeepEqual(e, val)
+		}
+		if !found {
+			fail("%v not in %v", val, enum)
+		}
+	}
+	if min, ok := schema["minLength"].(float64); ok {
+		if str, ok := val.(string); ok && float64(len(str)) < min {
+			fail("shorter than %v", min)
+		}
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		if arr, ok := val.([]interface{}); ok {
+			for i, item := range arr {
+				problems = append(problems, s.validate(t, jsonPointer(ptr, fmt.Sprint(i)), items, item)...)
+			}
+		}
+	}
+
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		return problems
+	}
+	if min, ok := schema["minProperties"].(float64); ok && float64(len(obj)) < min {
+		fail("fewer than %v properties", min)
+	}
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			if _, ok := obj[r.(string)]; !ok {
+				fail("missing required property %q", r)
+			}
+		}
+	}
+	props, _ := schema["properties"].(map[string]interface{})
+	for _, k := range sortedKeys(obj) {
+		kptr := jsonPointer(ptr, k)
+		if names, ok := schema["propertyNames"].(map[string]interface{}); ok {
+			problems = append(problems, s.validate(t, kptr, names, k)...)
+		}
+		if p, ok := props[k].(map[string]interface{}); ok {
+			problems = append(problems, s.validate(t, kptr, p, obj[k])...)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				fail("unknown property %q", k)
+			}
+		case map[string]interface{}:
+			problems = append(problems, s.validate(t, kptr, additional, obj[k])...)
+		}
+	}
+	return problems
+}
+
+func (s *schemaValidator) validateFile(t *testing.T, file string) []string {
+	t.Helper()
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var val interface{}
+	if err := json.Unmarshal(b, &val); err != nil {
+		t.Fatal(err)
+	}
+	return s.validate(t, "", s.root, val)
+}
+
+// validatorErrors returns errors found by the validate command in the file.
+func validatorErrors(t *testing.T, file string) []configProblem {
+	t.Helper()
+	v := newConfigValidator()
+	if err := v.validateFile(file); err != nil {
+		t.Fatal(err)
+	}
+	var errs []configProblem
+	for _, p := range v.problems {
+		if p.severity == severityError {
+			errs = append(errs, p)
+		}
+	}
+	return errs
+}
+
+// TestCloudDetailsSchema verifies that the schema and the validate command
+// agree: the cloud details files conform to both, and the invalid fixtures
+// are rejected by both.
+func TestCloudDetailsSchema(t *testing.T) {
+	schema := loadCloudDetailsSchema(t)
+
+	valid, err := filepath.Glob(filepath.Join("..", "cloudDetails", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(valid) == 0 {
+		t.Fatal("no cloud details files found")
+	}
+	for _, file := range valid {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			if problems := schema.validateFile(t, file); len(problems) > 0 {
+				t.Errorf("schema violations: %s", strings.Join(problems, "; "))
+			}
+			if errs := validatorErrors(t, file); len(errs) > 0 {
+				t.Errorf("validate errors: %v", errs)
+			}
+		})
+	}
+
+	invalid, err := filepath.Glob(filepath.Join("testdata", "cloudDetails", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invalid) == 0 {
+		t.Fatal("no invalid cloud details fixtures found")
+	}
+	for _, file := range invalid {
+		t.Run("invalid/"+filepath.Base(file), func(t *testing.T) {
+			if problems := schema.validateFile(t, file); len(problems) == 0 {
+				t.Error("expected schema violations, found none")
+			}
+			if errs := validatorErrors(t, file); len(errs) == 0 {
+				t.Error("expected validate errors, found none")
+			}
+		})
+	}
+}
+
+// TestCloudDetailsSchemaEnums verifies that the schema enumerates the
+// registered providers and the benchArgs keys consumed by benchmarks.
+func TestCloudDetailsSchemaEnums(t *testing.T) {
+	schema := loadCloudDetailsSchema(t)
+	enum := func(v interface{}) []string {
+		var names []string
+		for _, n := range v.(map[string]interface{})["enum"].([]interface{}) {
+			names = append(names, n.(string))
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	clouds := schema.definition(t, "#/definitions/cloudDetails")["properties"].(map[string]interface{})["cloud"]
+	if got, want := enum(clouds), providerNames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("schema clouds %v, expected providers %v", got, want)
+	}
+
+	benchArgs := schema.definition(t, "#/definitions/benchArgs")["propertyNames"]
+	want := benchArgsKeys()
+	sort.Strings(want)
+	if got := enum(benchArgs); !reflect.DeepEqual(got, want) {
+		t.Errorf("schema benchArgs %v, expected %v", got, want)
+	}
+}
+
+// TestCloudsValue verifies that the --cloud-details flag loads the cloud
+// details files, and rejects unknown keys.
+func TestCloudsValue(t *testing.T) {
+	savedFiles := cloudDetailsFiles
+	defer func() { cloudDetailsFiles = savedFiles }()
+
+	valid, err := filepath.Glob(filepath.Join("..", "cloudDetails", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range valid {
+		var loaded []CloudDetails
+		if err := newCloudsValue(&loaded).Set(file); err != nil {
+			t.Errorf("%s: %v", file, err)
+		} else if len(loaded) == 0 {
+			t.Errorf("%s: no cloud details loaded", file)
+		}
+	}
+
+	for file, want := range map[string]string{
+		"unknown-field.json": `unknown key "machineType" of cloud details; ` +
+			"expected one of cloud, group, roachprodArgs, benchArgs, machineTypes",
+		"unknown-machine-field.json": `unknown key "roachprodArg" of machine type n2-standard-8; ` +
+			"expected one of roachprodArgs, benchArgs",
+	} {
+		var loaded []CloudDetails
+		err := newCloudsValue(&loaded).Set(filepath.Join("testdata", "cloudDetails", file))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error %q, got %v", file, want, err)
+		}
+		if len(loaded) > 0 {
+			t.Errorf("%s: expected no cloud details loaded, got %v", file, loaded)
+		}
+	}
+}
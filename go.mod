@@ -3,7 +3,7 @@ module github.com/cockroachlabs/cloud-report
 go 1.13
 
 require (
-	github.com/cockroachdb/errors v1.8.6 // indirect
+	github.com/cockroachdb/errors v1.8.6
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.7.1
@@ -1,5 +1,9 @@
 #!/bin/bash
 
+# Runs a fixed TPC-C warehouse sweep for every driver script.  Prefer
+# "cloud-report sweep", which plans the sweep from the tpcc_sweep benchArgs
+# of cloud details.
+
 curdate=$(date '+%Y%m%d')
 cloud=
 args=
@@ -94,7 +94,14 @@ then
   echo "done loading"
 fi
 
-num_vcpu_per_node=$(cat /proc/cpuinfo | grep processor | wc -l)
+# Record the hardware inventory of the node, as the driver does for the
+# cluster; fetching the results replaces cpu_info.txt with the inventory of
+# all nodes.
+cpufetch -s legacy > "$logdir/cpu_info.txt"
+lscpu >> "$logdir/cpu_info.txt"
+sudo lshw -c memory > "$logdir/ram_info.txt"
+
+num_vcpu_per_node=$(awk -F: '/^CPU\(s\):/ {gsub(/ /, "", $2); print $2; exit}' "$logdir/cpu_info.txt")
 
 if (( f_active == 0 ))
 then